@@ -0,0 +1,113 @@
+// Package auth authenticates the callers of the proxy, and authorizes the calls they make
+package auth
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Identity is an authenticated caller, with the allow-lists of the calls it can make.
+// The allow-lists are patterns of path.Match, such as "my.package.*", and a nil allow-list allows everything.
+type Identity struct {
+	// Name tells the caller apart in logs
+	Name string `json:"name"`
+	// Services are the allowed gRPC services, which are fully qualified names
+	Services []string `json:"services,omitempty"`
+	// Methods are the allowed names of methods, without their services
+	Methods []string `json:"methods,omitempty"`
+	// Versions are the allowed versions of services, where the blank version is of requests which don't specify one
+	Versions []string `json:"versions,omitempty"`
+	// Authorizer decides the calls which the allow-lists allow, if any
+	Authorizer Authorizer `json:"-"`
+}
+
+// Authorizer decides whether an identity can call the method of the version of the service, such as by asking Kubernetes
+type Authorizer interface {
+	Authorize(service, method, version string) bool
+}
+
+// Allows tells whether the identity can call the method of the version of the service.
+// The method is blank for requests which are not calls, such as those for the documents of a service.
+func (id *Identity) Allows(service, method, version string) bool {
+	if !matchAny(id.Services, service) || !matchAny(id.Versions, version) {
+		return false
+	}
+	if method != "" && !matchAny(id.Methods, method) {
+		return false
+	}
+	return id.Authorizer == nil || id.Authorizer.Authorize(service, method, version)
+}
+
+// validate checks that the patterns of the allow-lists are well-formed
+func (id *Identity) validate() error {
+	for _, patterns := range [][]string{id.Services, id.Methods, id.Versions} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return &patternError{name: id.Name, pattern: p}
+			}
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	if patterns == nil {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type patternError struct {
+	name    string
+	pattern string
+}
+
+func (e *patternError) Error() string {
+	return "malformed pattern " + e.pattern + " in the allow-lists of " + e.name
+}
+
+// Authenticator authenticates the bearer tokens in the Authorization header of requests
+type Authenticator interface {
+	// Authenticate returns the identity of the token, or an error which tells why it is invalid
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
+
+// Authenticators authenticates tokens by the first of the authenticators which accepts them
+type Authenticators []Authenticator
+
+// Authenticate returns the identity of the first authenticator which accepts the token, or the errors of all of them
+func (as Authenticators) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if len(as) == 0 {
+		return nil, errors.New("no authenticators")
+	}
+	var errs []string
+	for _, a := range as {
+		id, err := a.Authenticate(ctx, token)
+		if err == nil {
+			return id, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+type identityKey struct{}
+
+// NewContext returns a context which carries the identity
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity in the context, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
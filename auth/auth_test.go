@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIdentity_Allows(t *testing.T) {
+	id := &Identity{
+		Name:     "frontend",
+		Services: []string{"my.package.*", "other.Service"},
+		Methods:  []string{"Get*"},
+		Versions: []string{"", "v1"},
+	}
+	cases := []struct {
+		name    string
+		service string
+		method  string
+		version string
+		allowed bool
+	}{
+		{
+			name:    "allowed",
+			service: "my.package.Library",
+			method:  "GetBook",
+			version: "v1",
+			allowed: true,
+		},
+		{
+			name:    "no version",
+			service: "other.Service",
+			method:  "Get",
+			version: "",
+			allowed: true,
+		},
+		{
+			name:    "no method",
+			service: "my.package.Library",
+			method:  "",
+			version: "v1",
+			allowed: true,
+		},
+		{
+			name:    "service not allowed",
+			service: "my.other.Library",
+			method:  "GetBook",
+			version: "v1",
+			allowed: false,
+		},
+		{
+			name:    "method not allowed",
+			service: "my.package.Library",
+			method:  "DeleteBook",
+			version: "v1",
+			allowed: false,
+		},
+		{
+			name:    "version not allowed",
+			service: "my.package.Library",
+			method:  "GetBook",
+			version: "v2",
+			allowed: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := id.Allows(tc.service, tc.method, tc.version), tc.allowed; got != want {
+				t.Errorf("got %t, want %t", got, want)
+			}
+		})
+	}
+
+	t.Run("no allow-lists", func(t *testing.T) {
+		id := &Identity{Name: "admin"}
+		if !id.Allows("any.Service", "Any", "any") {
+			t.Error("got false, want an identity without allow-lists to allow everything")
+		}
+	})
+	t.Run("empty allow-list", func(t *testing.T) {
+		id := &Identity{Name: "nobody", Services: []string{}}
+		if id.Allows("any.Service", "Any", "any") {
+			t.Error("got true, want an empty allow-list to allow nothing")
+		}
+	})
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("got an identity from an empty context")
+	}
+	id := &Identity{Name: "frontend"}
+	got, ok := FromContext(NewContext(context.Background(), id))
+	if !ok || got != id {
+		t.Errorf("got %v, want %v", got, id)
+	}
+}
+
+type fakeAuthorizer map[string]bool
+
+func (a fakeAuthorizer) Authorize(service, method, version string) bool {
+	return a[service+"/"+method]
+}
+
+func TestIdentity_AllowsAuthorizer(t *testing.T) {
+	id := &Identity{
+		Name:       "frontend",
+		Methods:    []string{"Get*"},
+		Authorizer: fakeAuthorizer{"svc/GetBook": true, "svc/DeleteBook": true},
+	}
+	cases := []struct {
+		method  string
+		allowed bool
+	}{
+		{method: "GetBook", allowed: true},
+		{method: "GetShelf", allowed: false},
+		{method: "DeleteBook", allowed: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method, func(t *testing.T) {
+			if got, want := id.Allows("svc", tc.method, ""), tc.allowed; got != want {
+				t.Errorf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+type fakeAuthenticator struct {
+	token string
+	id    *Identity
+}
+
+func (a *fakeAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token != a.token {
+		return nil, errors.New("invalid token for " + a.id.Name)
+	}
+	return a.id, nil
+}
+
+func TestAuthenticators_Authenticate(t *testing.T) {
+	as := Authenticators{
+		&fakeAuthenticator{token: "jwt", id: &Identity{Name: "jwt"}},
+		&fakeAuthenticator{token: "serviceaccount", id: &Identity{Name: "serviceaccount"}},
+	}
+	for _, token := range []string{"jwt", "serviceaccount"} {
+		id, err := as.Authenticate(context.Background(), token)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if got, want := id.Name, token; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+	_, err := as.Authenticate(context.Background(), "other")
+	if err == nil {
+		t.Fatal("got no error for a token which no authenticator accepts")
+	}
+	if got, want := err.Error(), "invalid token for jwt; invalid token for serviceaccount"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxKeySetSize is the maximum size of key sets fetched from URLs
+const maxKeySetSize = 1 << 20
+
+// KeySource loads a JSON Web Key Set
+type KeySource interface {
+	LoadKeys() ([]byte, error)
+}
+
+// FileKeySource loads the key set from the file
+type FileKeySource string
+
+// LoadKeys reads the file
+func (f FileKeySource) LoadKeys() ([]byte, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key set")
+	}
+	return b, nil
+}
+
+// URLKeySource fetches the key set from the URL, such as the jwks_uri of an OpenID Connect provider.
+// Client defaults to a client which times out in 10 seconds.
+type URLKeySource struct {
+	Client *http.Client
+	URL    string
+}
+
+var defaultKeyClient = &http.Client{Timeout: 10 * time.Second}
+
+// LoadKeys fetches the key set
+func (u *URLKeySource) LoadKeys() ([]byte, error) {
+	client := u.Client
+	if client == nil {
+		client = defaultKeyClient
+	}
+	resp, err := client.Get(u.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch key set")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch key set: %s returned %d", u.URL, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch key set")
+	}
+	return b, nil
+}
+
+// publicKey is a key of a key set, with the algorithm it is restricted to if any
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// parseKeySet parses the JSON Web Key Set into the public keys by their IDs.
+// Keys which are not for signatures, and keys of unsupported types, are skipped.
+func parseKeySet(b []byte) (map[string]*publicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "failed to parse key set")
+	}
+	keys := make(map[string]*publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse key %q", k.Kid)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, errors.Errorf("multiple keys have the ID %q", k.Kid)
+		}
+		keys[k.Kid] = &publicKey{alg: k.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed modulus")
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed exponent")
+	}
+	exponent := new(big.Int).SetBytes(eb)
+	if len(nb) == 0 || !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exponent.Int64())}, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed x coordinate")
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed y coordinate")
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.Errorf("the point is not on the curve %s", crv)
+	}
+	return key, nil
+}
+
+// KeySet holds the keys of a JSON Web Key Set, which is reloaded at an interval and when tokens are signed by unknown keys,
+// so that keys rotated by the issuer are picked up
+type KeySet struct {
+	src        KeySource
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]*publicKey
+	refreshMu sync.Mutex
+	refreshed time.Time
+}
+
+// NewKeySet creates an empty KeySet of the source.
+// Unknown keys make it reload the source at most once in minRefresh.
+func NewKeySet(src KeySource, minRefresh time.Duration) *KeySet {
+	return &KeySet{
+		src:        src,
+		minRefresh: minRefresh,
+		now:        time.Now,
+	}
+}
+
+// Reload loads the key set from the source.
+// The keys are kept if loading fails.
+func (s *KeySet) Reload() error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	return s.reload()
+}
+
+func (s *KeySet) reload() error {
+	s.refreshed = s.now()
+	b, err := s.src.LoadKeys()
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeySet(b)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// RunReloader reloads the key set at the interval until stopCh is closed.
+// Errors in reloading are passed to onError.
+func (s *KeySet) RunReloader(interval time.Duration, stopCh <-chan struct{}, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *KeySet) lookup(kid string) (*publicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// key returns the key of the ID, reloading the key set if the key is unknown and it was not reloaded recently
+func (s *KeySet) key(kid string) (*publicKey, error) {
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	// the key set may have been reloaded while waiting for the lock
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+	if s.now().Sub(s.refreshed) < s.minRefresh {
+		return nil, errors.Errorf("unknown key %q", kid)
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, errors.Errorf("unknown key %q", kid)
+}
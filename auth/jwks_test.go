@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return k
+}
+
+func newECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return k
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwk returns the JSON Web Key of the public key of the private key
+func jwk(kid string, key interface{}) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   b64(k.N.Bytes()),
+			"e":   b64(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PrivateKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x := make([]byte, size)
+		y := make([]byte, size)
+		return map[string]string{
+			"kty": "EC",
+			"kid": kid,
+			"crv": k.Curve.Params().Name,
+			"x":   b64(append(x[:size-len(k.X.Bytes())], k.X.Bytes()...)),
+			"y":   b64(append(y[:size-len(k.Y.Bytes())], k.Y.Bytes()...)),
+		}
+	}
+	return nil
+}
+
+func keySet(t *testing.T, keys ...map[string]string) []byte {
+	b, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return b
+}
+
+type fakeKeySource struct {
+	keys  []byte
+	err   error
+	loads int
+}
+
+func (s *fakeKeySource) LoadKeys() ([]byte, error) {
+	s.loads++
+	return s.keys, s.err
+}
+
+func TestParseKeySet(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey := newECKey(t, elliptic.P256())
+	encKey := jwk("enc", rsaKey)
+	encKey["use"] = "enc"
+	badCurve := jwk("bad", ecKey)
+	badCurve["crv"] = "P-192"
+	offCurve := jwk("off", ecKey)
+	offCurve["y"] = offCurve["x"]
+	cases := []struct {
+		name       string
+		input      []byte
+		kids       []string
+		errorIsNil bool
+	}{
+		{
+			name:       "rsa and ec",
+			input:      keySet(t, jwk("rsa", rsaKey), jwk("ec", ecKey)),
+			kids:       []string{"rsa", "ec"},
+			errorIsNil: true,
+		},
+		{
+			name:       "unsupported keys",
+			input:      keySet(t, jwk("rsa", rsaKey), encKey, map[string]string{"kty": "OKP", "kid": "okp"}),
+			kids:       []string{"rsa"},
+			errorIsNil: true,
+		},
+		{
+			name:       "unsupported curve",
+			input:      keySet(t, badCurve),
+			errorIsNil: false,
+		},
+		{
+			name:       "point not on the curve",
+			input:      keySet(t, offCurve),
+			errorIsNil: false,
+		},
+		{
+			name:       "duplicate IDs",
+			input:      keySet(t, jwk("a", rsaKey), jwk("a", ecKey)),
+			errorIsNil: false,
+		},
+		{
+			name:       "not JSON",
+			input:      []byte("keys"),
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := parseKeySet(tc.input)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := len(keys), len(tc.kids); got != want {
+				t.Fatalf("got %d keys, want %d", got, want)
+			}
+			for _, kid := range tc.kids {
+				if _, ok := keys[kid]; !ok {
+					t.Errorf("key %s is missing", kid)
+				}
+			}
+		})
+	}
+}
+
+func TestKeySet_key(t *testing.T) {
+	oldKey := newECKey(t, elliptic.P256())
+	newKey := newECKey(t, elliptic.P256())
+	src := &fakeKeySource{keys: keySet(t, jwk("old", oldKey))}
+	now := time.Unix(1000, 0)
+	s := NewKeySet(src, time.Minute)
+	s.now = func() time.Time { return now }
+	if err := s.Reload(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the key is rotated by the issuer
+	src.keys = keySet(t, jwk("new", newKey))
+	if _, err := s.key("new"); err == nil {
+		t.Fatal("got the new key before the minimum interval of reloading passed")
+	}
+	if got, want := src.loads, 1; got != want {
+		t.Fatalf("got %d loads, want %d", got, want)
+	}
+	now = now.Add(time.Minute)
+	if _, err := s.key("new"); err != nil {
+		t.Fatalf("got %v, want the new key", err)
+	}
+	if _, err := s.key("new"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := src.loads, 2; got != want {
+		t.Errorf("got %d loads, want %d", got, want)
+	}
+
+	src.err = errors.New("unavailable")
+	if err := s.Reload(); err == nil {
+		t.Fatal("got no error, want the error of the source")
+	}
+	if _, err := s.key("new"); err != nil {
+		t.Errorf("the keys were not kept after the source failed: %v", err)
+	}
+}
+
+func TestURLKeySource_LoadKeys(t *testing.T) {
+	keys := keySet(t, jwk("ec", newECKey(t, elliptic.P256())))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jwks.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(keys)
+	}))
+	defer ts.Close()
+
+	b, err := (&URLKeySource{URL: ts.URL + "/jwks.json"}).LoadKeys()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := string(b), string(keys); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := (&URLKeySource{URL: ts.URL + "/missing.json"}).LoadKeys(); err == nil {
+		t.Error("got no error for a missing key set")
+	}
+}
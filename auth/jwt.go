@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+// Verifier authenticates JSON Web Tokens signed by the keys of a key set, and authorizes them by the rules.
+// RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384 and ES512 are supported.
+type Verifier struct {
+	keys      *KeySet
+	issuer    string
+	audiences []string
+	leeway    time.Duration
+	rules     []*Rule
+	now       func() time.Time
+}
+
+// NewVerifier creates a Verifier of the issuer and the audiences of the configuration.
+// Tokens are allowed to make any call if there are no rules.
+func NewVerifier(keys *KeySet, c *config.JWT, rules []*Rule) (*Verifier, error) {
+	if c.Issuer == "" {
+		return nil, errors.New("the issuer of tokens is required")
+	}
+	if len(c.Audiences) == 0 {
+		return nil, errors.New("the audiences of tokens are required")
+	}
+	return &Verifier{
+		keys:      keys,
+		issuer:    c.Issuer,
+		audiences: c.Audiences,
+		leeway:    c.Leeway,
+		rules:     rules,
+		now:       time.Now,
+	}, nil
+}
+
+// Authenticate verifies the token, and returns the identity of its subject with the allow-lists of the rules
+func (v *Verifier) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("the token has no subject")
+	}
+	return applyRules(v.rules, sub, claims), nil
+}
+
+// Verify checks the signature, the issuer, the audience and the expiry of the token, and returns its claims
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, "malformed header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed signature")
+	}
+	key, err := v.keys.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, errors.Errorf("the key %q is not for %s", header.Kid, header.Alg)
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed claims")
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validate checks the registered claims
+func (v *Verifier) validate(c Claims) error {
+	if iss, _ := c["iss"].(string); iss != v.issuer {
+		return errors.Errorf("the token is issued by %q", iss)
+	}
+	if !hasAudience(c["aud"], v.audiences) {
+		return errors.New("the token is not for the audiences of the proxy")
+	}
+	now := v.now()
+	exp, ok := numericDate(c["exp"])
+	if !ok {
+		return errors.New("the token has no expiry")
+	}
+	if now.After(exp.Add(v.leeway)) {
+		return errors.Errorf("the token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(c["nbf"]); ok && now.Before(nbf.Add(-v.leeway)) {
+		return errors.Errorf("the token is not valid until %s", nbf.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// hasAudience checks if the "aud" claim has one of the audiences
+func hasAudience(aud interface{}, audiences []string) bool {
+	var auds []string
+	switch aud := aud.(type) {
+	case string:
+		auds = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+	for _, a := range auds {
+		for _, want := range audiences {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second))), true
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// verifySignature verifies the signature of the signing input with the key by the algorithm.
+// Algorithms other than those of RSA and ECDSA, such as none and HS256, are rejected.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	hashes := map[string]crypto.Hash{
+		"256": crypto.SHA256,
+		"384": crypto.SHA384,
+		"512": crypto.SHA512,
+	}
+	if len(alg) != 5 {
+		return errors.Errorf("unsupported algorithm %q", alg)
+	}
+	hash, ok := hashes[alg[2:]]
+	if !ok {
+		return errors.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.Errorf("the key is not for %s", alg)
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.Errorf("the key is not for %s", alg)
+		}
+		// the curve of each algorithm is fixed, such as P-256 of ES256
+		bits := k.Curve.Params().BitSize
+		if bits != hash.Size()*8 && !(bits == 521 && hash == crypto.SHA512) {
+			return errors.Errorf("the key is not for %s", alg)
+		}
+		size := (bits + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errors.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+// sign creates a token of the claims signed by the key with the algorithm
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	signed := b64(header) + "." + b64(payload)
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	hash := hashes[alg[2:]]
+	var sig []byte
+	switch alg[:2] {
+	case "RS", "PS":
+		h := hash.New()
+		h.Write([]byte(signed))
+		if alg[0] == 'R' {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, h.Sum(nil))
+		} else {
+			sig, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, h.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case "ES":
+		k := key.(*ecdsa.PrivateKey)
+		h := hash.New()
+		h.Write([]byte(signed))
+		r, s, serr := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		err = serr
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		copy(sig[size-len(r.Bytes()):size], r.Bytes())
+		copy(sig[2*size-len(s.Bytes()):], s.Bytes())
+	case "HS":
+		m := hmac.New(sha256.New, key.([]byte))
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case "no":
+	}
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return signed + "." + b64(sig)
+}
+
+func newTestVerifier(t *testing.T, keys []byte, now time.Time, rules []*Rule) *Verifier {
+	s := NewKeySet(&fakeKeySource{keys: keys}, time.Minute)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err.Error())
+	}
+	v, err := NewVerifier(s, &config.JWT{
+		Issuer:    "https://issuer.example.com",
+		Audiences: []string{"grpc-http-proxy", "proxy.example.com"},
+		Leeway:    time.Minute,
+	}, rules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey := newECKey(t, elliptic.P256())
+	ec384Key := newECKey(t, elliptic.P384())
+	otherKey := newRSAKey(t)
+	restricted := jwk("restricted", rsaKey)
+	restricted["alg"] = "PS256"
+	now := time.Unix(1500000000, 0)
+	v := newTestVerifier(t, keySet(t, jwk("rsa", rsaKey), jwk("ec", ecKey), jwk("ec384", ec384Key), restricted), now, nil)
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://issuer.example.com",
+			"aud": "grpc-http-proxy",
+			"sub": "frontend",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	cases := []struct {
+		name       string
+		token      string
+		errorIsNil bool
+	}{
+		{
+			name:       "RS256",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(nil)),
+			errorIsNil: true,
+		},
+		{
+			name:       "PS384",
+			token:      sign(t, "PS384", "rsa", rsaKey, claims(nil)),
+			errorIsNil: true,
+		},
+		{
+			name:       "ES256",
+			token:      sign(t, "ES256", "ec", ecKey, claims(nil)),
+			errorIsNil: true,
+		},
+		{
+			name:       "ES384",
+			token:      sign(t, "ES384", "ec384", ec384Key, claims(nil)),
+			errorIsNil: true,
+		},
+		{
+			name:       "audience in a list",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": []string{"other", "proxy.example.com"}})),
+			errorIsNil: true,
+		},
+		{
+			name:       "expired within the leeway",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})),
+			errorIsNil: true,
+		},
+		{
+			name:       "expired",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+			errorIsNil: false,
+		},
+		{
+			name:       "no expiry",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})),
+			errorIsNil: false,
+		},
+		{
+			name:       "not valid yet",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})),
+			errorIsNil: false,
+		},
+		{
+			name:       "other issuer",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://other.example.com"})),
+			errorIsNil: false,
+		},
+		{
+			name:       "other audience",
+			token:      sign(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": []string{"other"}})),
+			errorIsNil: false,
+		},
+		{
+			name:       "signed by another key",
+			token:      sign(t, "RS256", "rsa", otherKey, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "unknown key",
+			token:      sign(t, "RS256", "unknown", rsaKey, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "algorithm of another key type",
+			token:      sign(t, "ES256", "rsa", ecKey, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "algorithm of another curve",
+			token:      sign(t, "ES256", "ec384", ec384Key, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "algorithm not allowed for the key",
+			token:      sign(t, "RS256", "restricted", rsaKey, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "HS256",
+			token:      sign(t, "HS256", "rsa", rsaKey.PublicKey.N.Bytes(), claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "none",
+			token:      sign(t, "none", "rsa", nil, claims(nil)),
+			errorIsNil: false,
+		},
+		{
+			name:       "malformed",
+			token:      "header.payload",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.Verify(tc.token)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+		})
+	}
+
+	t.Run("tampered claims", func(t *testing.T) {
+		token := sign(t, "RS256", "rsa", rsaKey, claims(nil))
+		forged := sign(t, "RS256", "rsa", otherKey, claims(map[string]interface{}{"sub": "admin"}))
+		parts := strings.Split(token, ".")
+		if _, err := v.Verify(parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]); err == nil {
+			t.Error("got no error for the tampered claims")
+		}
+	})
+}
+
+func TestVerifier_Authenticate(t *testing.T) {
+	key := newECKey(t, elliptic.P256())
+	now := time.Unix(1500000000, 0)
+	rules, err := ParseRules([]byte(`
+- claims:
+    groups: "payment-*"
+  services: ["mercari.payment.*"]
+  methods: ["Get*"]
+- claims:
+    groups: admin
+    email_verified: "true"
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	token := func(sub string, groups []string, verified bool) string {
+		return sign(t, "ES256", "ec", key, map[string]interface{}{
+			"iss":            "https://issuer.example.com",
+			"aud":            "grpc-http-proxy",
+			"sub":            sub,
+			"exp":            now.Add(time.Hour).Unix(),
+			"groups":         groups,
+			"email_verified": verified,
+		})
+	}
+	cases := []struct {
+		name       string
+		rules      []*Rule
+		token      string
+		want       *Identity
+		errorIsNil bool
+	}{
+		{
+			name:  "first matching rule",
+			rules: rules,
+			token: token("payment-api", []string{"staff", "payment-admin"}, true),
+			want: &Identity{
+				Name:     "payment-api",
+				Services: []string{"mercari.payment.*"},
+				Methods:  []string{"Get*"},
+			},
+			errorIsNil: true,
+		},
+		{
+			name:       "all claims of a rule",
+			rules:      rules,
+			token:      token("alice", []string{"admin"}, true),
+			want:       &Identity{Name: "alice"},
+			errorIsNil: true,
+		},
+		{
+			name:       "no matching rule",
+			rules:      rules,
+			token:      token("bob", []string{"admin"}, false),
+			want:       &Identity{Name: "bob", Services: []string{}},
+			errorIsNil: true,
+		},
+		{
+			name:       "no rules",
+			rules:      nil,
+			token:      token("bob", nil, false),
+			want:       &Identity{Name: "bob"},
+			errorIsNil: true,
+		},
+		{
+			name:       "no subject",
+			rules:      nil,
+			token:      token("", nil, false),
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newTestVerifier(t, keySet(t, jwk("ec", key)), now, tc.rules)
+			id, err := v.Authenticate(context.Background(), tc.token)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(id, tc.want) {
+				t.Errorf("got %+v, want %+v", id, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	s := NewKeySet(&fakeKeySource{}, time.Minute)
+	if _, err := NewVerifier(s, &config.JWT{Audiences: []string{"proxy"}}, nil); err == nil {
+		t.Error("got no error without the issuer")
+	}
+	if _, err := NewVerifier(s, &config.JWT{Issuer: "https://issuer.example.com"}, nil); err == nil {
+		t.Error("got no error without the audiences")
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// Claims are the claims of a token, such as those of a JSON Web Token and the user information of a TokenReview.
+// Numbers are json.Number.
+type Claims map[string]interface{}
+
+// Rule grants the allow-lists to the tokens whose claims match
+type Rule struct {
+	// Claims are the patterns of path.Match which the claims of tokens must match, such as {"groups": "payment-*"}.
+	// A claim which is a list matches if any of its values matches.
+	Claims   map[string]string `json:"claims"`
+	Services []string          `json:"services,omitempty"`
+	Methods  []string          `json:"methods,omitempty"`
+	Versions []string          `json:"versions,omitempty"`
+}
+
+// ParseRules parses a YAML or JSON list of rules
+func ParseRules(b []byte) ([]*Rule, error) {
+	var rules []*Rule
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rules")
+	}
+	for i, r := range rules {
+		if r == nil {
+			return nil, errors.Errorf("rule %d is empty", i)
+		}
+		id := r.identity(fmt.Sprintf("rule %d", i))
+		if err := id.validate(); err != nil {
+			return nil, err
+		}
+		for _, p := range r.Claims {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, &patternError{name: id.Name, pattern: p}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// applyRules returns the identity of the name with the allow-lists of the first rule which the claims match.
+// The identity is allowed to make any call if there are no rules, and no calls if none matches.
+func applyRules(rules []*Rule, name string, c Claims) *Identity {
+	if len(rules) == 0 {
+		return &Identity{Name: name}
+	}
+	for _, r := range rules {
+		if r.matches(c) {
+			return r.identity(name)
+		}
+	}
+	return &Identity{Name: name, Services: []string{}}
+}
+
+func (r *Rule) identity(name string) *Identity {
+	return &Identity{
+		Name:     name,
+		Services: r.Services,
+		Methods:  r.Methods,
+		Versions: r.Versions,
+	}
+}
+
+func (r *Rule) matches(c Claims) bool {
+	for name, pattern := range r.Claims {
+		if !claimMatches(c[name], pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+func claimMatches(v interface{}, pattern string) bool {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case bool:
+		s = strconv.FormatBool(v)
+	case []interface{}:
+		for _, e := range v {
+			if claimMatches(e, pattern) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
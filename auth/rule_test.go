@@ -0,0 +1,40 @@
+package auth
+
+import "testing"
+
+func TestParseRules(t *testing.T) {
+	cases := []struct {
+		name       string
+		input      string
+		errorIsNil bool
+	}{
+		{
+			name:       "valid",
+			input:      `[{"claims":{"groups":"admin"},"services":["my.*"]}]`,
+			errorIsNil: true,
+		},
+		{
+			name:       "malformed service pattern",
+			input:      `[{"claims":{"groups":"admin"},"services":["my.[package"]}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "malformed claim pattern",
+			input:      `[{"claims":{"groups":"[admin"}}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "empty rule",
+			input:      `[null]`,
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tc.input))
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Token is an access token of an identity
+type Token struct {
+	Identity
+	// Token is the secret value of the token, which callers send in the X-Access-Token header
+	Token string `json:"token"`
+}
+
+// ParseTokens parses a YAML or JSON list of tokens, each of which has its name, value and allow-lists.
+// Each token must have a unique name and a unique value.
+// An empty list is an error, since a store without tokens lets requests without tokens in.
+func ParseTokens(b []byte) ([]*Token, error) {
+	var tokens []*Token
+	if err := yaml.Unmarshal(b, &tokens); err != nil {
+		return nil, errors.Wrap(err, "failed to parse tokens")
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no tokens are configured")
+	}
+	names := make(map[string]struct{}, len(tokens))
+	values := make(map[string]struct{}, len(tokens))
+	for i, t := range tokens {
+		if t == nil || t.Name == "" || t.Token == "" {
+			return nil, errors.Errorf("token %d must have its name and value", i)
+		}
+		if _, ok := names[t.Name]; ok {
+			return nil, errors.Errorf("multiple tokens are named %s", t.Name)
+		}
+		names[t.Name] = struct{}{}
+		if _, ok := values[t.Token]; ok {
+			return nil, errors.Errorf("token %s has the same value as another token", t.Name)
+		}
+		values[t.Token] = struct{}{}
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// Store holds the access tokens, which can be replaced while requests are authenticated with them
+type Store struct {
+	mu     sync.RWMutex
+	tokens []*storedToken
+}
+
+type storedToken struct {
+	identity *Identity
+	digest   [sha256.Size]byte
+}
+
+// NewStore creates a Store of the tokens
+func NewStore(tokens ...*Token) *Store {
+	s := &Store{}
+	s.Set(tokens)
+	return s
+}
+
+// Set replaces the tokens in the store
+func (s *Store) Set(tokens []*Token) {
+	stored := make([]*storedToken, 0, len(tokens))
+	for _, t := range tokens {
+		id := t.Identity
+		stored = append(stored, &storedToken{
+			identity: &id,
+			digest:   sha256.Sum256([]byte(t.Token)),
+		})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = stored
+}
+
+// Len returns the number of tokens in the store
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokens)
+}
+
+// Authenticate returns the identity of the token whose value is provided.
+// The value is compared with every token in constant time, so that the time taken doesn't tell how much of it matched.
+func (s *Store) Authenticate(provided string) (*Identity, bool) {
+	digest := sha256.Sum256([]byte(provided))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched *Identity
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(digest[:], t.digest[:]) == 1 {
+			matched = t.identity
+		}
+	}
+	return matched, matched != nil
+}
+
+// Source loads the tokens from where they are stored
+type Source interface {
+	Load() ([]*Token, error)
+}
+
+// FileSource loads the tokens from the file, such as a Secret mounted as a volume
+type FileSource string
+
+// Load reads and parses the file
+func (f FileSource) Load() ([]*Token, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tokens")
+	}
+	return ParseTokens(b)
+}
+
+// SecretSource loads the tokens from the key of a Kubernetes Secret
+type SecretSource struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// Load gets the Secret, and parses the value of the key
+func (s *SecretSource) Load() ([]*Token, error) {
+	secret, err := s.Client.CoreV1().Secrets(s.Namespace).Get(s.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s/%s", s.Namespace, s.Name)
+	}
+	b, ok := secret.Data[s.Key]
+	if !ok {
+		return nil, errors.Errorf("secret %s/%s has no key %s", s.Namespace, s.Name, s.Key)
+	}
+	return ParseTokens(b)
+}
+
+// Reload loads the tokens from the source into the store.
+// The tokens in the store are kept if loading fails, or if the source has no tokens.
+func (s *Store) Reload(src Source) error {
+	tokens, err := src.Load()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errors.New("no tokens are loaded")
+	}
+	s.Set(tokens)
+	return nil
+}
+
+// RunReloader reloads the tokens from the source at the interval until stopCh is closed.
+// Errors in reloading are passed to onError.
+func (s *Store) RunReloader(src Source, interval time.Duration, stopCh <-chan struct{}, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := s.Reload(src); err != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
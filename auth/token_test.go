@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testTokens = `
+- name: frontend
+  token: secret
+  services: ["my.package.*"]
+  methods: ["Get*"]
+  versions: ["", "v1"]
+- name: admin
+  token: root
+`
+
+func TestParseTokens(t *testing.T) {
+	cases := []struct {
+		name       string
+		input      string
+		want       []*Token
+		errorIsNil bool
+	}{
+		{
+			name:  "yaml",
+			input: testTokens,
+			want: []*Token{
+				{
+					Identity: Identity{
+						Name:     "frontend",
+						Services: []string{"my.package.*"},
+						Methods:  []string{"Get*"},
+						Versions: []string{"", "v1"},
+					},
+					Token: "secret",
+				},
+				{
+					Identity: Identity{Name: "admin"},
+					Token:    "root",
+				},
+			},
+			errorIsNil: true,
+		},
+		{
+			name:  "json",
+			input: `[{"name":"admin","token":"root"}]`,
+			want: []*Token{
+				{
+					Identity: Identity{Name: "admin"},
+					Token:    "root",
+				},
+			},
+			errorIsNil: true,
+		},
+		{
+			name:       "no name",
+			input:      `[{"token":"root"}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "no value",
+			input:      `[{"name":"admin"}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "duplicate names",
+			input:      `[{"name":"admin","token":"a"},{"name":"admin","token":"b"}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "duplicate values",
+			input:      `[{"name":"a","token":"root"},{"name":"b","token":"root"}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "malformed pattern",
+			input:      `[{"name":"admin","token":"root","services":["my.[package"]}]`,
+			errorIsNil: false,
+		},
+		{
+			name:       "empty",
+			input:      "",
+			errorIsNil: false,
+		},
+		{
+			name:       "empty list",
+			input:      "[]",
+			errorIsNil: false,
+		},
+		{
+			name:       "not a list",
+			input:      `name: admin`,
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseTokens([]byte(tc.input))
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStore_Authenticate(t *testing.T) {
+	tokens, err := ParseTokens([]byte(testTokens))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s := NewStore(tokens...)
+	cases := []struct {
+		provided string
+		name     string
+		ok       bool
+	}{
+		{provided: "secret", name: "frontend", ok: true},
+		{provided: "root", name: "admin", ok: true},
+		{provided: "secre", ok: false},
+		{provided: "", ok: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.provided, func(t *testing.T) {
+			id, ok := s.Authenticate(tc.provided)
+			if got, want := ok, tc.ok; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+			if ok && id.Name != tc.name {
+				t.Errorf("got %s, want %s", id.Name, tc.name)
+			}
+		})
+	}
+
+	s.Set(nil)
+	if _, ok := s.Authenticate("secret"); ok {
+		t.Error("got a token which was removed from the store")
+	}
+}
+
+type fakeSource struct {
+	tokens []*Token
+	err    error
+}
+
+func (s *fakeSource) Load() ([]*Token, error) {
+	return s.tokens, s.err
+}
+
+func TestStore_Reload(t *testing.T) {
+	s := NewStore(&Token{Identity: Identity{Name: "admin"}, Token: "root"})
+	if err := s.Reload(&fakeSource{err: errors.New("unavailable")}); err == nil {
+		t.Fatal("got no error, want the error of the source")
+	}
+	if _, ok := s.Authenticate("root"); !ok {
+		t.Fatal("the tokens were not kept after the source failed")
+	}
+	if err := s.Reload(&fakeSource{tokens: []*Token{}}); err == nil {
+		t.Fatal("got no error, want an error for a source without tokens")
+	}
+	if _, ok := s.Authenticate("root"); !ok {
+		t.Fatal("the tokens were not kept after the source had no tokens")
+	}
+	if err := s.Reload(&fakeSource{tokens: []*Token{{Identity: Identity{Name: "new"}, Token: "new"}}}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := s.Authenticate("root"); ok {
+		t.Error("got the token which was replaced")
+	}
+	if got, want := s.Len(), 1; got != want {
+		t.Errorf("got %d tokens, want %d", got, want)
+	}
+}
+
+func TestFileSource_Load(t *testing.T) {
+	f, err := ioutil.TempFile("", "tokens")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testTokens); err != nil {
+		t.Fatal(err.Error())
+	}
+	f.Close()
+
+	tokens, err := FileSource(f.Name()).Load()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := len(tokens), 2; got != want {
+		t.Errorf("got %d tokens, want %d", got, want)
+	}
+	if _, err := FileSource(f.Name() + ".missing").Load(); !os.IsNotExist(errors.Cause(err)) {
+		t.Errorf("got %v, want an error caused by the missing file", err)
+	}
+}
+
+func TestSecretSource_Load(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "proxy", Name: "tokens"},
+		Data:       map[string][]byte{"tokens.yaml": []byte(testTokens)},
+	})
+	cases := []struct {
+		name       string
+		secret     string
+		key        string
+		errorIsNil bool
+	}{
+		{
+			name:       "found",
+			secret:     "tokens",
+			key:        "tokens.yaml",
+			errorIsNil: true,
+		},
+		{
+			name:       "no secret",
+			secret:     "missing",
+			key:        "tokens.yaml",
+			errorIsNil: false,
+		},
+		{
+			name:       "no key",
+			secret:     "tokens",
+			key:        "tokens.json",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &SecretSource{
+				Client:    client,
+				Namespace: "proxy",
+				Name:      tc.secret,
+				Key:       tc.key,
+			}
+			tokens, err := src.Load()
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err == nil && len(tokens) != 2 {
+				t.Errorf("got %d tokens, want 2", len(tokens))
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+// maxReviews is the maximum number of the results of reviews in a cache
+const maxReviews = 10000
+
+// reviewCache caches the results of reviews for its ttl
+type reviewCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]reviewEntry
+}
+
+type reviewEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newReviewCache(ttl time.Duration) *reviewCache {
+	return &reviewCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]reviewEntry),
+	}
+}
+
+func (c *reviewCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !c.now().Before(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// put caches the value, unless caching is disabled or the cache is full of results which have not expired
+func (c *reviewCache) put(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= maxReviews {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxReviews {
+			return
+		}
+	}
+	c.entries[key] = reviewEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// TokenReviewer authenticates bearer tokens with the TokenReview API of Kubernetes, such as the projected tokens of ServiceAccounts.
+// The user of a token is given the allow-lists of the rules, whose claims are "username", "uid" and "groups" of the user,
+// and "namespace" and "serviceaccount" for ServiceAccounts.
+type TokenReviewer struct {
+	client    kubernetes.Interface
+	audiences []string
+	rules     []*Rule
+	access    *accessReviewer
+	cache     *reviewCache
+}
+
+// NewTokenReviewer creates a TokenReviewer of the configuration, which requires the audiences of the proxy.
+// Calls are also authorized with SubjectAccessReviews if the API group of their virtual resources is configured.
+func NewTokenReviewer(client kubernetes.Interface, c *config.TokenReview, rules []*Rule) (*TokenReviewer, error) {
+	if len(c.Audiences) == 0 {
+		return nil, errors.New("the audiences of tokens are required")
+	}
+	r := &TokenReviewer{
+		client:    client,
+		audiences: c.Audiences,
+		rules:     rules,
+		cache:     newReviewCache(c.CacheTTL),
+	}
+	if c.AccessReviewGroup != "" {
+		r.access = &accessReviewer{
+			client: client,
+			group:  c.AccessReviewGroup,
+			cache:  newReviewCache(c.CacheTTL),
+		}
+	}
+	return r, nil
+}
+
+// Authenticate reviews the token, and returns the identity of its user.
+// The token must be a projected token of one of the audiences of the proxy.
+// Results are cached by the digest of the token, except for errors in calling the API.
+func (r *TokenReviewer) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if err := r.checkAudience(token); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(token))
+	key := string(digest[:])
+	var status authenticationv1.TokenReviewStatus
+	if v, ok := r.cache.get(key); ok {
+		status = v.(authenticationv1.TokenReviewStatus)
+	} else {
+		review, err := r.client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to review the token")
+		}
+		status = review.Status
+		r.cache.put(key, status)
+	}
+	if !status.Authenticated {
+		if status.Error != "" {
+			return nil, errors.Errorf("the token is not authenticated: %s", status.Error)
+		}
+		return nil, errors.New("the token is not authenticated")
+	}
+	if status.User.Username == "" {
+		return nil, errors.New("the token has no user")
+	}
+	id := applyRules(r.rules, status.User.Username, userClaims(status.User))
+	if r.access != nil {
+		id.Authorizer = &userAccess{reviewer: r.access, user: status.User}
+	}
+	return id, nil
+}
+
+// checkAudience checks the "aud" claim of the token, since the TokenReview API of the client can't check it.
+// The claims are trusted only after the TokenReview authenticates the token.
+func (r *TokenReviewer) checkAudience(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("the token is not a JSON Web Token")
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return errors.Wrap(err, "malformed claims")
+	}
+	if !hasAudience(claims["aud"], r.audiences) {
+		return errors.New("the token is not for the audiences of the proxy")
+	}
+	return nil
+}
+
+// serviceAccountPrefix is the prefix of the usernames of ServiceAccounts, which are followed by "<namespace>:<name>"
+const serviceAccountPrefix = "system:serviceaccount:"
+
+func userClaims(u authenticationv1.UserInfo) Claims {
+	groups := make([]interface{}, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		groups = append(groups, g)
+	}
+	c := Claims{
+		"username": u.Username,
+		"uid":      u.UID,
+		"groups":   groups,
+	}
+	if strings.HasPrefix(u.Username, serviceAccountPrefix) {
+		parts := strings.Split(strings.TrimPrefix(u.Username, serviceAccountPrefix), ":")
+		if len(parts) == 2 {
+			c["namespace"] = parts[0]
+			c["serviceaccount"] = parts[1]
+		}
+	}
+	return c
+}
+
+// accessReviewer authorizes calls with SubjectAccessReviews of virtual resources.
+// The resource of a call is the gRPC service in the group, and its name is the method.
+// The verb is "call" for calls, and "get" for requests which are not calls, such as those for the documents of a service.
+type accessReviewer struct {
+	client kubernetes.Interface
+	group  string
+	cache  *reviewCache
+}
+
+// userAccess authorizes the calls of a user
+type userAccess struct {
+	reviewer *accessReviewer
+	user     authenticationv1.UserInfo
+}
+
+// Authorize reviews the access of the user to the method of the service.
+// Calls are denied if the review fails. The version of the service is not reviewed.
+func (a *userAccess) Authorize(service, method, version string) bool {
+	attrs := &authorizationv1.ResourceAttributes{
+		Verb:     "get",
+		Group:    a.reviewer.group,
+		Resource: service,
+	}
+	if method != "" {
+		attrs.Verb = "call"
+		attrs.Name = method
+	}
+	key := strings.Join([]string{
+		a.user.Username,
+		a.user.UID,
+		strings.Join(a.user.Groups, ","),
+		attrs.Verb,
+		service,
+		method,
+	}, "\x00")
+	if v, ok := a.reviewer.cache.get(key); ok {
+		return v.(bool)
+	}
+	extra := make(map[string]authorizationv1.ExtraValue, len(a.user.Extra))
+	for k, v := range a.user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.reviewer.client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attrs,
+			User:               a.user.Username,
+			UID:                a.user.UID,
+			Groups:             a.user.Groups,
+			Extra:              extra,
+		},
+	})
+	if err != nil {
+		return false
+	}
+	a.reviewer.cache.put(key, review.Status.Allowed)
+	return review.Status.Allowed
+}
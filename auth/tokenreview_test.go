@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+// projectedToken returns a token whose subject is the key of its user in newReviewClient
+func projectedToken(t *testing.T, sub string, aud ...string) string {
+	return sign(t, "none", "", nil, map[string]interface{}{"sub": sub, "aud": aud})
+}
+
+// newReviewClient creates a clientset which authenticates the users of the subjects of the tokens,
+// and allows the calls of "<user>/<verb>/<service>/<method>" in allowed
+func newReviewClient(users map[string]authenticationv1.UserInfo, allowed map[string]bool) (*fake.Clientset, *int, *int) {
+	client := fake.NewSimpleClientset()
+	var tokenReviews, accessReviews int
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		var claims Claims
+		if err := decodeSegment(strings.Split(review.Spec.Token, ".")[1], &claims); err != nil {
+			return true, &authenticationv1.TokenReview{}, err
+		}
+		if claims["sub"] == "unavailable" {
+			return true, &authenticationv1.TokenReview{}, errors.New("unavailable")
+		}
+		user, ok := users[claims["sub"].(string)]
+		review.Status = authenticationv1.TokenReviewStatus{Authenticated: ok, User: user}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		accessReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		if attrs.Group != "grpc-http-proxy.mercari.com" {
+			return true, &authorizationv1.SubjectAccessReview{}, errors.New("unknown group")
+		}
+		review.Status.Allowed = allowed[review.Spec.User+"/"+attrs.Verb+"/"+attrs.Resource+"/"+attrs.Name]
+		return true, review, nil
+	})
+	return client, &tokenReviews, &accessReviews
+}
+
+func newTestTokenReviewer(t *testing.T, client *fake.Clientset, c *config.TokenReview, rules []*Rule) *TokenReviewer {
+	c.Audiences = []string{"grpc-http-proxy", "proxy.example.com"}
+	r, err := NewTokenReviewer(client, c, rules)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return r
+}
+
+func TestTokenReviewer_Authenticate(t *testing.T) {
+	users := map[string]authenticationv1.UserInfo{
+		"payment": {
+			Username: "system:serviceaccount:payment:api",
+			Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:payment"},
+		},
+		"batch": {
+			Username: "system:serviceaccount:batch:job",
+			Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:batch"},
+		},
+		"alice": {
+			Username: "alice",
+			Groups:   []string{"developers"},
+		},
+	}
+	rules, err := ParseRules([]byte(`
+- claims:
+    namespace: payment
+  services: ["mercari.payment.*"]
+- claims:
+    groups: developers
+  methods: ["Get*"]
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cases := []struct {
+		name       string
+		token      string
+		want       *Identity
+		errorIsNil bool
+	}{
+		{
+			name:  "serviceaccount",
+			token: "payment",
+			want: &Identity{
+				Name:     "system:serviceaccount:payment:api",
+				Services: []string{"mercari.payment.*"},
+			},
+			errorIsNil: true,
+		},
+		{
+			name:  "group",
+			token: "alice",
+			want: &Identity{
+				Name:    "alice",
+				Methods: []string{"Get*"},
+			},
+			errorIsNil: true,
+		},
+		{
+			name:       "no matching rule",
+			token:      "batch",
+			want:       &Identity{Name: "system:serviceaccount:batch:job", Services: []string{}},
+			errorIsNil: true,
+		},
+		{
+			name:       "not authenticated",
+			token:      "unknown",
+			errorIsNil: false,
+		},
+		{
+			name:       "API error",
+			token:      "unavailable",
+			errorIsNil: false,
+		},
+	}
+	client, _, _ := newReviewClient(users, nil)
+	r := newTestTokenReviewer(t, client, &config.TokenReview{CacheTTL: time.Minute}, rules)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := r.Authenticate(context.Background(), projectedToken(t, tc.token, "grpc-http-proxy"))
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(id, tc.want) {
+				t.Errorf("got %+v, want %+v", id, tc.want)
+			}
+		})
+	}
+}
+
+func TestTokenReviewer_AuthenticateCache(t *testing.T) {
+	users := map[string]authenticationv1.UserInfo{
+		"alice": {Username: "alice"},
+	}
+	client, tokenReviews, _ := newReviewClient(users, nil)
+	r := newTestTokenReviewer(t, client, &config.TokenReview{CacheTTL: time.Minute}, nil)
+	now := time.Unix(1000, 0)
+	r.cache.now = func() time.Time { return now }
+
+	for _, sub := range []string{"alice", "alice", "unknown", "unknown", "unavailable", "unavailable"} {
+		r.Authenticate(context.Background(), projectedToken(t, sub, "grpc-http-proxy"))
+	}
+	// errors in calling the API are not cached
+	if got, want := *tokenReviews, 4; got != want {
+		t.Fatalf("got %d reviews, want %d", got, want)
+	}
+	now = now.Add(time.Minute)
+	if _, err := r.Authenticate(context.Background(), projectedToken(t, "alice", "grpc-http-proxy")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := *tokenReviews, 5; got != want {
+		t.Errorf("got %d reviews, want %d after the result expired", got, want)
+	}
+}
+
+func TestTokenReviewer_AccessReview(t *testing.T) {
+	users := map[string]authenticationv1.UserInfo{
+		"payment": {Username: "system:serviceaccount:payment:api"},
+	}
+	allowed := map[string]bool{
+		"system:serviceaccount:payment:api/call/mercari.payment.Payment/GetPayment": true,
+		"system:serviceaccount:payment:api/get/mercari.payment.Payment/":            true,
+	}
+	client, _, accessReviews := newReviewClient(users, allowed)
+	r := newTestTokenReviewer(t, client, &config.TokenReview{
+		CacheTTL:          time.Minute,
+		AccessReviewGroup: "grpc-http-proxy.mercari.com",
+	}, nil)
+	id, err := r.Authenticate(context.Background(), projectedToken(t, "payment", "grpc-http-proxy"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cases := []struct {
+		service string
+		method  string
+		allowed bool
+	}{
+		{service: "mercari.payment.Payment", method: "GetPayment", allowed: true},
+		{service: "mercari.payment.Payment", method: "", allowed: true},
+		{service: "mercari.payment.Payment", method: "Refund", allowed: false},
+		{service: "mercari.item.Item", method: "GetItem", allowed: false},
+		{service: "mercari.payment.Payment", method: "GetPayment", allowed: true},
+	}
+	for _, tc := range cases {
+		if got, want := id.Allows(tc.service, tc.method, ""), tc.allowed; got != want {
+			t.Errorf("%s/%s: got %t, want %t", tc.service, tc.method, got, want)
+		}
+	}
+	if got, want := *accessReviews, 4; got != want {
+		t.Errorf("got %d reviews, want %d", got, want)
+	}
+}
+
+func TestTokenReviewer_AuthenticateAudience(t *testing.T) {
+	users := map[string]authenticationv1.UserInfo{
+		"alice": {Username: "alice"},
+	}
+	client, tokenReviews, _ := newReviewClient(users, nil)
+	r := newTestTokenReviewer(t, client, &config.TokenReview{CacheTTL: time.Minute}, nil)
+	cases := []struct {
+		name       string
+		token      string
+		errorIsNil bool
+	}{
+		{
+			name:       "audience of the proxy",
+			token:      projectedToken(t, "alice", "other", "proxy.example.com"),
+			errorIsNil: true,
+		},
+		{
+			name:       "audience of kube-apiserver",
+			token:      projectedToken(t, "alice", "https://kubernetes.default.svc"),
+			errorIsNil: false,
+		},
+		{
+			name:       "no audience",
+			token:      projectedToken(t, "alice"),
+			errorIsNil: false,
+		},
+		{
+			name:       "not a JSON Web Token",
+			token:      "opaque",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := r.Authenticate(context.Background(), tc.token)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+		})
+	}
+	// tokens of other audiences are rejected without reviews
+	if got, want := *tokenReviews, 1; got != want {
+		t.Errorf("got %d reviews, want %d", got, want)
+	}
+
+	if _, err := NewTokenReviewer(client, &config.TokenReview{}, nil); err == nil {
+		t.Error("got no error without the audiences")
+	}
+}
@@ -0,0 +1,226 @@
+package breaker
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// State is the state of a circuit
+type State int
+
+const (
+	// Closed is the state in which calls are allowed
+	Closed State = iota
+	// Open is the state in which calls fail fast
+	Open
+	// HalfOpen is the state in which a single trial call is allowed to decide whether to close the circuit
+	HalfOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breakers holds a circuit breaker for each upstream
+type Breakers struct {
+	config *config.Breaker
+	m      map[string]*circuit
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// New creates circuit breakers with the configuration
+func New(c *config.Breaker) *Breakers {
+	return &Breakers{
+		config: c,
+		m:      make(map[string]*circuit),
+		now:    time.Now,
+	}
+}
+
+// Allow checks if a call to the upstream is allowed.
+// A ProxyError is returned if the circuit is open.
+// Each allowed call must be followed by Record or Release.
+func (b *Breakers) Allow(u *url.URL) error {
+	c := b.circuit(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.allow(b.now(), b.config, true) {
+		return &perrors.ProxyError{
+			Code:    perrors.CircuitOpen,
+			Message: fmt.Sprintf("circuit breaker for %s is open", u.String()),
+		}
+	}
+	return nil
+}
+
+// Record records the result of a call to the upstream
+func (b *Breakers) Record(u *url.URL, err error) {
+	c := b.circuit(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record(b.now(), b.config, !IsFailure(err))
+}
+
+// Release ends a call to the upstream without recording its result, for calls whose results don't tell the health of the upstream.
+// The trial call of a half-open circuit is given back, so that another call can be the trial.
+func (b *Breakers) Release(u *url.URL) {
+	c := b.circuit(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == HalfOpen {
+		c.trialInFlight = false
+	}
+}
+
+// Ejected checks if calls to the upstream would currently be rejected
+func (b *Breakers) Ejected(u *url.URL) bool {
+	c := b.circuit(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.allow(b.now(), b.config, false)
+}
+
+// State returns the state of the circuit for the upstream
+func (b *Breakers) State(u *url.URL) State {
+	c := b.circuit(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allow(b.now(), b.config, false)
+	return c.state
+}
+
+func (b *Breakers) circuit(u *url.URL) *circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.m[u.String()]
+	if !ok {
+		c = &circuit{}
+		b.m[u.String()] = c
+	}
+	return c
+}
+
+// IsFailure checks if the error of a call indicates that the upstream is unhealthy.
+// Errors caused by the caller, such as invalid arguments, are not failures.
+// Deadlines requested by callers must not be recorded, since they would let callers open circuits with tiny deadlines.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch e := errors.Cause(err).(type) {
+	case *perrors.ProxyError:
+		return e.Code == perrors.UpstreamConnFailure || e.Code == perrors.DeadlineExceeded
+	case *perrors.GRPCError:
+		switch codes.Code(e.StatusCode) {
+		case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss:
+			return true
+		}
+	}
+	return false
+}
+
+// circuit is the circuit breaker for a single upstream
+type circuit struct {
+	state               State
+	consecutiveFailures int
+	requests            int
+	failures            int
+	windowStart         time.Time
+	openedAt            time.Time
+	trialInFlight       bool
+	mu                  sync.Mutex
+}
+
+// allow checks if a call is allowed, and moves an open circuit to half-open once the open duration has passed.
+// If take is true, the trial call of a half-open circuit is taken.
+func (c *circuit) allow(now time.Time, conf *config.Breaker, take bool) bool {
+	switch c.state {
+	case Open:
+		if now.Sub(c.openedAt) < conf.OpenDuration {
+			return false
+		}
+		c.state = HalfOpen
+		c.trialInFlight = false
+		fallthrough
+	case HalfOpen:
+		if c.trialInFlight {
+			return false
+		}
+		if take {
+			c.trialInFlight = true
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+func (c *circuit) record(now time.Time, conf *config.Breaker, success bool) {
+	if c.state == HalfOpen {
+		if success {
+			c.close(now)
+		} else {
+			c.open(now)
+		}
+		return
+	}
+	if c.state == Open {
+		return
+	}
+
+	if now.Sub(c.windowStart) >= conf.Window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	c.requests++
+	if success {
+		c.consecutiveFailures = 0
+		return
+	}
+	c.failures++
+	c.consecutiveFailures++
+
+	if conf.ConsecutiveFailures > 0 && c.consecutiveFailures >= conf.ConsecutiveFailures {
+		c.open(now)
+		return
+	}
+	if conf.ErrorRate > 0 && c.requests >= conf.MinRequests &&
+		float64(c.failures)/float64(c.requests) >= conf.ErrorRate {
+		c.open(now)
+	}
+}
+
+func (c *circuit) open(now time.Time) {
+	c.state = Open
+	c.openedAt = now
+	c.trialInFlight = false
+}
+
+func (c *circuit) close(now time.Time) {
+	c.state = Closed
+	c.consecutiveFailures = 0
+	c.requests = 0
+	c.failures = 0
+	c.windowStart = now
+	c.trialInFlight = false
+}
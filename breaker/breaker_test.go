@@ -0,0 +1,244 @@
+package breaker
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+var (
+	unavailable = &perrors.ProxyError{Code: perrors.UpstreamConnFailure}
+	invalid     = &perrors.GRPCError{StatusCode: int(codes.InvalidArgument)}
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newBreakers(t *testing.T, c *config.Breaker) (*Breakers, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := New(c)
+	b.now = clock.now
+	return b, clock
+}
+
+func parseURL(t *testing.T, rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return u
+}
+
+func call(t *testing.T, b *Breakers, u *url.URL, err error) {
+	t.Helper()
+	if aerr := b.Allow(u); aerr != nil {
+		t.Fatalf("call should be allowed, got %s", aerr.Error())
+	}
+	b.Record(u, err)
+}
+
+func TestBreakers_ConsecutiveFailures(t *testing.T) {
+	b, clock := newBreakers(t, &config.Breaker{
+		ConsecutiveFailures: 3,
+		Window:              time.Minute,
+		OpenDuration:        10 * time.Second,
+	})
+	u := parseURL(t, "a:5000")
+	other := parseURL(t, "b:5000")
+
+	call(t, b, u, unavailable)
+	call(t, b, u, unavailable)
+	call(t, b, u, nil)
+	call(t, b, u, unavailable)
+	call(t, b, u, unavailable)
+	if got, want := b.State(u), Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	call(t, b, u, unavailable)
+	if got, want := b.State(u), Open; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if !b.Ejected(u) {
+		t.Fatal("upstream should be ejected")
+	}
+	err := b.Allow(u)
+	perr, ok := err.(*perrors.ProxyError)
+	if !ok {
+		t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+	}
+	if got, want := perr.Code, perrors.CircuitOpen; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	if got, want := b.State(other), Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	clock.t = clock.t.Add(10 * time.Second)
+	if got, want := b.State(u), HalfOpen; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestBreakers_ErrorRate(t *testing.T) {
+	b, clock := newBreakers(t, &config.Breaker{
+		ErrorRate:    0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		OpenDuration: 10 * time.Second,
+	})
+	u := parseURL(t, "a:5000")
+
+	call(t, b, u, unavailable)
+	call(t, b, u, unavailable)
+	call(t, b, u, nil)
+	if got, want := b.State(u), Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	// a new window starts
+	clock.t = clock.t.Add(time.Minute)
+	call(t, b, u, unavailable)
+	call(t, b, u, nil)
+	call(t, b, u, nil)
+	call(t, b, u, nil)
+	if got, want := b.State(u), Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	call(t, b, u, unavailable)
+	call(t, b, u, unavailable)
+	if got, want := b.State(u), Open; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestBreakers_HalfOpen(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   error
+		state State
+	}{
+		{
+			name:  "trial succeeds",
+			err:   nil,
+			state: Closed,
+		},
+		{
+			name:  "trial fails",
+			err:   unavailable,
+			state: Open,
+		},
+		{
+			name:  "trial fails because of the caller",
+			err:   invalid,
+			state: Closed,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, clock := newBreakers(t, &config.Breaker{
+				ConsecutiveFailures: 1,
+				Window:              time.Minute,
+				OpenDuration:        10 * time.Second,
+			})
+			u := parseURL(t, "a:5000")
+			call(t, b, u, unavailable)
+			clock.t = clock.t.Add(10 * time.Second)
+
+			if err := b.Allow(u); err != nil {
+				t.Fatalf("trial call should be allowed, got %s", err.Error())
+			}
+			if err := b.Allow(u); err == nil {
+				t.Fatal("only one trial call should be allowed")
+			}
+			if !b.Ejected(u) {
+				t.Fatal("upstream should be ejected while the trial call is in flight")
+			}
+			b.Record(u, tc.err)
+			if got, want := b.State(u), tc.state; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestBreakers_Release(t *testing.T) {
+	b, clock := newBreakers(t, &config.Breaker{
+		ConsecutiveFailures: 1,
+		Window:              time.Minute,
+		OpenDuration:        10 * time.Second,
+	})
+	u := parseURL(t, "a:5000")
+	call(t, b, u, unavailable)
+	clock.t = clock.t.Add(10 * time.Second)
+
+	if err := b.Allow(u); err != nil {
+		t.Fatalf("trial call should be allowed, got %s", err.Error())
+	}
+	b.Release(u)
+	if got, want := b.State(u), HalfOpen; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if err := b.Allow(u); err != nil {
+		t.Fatalf("another trial call should be allowed after the release, got %s", err.Error())
+	}
+	b.Record(u, nil)
+	if got, want := b.State(u), Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		failure bool
+	}{
+		{
+			name:    "success",
+			err:     nil,
+			failure: false,
+		},
+		{
+			name:    "connection failure",
+			err:     unavailable,
+			failure: true,
+		},
+		{
+			name:    "deadline exceeded",
+			err:     &perrors.ProxyError{Code: perrors.DeadlineExceeded},
+			failure: true,
+		},
+		{
+			name:    "message type mismatch",
+			err:     &perrors.ProxyError{Code: perrors.MessageTypeMismatch},
+			failure: false,
+		},
+		{
+			name:    "internal",
+			err:     &perrors.GRPCError{StatusCode: int(codes.Internal)},
+			failure: true,
+		},
+		{
+			name:    "invalid argument",
+			err:     invalid,
+			failure: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := IsFailure(tc.err), tc.failure; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
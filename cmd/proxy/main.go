@@ -1,15 +1,21 @@
 package main
 
 import (
+	"expvar"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 
 	"go.uber.org/zap"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
+	"github.com/mercari/grpc-http-proxy/auth"
+	"github.com/mercari/grpc-http-proxy/breaker"
 	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
 	"github.com/mercari/grpc-http-proxy/http"
 	"github.com/mercari/grpc-http-proxy/log"
 	"github.com/mercari/grpc-http-proxy/source"
@@ -37,10 +43,81 @@ func main() {
 		fmt.Fprintf(os.Stderr, "[ERROR] Failed to create k8s client: %s\n", err)
 		os.Exit(1)
 	}
+	errorFormatter, err := perrors.NewFormatter(env.ErrorFormat, env.ErrorHTTPStatuses)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] Failed to configure error responses: %s\n", err)
+		os.Exit(1)
+	}
+
 	d := source.NewService(k8sClient, "", logger)
 	stopCh := make(chan struct{})
 	d.Run(stopCh)
-	s := http.New(env.Token, d, logger)
+	tokens, err := tokenSource(env, k8sClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] Failed to configure access tokens: %s\n", err)
+		os.Exit(1)
+	}
+	opts := []http.Option{
+		http.WithTimeouts(env.DefaultTimeout, env.MaxTimeout),
+		http.WithRetry(env.RetryPolicy(), env.RetryBudgetRatio, env.RetryBudgetBurst),
+		http.WithDialConfig(env.DialConfig()),
+		http.WithJSONConfig(env.JSONConfig()),
+		http.WithBatchLimits(env.BatchConfig()),
+		http.WithDescriptorCacheTTL(env.DescriptorCacheTTL),
+		http.WithErrorFormatter(errorFormatter),
+	}
+	if tokens != nil {
+		store := auth.NewStore()
+		if err := store.Reload(tokens); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Failed to load access tokens: %s\n", err)
+			os.Exit(1)
+		}
+		if env.TokensReloadInterval > 0 {
+			store.RunReloader(tokens, env.TokensReloadInterval, stopCh, func(err error) {
+				logger.Error("failed to reload access tokens", zap.String("err", err.Error()))
+			})
+		}
+		opts = append(opts, http.WithTokenStore(store))
+	}
+	var authenticators auth.Authenticators
+	if jc := env.JWTConfig(); jc.Enabled() {
+		verifier, err := newVerifier(jc, stopCh, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Failed to configure bearer tokens: %s\n", err)
+			os.Exit(1)
+		}
+		authenticators = append(authenticators, verifier)
+	}
+	if tc := env.TokenReviewConfig(); tc.Enabled {
+		rules, err := readRules(tc.RulesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Failed to configure TokenReviews: %s\n", err)
+			os.Exit(1)
+		}
+		reviewer, err := auth.NewTokenReviewer(k8sClient, tc, rules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Failed to configure TokenReviews: %s\n", err)
+			os.Exit(1)
+		}
+		authenticators = append(authenticators, reviewer)
+	}
+	if len(authenticators) > 0 {
+		opts = append(opts, http.WithAuthenticator(authenticators))
+	}
+	d.SetBalancing(env.BalanceUpstreams)
+	if bc := env.BreakerConfig(); bc.Enabled() {
+		b := breaker.New(bc)
+		d.SetOutlierDetector(b)
+		opts = append(opts, http.WithCircuitBreaker(b))
+	}
+	opts = append(opts, http.WithConcurrencyLimits(env.ConcurrencyConfig()))
+	s := http.New(env.Token, d, logger, opts...)
+	if env.HTTPRulesRefreshInterval > 0 {
+		s.RunHTTPRuleLoader(env.HTTPRulesRefreshInterval, stopCh)
+	}
+	expvar.Publish("concurrency", expvar.Func(func() interface{} {
+		return s.ConcurrencyStats()
+	}))
 	logger.Info("starting grpc-http-proxy",
 		zap.String("log_level", env.LogLevel),
 		zap.Int16("port", env.Port),
@@ -54,3 +131,57 @@ func main() {
 	}
 	s.Serve(ln)
 }
+
+// tokenSource returns the source of the access tokens, which is nil unless a file or a Secret is configured
+func tokenSource(env *config.Env, client kubernetes.Interface) (auth.Source, error) {
+	if env.TokensFile != "" {
+		return auth.FileSource(env.TokensFile), nil
+	}
+	if env.TokensSecret == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(env.TokensSecret, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("TOKENS_SECRET must be in the form of namespace/name: %s", env.TokensSecret)
+	}
+	return &auth.SecretSource{
+		Client:    client,
+		Namespace: parts[0],
+		Name:      parts[1],
+		Key:       env.TokensSecretKey,
+	}, nil
+}
+
+// newVerifier creates the verifier of bearer tokens, whose key set is loaded before it returns
+func newVerifier(c *config.JWT, stopCh <-chan struct{}, logger *zap.Logger) (*auth.Verifier, error) {
+	var src auth.KeySource = &auth.URLKeySource{URL: c.JWKSURL}
+	if c.JWKSFile != "" {
+		src = auth.FileKeySource(c.JWKSFile)
+	}
+	rules, err := readRules(c.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	keys := auth.NewKeySet(src, c.JWKSMinRefreshInterval)
+	if err := keys.Reload(); err != nil {
+		return nil, err
+	}
+	if c.JWKSRefreshInterval > 0 {
+		keys.RunReloader(c.JWKSRefreshInterval, stopCh, func(err error) {
+			logger.Error("failed to reload key set", zap.String("err", err.Error()))
+		})
+	}
+	return auth.NewVerifier(keys, c, rules)
+}
+
+// readRules reads the rules which map tokens to allow-lists from the file, if any
+func readRules(file string) ([]*auth.Rule, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return auth.ParseRules(b)
+}
@@ -0,0 +1,10 @@
+package config
+
+// Batch is the configuration of batch calls
+type Batch struct {
+	// Parallelism is the number of calls in a batch which are made concurrently
+	Parallelism int
+
+	// MaxItems is the maximum number of calls in a batch
+	MaxItems int
+}
@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+// Breaker is the configuration of the circuit breakers for upstreams.
+// A circuit opens when either of the thresholds is reached, and a threshold of zero disables it.
+type Breaker struct {
+	// ConsecutiveFailures is the number of consecutive failures which opens the circuit
+	ConsecutiveFailures int
+
+	// ErrorRate is the ratio of failures within Window which opens the circuit
+	ErrorRate float64
+
+	// MinRequests is the number of calls required within Window before ErrorRate is evaluated
+	MinRequests int
+
+	// Window is the length of the period in which the error rate is measured
+	Window time.Duration
+
+	// OpenDuration is how long the circuit stays open before a trial call is allowed
+	OpenDuration time.Duration
+}
+
+// Enabled checks if any of the thresholds is set
+func (b *Breaker) Enabled() bool {
+	return b.ConsecutiveFailures > 0 || b.ErrorRate > 0
+}
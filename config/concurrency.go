@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// Concurrency is the configuration of the limits of calls in flight
+type Concurrency struct {
+	// MaxPerUpstream is the maximum number of calls in flight to each upstream. Zero means no limit.
+	MaxPerUpstream int
+
+	// MaxPerService is the maximum number of calls in flight to each gRPC service. Zero means no limit.
+	MaxPerService int
+
+	// MaxByService overrides MaxPerService for the gRPC services, by their fully qualified names. Zero means no limit.
+	MaxByService map[string]int
+
+	// QueueSize is the maximum number of calls waiting for each limit
+	QueueSize int
+
+	// QueueTimeout is how long calls can wait in the queue
+	QueueTimeout time.Duration
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 )
@@ -12,8 +14,188 @@ type Env struct {
 	// Port is the port number grpc-http-proxy will listen on
 	Port int16 `envconfig:"PORT" default:"3000"`
 
-	// Token is the access token
+	// Token is the access token, which is allowed to make any call. It is ignored if the tokens are loaded from a file or a Secret.
 	Token string `envconfig:"TOKEN"`
+
+	// TokensFile is the path of the YAML or JSON file of the access tokens and their allow-lists
+	TokensFile string `envconfig:"TOKENS_FILE"`
+
+	// TokensSecret is the Kubernetes Secret of the access tokens in the form of "namespace/name"
+	TokensSecret string `envconfig:"TOKENS_SECRET"`
+
+	// TokensSecretKey is the key of the access tokens in the Secret
+	TokensSecretKey string `envconfig:"TOKENS_SECRET_KEY" default:"tokens.yaml"`
+
+	// TokensReloadInterval is the interval of reloading the access tokens. Zero disables reloading.
+	TokensReloadInterval time.Duration `envconfig:"TOKENS_RELOAD_INTERVAL" default:"1m"`
+
+	// JWTJWKSFile is the path of the JSON Web Key Set which verifies bearer tokens
+	JWTJWKSFile string `envconfig:"JWT_JWKS_FILE"`
+
+	// JWTJWKSURL is the URL of the JSON Web Key Set which verifies bearer tokens, which is used if JWTJWKSFile is blank
+	JWTJWKSURL string `envconfig:"JWT_JWKS_URL"`
+
+	// JWTJWKSRefreshInterval is the interval of reloading the key set. Zero disables reloading.
+	JWTJWKSRefreshInterval time.Duration `envconfig:"JWT_JWKS_REFRESH_INTERVAL" default:"10m"`
+
+	// JWTJWKSMinRefreshInterval is the minimum interval of reloading the key set when a token is signed by an unknown key
+	JWTJWKSMinRefreshInterval time.Duration `envconfig:"JWT_JWKS_MIN_REFRESH_INTERVAL" default:"30s"`
+
+	// JWTIssuer is the required issuer of bearer tokens
+	JWTIssuer string `envconfig:"JWT_ISSUER"`
+
+	// JWTAudiences is a comma separated list of the audiences of the proxy, one of which bearer tokens must have
+	JWTAudiences []string `envconfig:"JWT_AUDIENCES"`
+
+	// JWTLeeway is the allowed clock skew in checking the expiry of bearer tokens
+	JWTLeeway time.Duration `envconfig:"JWT_LEEWAY" default:"1m"`
+
+	// JWTRulesFile is the path of the YAML or JSON file of the rules which map the claims of bearer tokens to allow-lists
+	JWTRulesFile string `envconfig:"JWT_RULES_FILE"`
+
+	// KubeTokenReview authenticates bearer tokens, such as the projected tokens of ServiceAccounts, with the TokenReview API
+	KubeTokenReview bool `envconfig:"KUBE_TOKEN_REVIEW"`
+
+	// KubeTokenReviewAudiences is a comma separated list of the audiences of the proxy, one of which reviewed tokens must have
+	KubeTokenReviewAudiences []string `envconfig:"KUBE_TOKEN_REVIEW_AUDIENCES"`
+
+	// KubeTokenReviewCacheTTL is how long the results of TokenReviews and SubjectAccessReviews are cached. Zero disables caching.
+	KubeTokenReviewCacheTTL time.Duration `envconfig:"KUBE_TOKEN_REVIEW_CACHE_TTL" default:"1m"`
+
+	// KubeTokenReviewRulesFile is the path of the YAML or JSON file of the rules which map users to allow-lists
+	KubeTokenReviewRulesFile string `envconfig:"KUBE_TOKEN_REVIEW_RULES_FILE"`
+
+	// KubeAccessReviewGroup is the API group of the virtual resources of gRPC services in SubjectAccessReviews.
+	// Blank disables SubjectAccessReviews.
+	KubeAccessReviewGroup string `envconfig:"KUBE_ACCESS_REVIEW_GROUP"`
+
+	// DefaultTimeout is the deadline for gRPC calls when the caller does not specify one.
+	// Zero means no deadline.
+	DefaultTimeout time.Duration `envconfig:"DEFAULT_TIMEOUT"`
+
+	// MaxTimeout is the upper limit of deadlines for gRPC calls.
+	// Zero means no limit.
+	MaxTimeout time.Duration `envconfig:"MAX_TIMEOUT"`
+
+	// RetryMaxAttempts is the maximum number of attempts for a call, including the first one.
+	// Values below 2, including the default, disable retries.
+	RetryMaxAttempts int `envconfig:"RETRY_MAX_ATTEMPTS" default:"1"`
+
+	// RetryInitialBackoff is the upper limit of the randomized wait before the first retry
+	RetryInitialBackoff time.Duration `envconfig:"RETRY_INITIAL_BACKOFF" default:"100ms"`
+
+	// RetryMaxBackoff is the upper limit of the randomized wait between retries
+	RetryMaxBackoff time.Duration `envconfig:"RETRY_MAX_BACKOFF" default:"1s"`
+
+	// RetryMethods is a comma separated list of methods to retry regardless of their idempotency level
+	RetryMethods []string `envconfig:"RETRY_METHODS"`
+
+	// NoRetryMethods is a comma separated list of methods which are never retried
+	NoRetryMethods []string `envconfig:"NO_RETRY_METHODS"`
+
+	// RetryBudgetRatio is the ratio of retries to calls allowed for each upstream
+	RetryBudgetRatio float64 `envconfig:"RETRY_BUDGET_RATIO" default:"0.2"`
+
+	// RetryBudgetBurst is the number of retries allowed for each upstream before the ratio applies
+	RetryBudgetBurst int `envconfig:"RETRY_BUDGET_BURST" default:"10"`
+
+	// BreakerConsecutiveFailures is the number of consecutive failures which opens the circuit of an upstream.
+	// Zero disables the threshold.
+	BreakerConsecutiveFailures int `envconfig:"BREAKER_CONSECUTIVE_FAILURES"`
+
+	// BreakerErrorRate is the ratio of failures which opens the circuit of an upstream.
+	// Zero disables the threshold.
+	BreakerErrorRate float64 `envconfig:"BREAKER_ERROR_RATE"`
+
+	// BreakerMinRequests is the number of calls required before the error rate is evaluated
+	BreakerMinRequests int `envconfig:"BREAKER_MIN_REQUESTS" default:"20"`
+
+	// BreakerWindow is the length of the period in which the error rate is measured
+	BreakerWindow time.Duration `envconfig:"BREAKER_WINDOW" default:"10s"`
+
+	// BreakerOpenDuration is how long a circuit stays open before a trial call is allowed
+	BreakerOpenDuration time.Duration `envconfig:"BREAKER_OPEN_DURATION" default:"30s"`
+
+	// BalanceUpstreams balances calls across multiple upstreams for the same service version,
+	// which are otherwise rejected as undecidable
+	BalanceUpstreams bool `envconfig:"BALANCE_UPSTREAMS"`
+
+	// MaxConcurrencyPerUpstream is the maximum number of calls in flight to each upstream.
+	// Zero means no limit.
+	MaxConcurrencyPerUpstream int `envconfig:"MAX_CONCURRENCY_PER_UPSTREAM"`
+
+	// MaxConcurrencyPerService is the maximum number of calls in flight to each gRPC service.
+	// Zero means no limit.
+	MaxConcurrencyPerService int `envconfig:"MAX_CONCURRENCY_PER_SERVICE"`
+
+	// MaxConcurrencyByService overrides MaxConcurrencyPerService for gRPC services, such as "my.package.MyService:10,my.package.Other:0".
+	// Zero means no limit.
+	MaxConcurrencyByService map[string]int `envconfig:"MAX_CONCURRENCY_BY_SERVICE"`
+
+	// ConcurrencyQueueSize is the maximum number of calls waiting when a concurrency limit is reached
+	ConcurrencyQueueSize int `envconfig:"CONCURRENCY_QUEUE_SIZE" default:"100"`
+
+	// ConcurrencyQueueTimeout is how long calls can wait when a concurrency limit is reached
+	ConcurrencyQueueTimeout time.Duration `envconfig:"CONCURRENCY_QUEUE_TIMEOUT" default:"1s"`
+
+	// GRPCKeepaliveTime is the interval of keepalive pings to upstreams. Zero disables keepalive.
+	GRPCKeepaliveTime time.Duration `envconfig:"GRPC_KEEPALIVE_TIME"`
+
+	// GRPCKeepaliveTimeout is how long to wait for the response to a keepalive ping
+	GRPCKeepaliveTimeout time.Duration `envconfig:"GRPC_KEEPALIVE_TIMEOUT" default:"20s"`
+
+	// GRPCKeepalivePermitWithoutStream allows keepalive pings without active calls
+	GRPCKeepalivePermitWithoutStream bool `envconfig:"GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM"`
+
+	// GRPCMaxSendMsgSize is the maximum size of request messages in bytes. Zero means the gRPC default.
+	GRPCMaxSendMsgSize int `envconfig:"GRPC_MAX_SEND_MSG_SIZE"`
+
+	// GRPCMaxRecvMsgSize is the maximum size of response messages in bytes. Zero means the gRPC default.
+	GRPCMaxRecvMsgSize int `envconfig:"GRPC_MAX_RECV_MSG_SIZE"`
+
+	// GRPCCompressor is the name of the compressor for request messages, such as "gzip"
+	GRPCCompressor string `envconfig:"GRPC_COMPRESSOR"`
+
+	// GRPCAuthority overrides the :authority pseudo-header of calls
+	GRPCAuthority string `envconfig:"GRPC_AUTHORITY"`
+
+	// GRPCUserAgent is prepended to the user agent of calls
+	GRPCUserAgent string `envconfig:"GRPC_USER_AGENT"`
+
+	// HTTPRulesRefreshInterval is the interval of reading google.api.http options from upstreams.
+	// Zero, the default, disables the routes of google.api.http options.
+	HTTPRulesRefreshInterval time.Duration `envconfig:"HTTP_RULES_REFRESH_INTERVAL"`
+
+	// DescriptorCacheTTL is how long the descriptors of services obtained through reflection,
+	// and the documents generated from them, are cached. Zero disables caching.
+	DescriptorCacheTTL time.Duration `envconfig:"DESCRIPTOR_CACHE_TTL" default:"1m"`
+
+	// BatchParallelism is the number of calls in a batch which are made concurrently
+	BatchParallelism int `envconfig:"BATCH_PARALLELISM" default:"10"`
+
+	// BatchMaxItems is the maximum number of calls in a batch
+	BatchMaxItems int `envconfig:"BATCH_MAX_ITEMS" default:"100"`
+
+	// JSONEmitDefaults emits fields with zero values in JSON responses
+	JSONEmitDefaults bool `envconfig:"JSON_EMIT_DEFAULTS"`
+
+	// JSONOrigName uses the field names in the proto files instead of lowerCamelCase names in JSON responses
+	JSONOrigName bool `envconfig:"JSON_ORIG_NAME"`
+
+	// JSONEnumsAsInts emits the numbers of enum values instead of their names in JSON responses
+	JSONEnumsAsInts bool `envconfig:"JSON_ENUMS_AS_INTS"`
+
+	// JSONInt64AsStrings emits 64-bit integers as strings instead of numbers in JSON responses
+	JSONInt64AsStrings bool `envconfig:"JSON_INT64_AS_STRINGS"`
+
+	// JSONStrict rejects JSON request bodies with unknown fields
+	JSONStrict bool `envconfig:"JSON_STRICT" default:"true"`
+
+	// ErrorFormat is the format of the bodies of error responses, which is one of proxy, status and problem
+	ErrorFormat string `envconfig:"ERROR_FORMAT" default:"proxy"`
+
+	// ErrorHTTPStatuses overrides the HTTP status codes of error codes, such as "RESOURCE_EXHAUSTED:429,CIRCUIT_OPEN:503"
+	ErrorHTTPStatuses map[string]int `envconfig:"ERROR_HTTP_STATUSES"`
 }
 
 func ReadFromEnv() (*Env, error) {
@@ -24,3 +206,94 @@ func ReadFromEnv() (*Env, error) {
 
 	return &env, nil
 }
+
+// RetryPolicy returns the proxy-wide retry policy
+func (e *Env) RetryPolicy() *Retry {
+	return &Retry{
+		MaxAttempts:     e.RetryMaxAttempts,
+		InitialBackoff:  e.RetryInitialBackoff,
+		MaxBackoff:      e.RetryMaxBackoff,
+		Methods:         e.RetryMethods,
+		ExcludedMethods: e.NoRetryMethods,
+	}
+}
+
+// BreakerConfig returns the configuration of the circuit breakers
+func (e *Env) BreakerConfig() *Breaker {
+	return &Breaker{
+		ConsecutiveFailures: e.BreakerConsecutiveFailures,
+		ErrorRate:           e.BreakerErrorRate,
+		MinRequests:         e.BreakerMinRequests,
+		Window:              e.BreakerWindow,
+		OpenDuration:        e.BreakerOpenDuration,
+	}
+}
+
+// ConcurrencyConfig returns the configuration of the concurrency limits
+func (e *Env) ConcurrencyConfig() *Concurrency {
+	return &Concurrency{
+		MaxPerUpstream: e.MaxConcurrencyPerUpstream,
+		MaxPerService:  e.MaxConcurrencyPerService,
+		MaxByService:   e.MaxConcurrencyByService,
+		QueueSize:      e.ConcurrencyQueueSize,
+		QueueTimeout:   e.ConcurrencyQueueTimeout,
+	}
+}
+
+// DialConfig returns the configuration of connections and calls to upstreams
+func (e *Env) DialConfig() *Dial {
+	return &Dial{
+		KeepaliveTime:                e.GRPCKeepaliveTime,
+		KeepaliveTimeout:             e.GRPCKeepaliveTimeout,
+		KeepalivePermitWithoutStream: e.GRPCKeepalivePermitWithoutStream,
+		MaxSendMsgSize:               e.GRPCMaxSendMsgSize,
+		MaxRecvMsgSize:               e.GRPCMaxRecvMsgSize,
+		Compressor:                   e.GRPCCompressor,
+		Authority:                    e.GRPCAuthority,
+		UserAgent:                    e.GRPCUserAgent,
+	}
+}
+
+// JSONConfig returns the default configuration of the conversion between messages and JSON
+func (e *Env) JSONConfig() *JSON {
+	return &JSON{
+		EmitDefaults:   e.JSONEmitDefaults,
+		OrigName:       e.JSONOrigName,
+		EnumsAsInts:    e.JSONEnumsAsInts,
+		Int64AsStrings: e.JSONInt64AsStrings,
+		Strict:         e.JSONStrict,
+	}
+}
+
+// BatchConfig returns the configuration of batch calls
+func (e *Env) BatchConfig() *Batch {
+	return &Batch{
+		Parallelism: e.BatchParallelism,
+		MaxItems:    e.BatchMaxItems,
+	}
+}
+
+// JWTConfig returns the configuration of the authentication with JSON Web Tokens
+func (e *Env) JWTConfig() *JWT {
+	return &JWT{
+		JWKSFile:               e.JWTJWKSFile,
+		JWKSURL:                e.JWTJWKSURL,
+		JWKSRefreshInterval:    e.JWTJWKSRefreshInterval,
+		JWKSMinRefreshInterval: e.JWTJWKSMinRefreshInterval,
+		Issuer:                 e.JWTIssuer,
+		Audiences:              e.JWTAudiences,
+		Leeway:                 e.JWTLeeway,
+		RulesFile:              e.JWTRulesFile,
+	}
+}
+
+// TokenReviewConfig returns the configuration of the authentication with the TokenReview API
+func (e *Env) TokenReviewConfig() *TokenReview {
+	return &TokenReview{
+		Enabled:           e.KubeTokenReview,
+		Audiences:         e.KubeTokenReviewAudiences,
+		CacheTTL:          e.KubeTokenReviewCacheTTL,
+		RulesFile:         e.KubeTokenReviewRulesFile,
+		AccessReviewGroup: e.KubeAccessReviewGroup,
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestReadFromEnv(t *testing.T) {
@@ -93,6 +95,232 @@ func TestReadFromEnvTokenDefault(t *testing.T) {
 	}
 }
 
+func TestReadFromEnvTimeouts(t *testing.T) {
+	pairs := map[string]string{
+		"DEFAULT_TIMEOUT": "5s",
+		"MAX_TIMEOUT":     "1m",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := env.DefaultTimeout, 5*time.Second; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got, want := env.MaxTimeout, time.Minute; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestReadFromEnvTimeoutsDefault(t *testing.T) {
+	reset := unsetEnv(t, "DEFAULT_TIMEOUT")
+	defer reset()
+	reset = unsetEnv(t, "MAX_TIMEOUT")
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := env.DefaultTimeout, time.Duration(0); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got, want := env.MaxTimeout, time.Duration(0); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestReadFromEnvHTTPRulesDefault(t *testing.T) {
+	reset := unsetEnv(t, "HTTP_RULES_REFRESH_INTERVAL")
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := env.HTTPRulesRefreshInterval, time.Duration(0); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestReadFromEnvRetryDefault(t *testing.T) {
+	reset := unsetEnv(t, "RETRY_MAX_ATTEMPTS")
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := env.RetryPolicy().MaxAttempts, 1; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestEnv_RetryPolicy(t *testing.T) {
+	pairs := map[string]string{
+		"RETRY_MAX_ATTEMPTS":    "5",
+		"RETRY_INITIAL_BACKOFF": "50ms",
+		"RETRY_METHODS":         "a.Service/Get,a.Service/List",
+		"NO_RETRY_METHODS":      "b.Service/*",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Retry{
+		MaxAttempts:     5,
+		InitialBackoff:  50 * time.Millisecond,
+		MaxBackoff:      time.Second,
+		Methods:         []string{"a.Service/Get", "a.Service/List"},
+		ExcludedMethods: []string{"b.Service/*"},
+	}
+	if got, want := env.RetryPolicy(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := env.RetryBudgetRatio, 0.2; got != want {
+		t.Fatalf("got %f, want %f", got, want)
+	}
+	if got, want := env.RetryBudgetBurst, 10; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestEnv_BreakerConfig(t *testing.T) {
+	pairs := map[string]string{
+		"BREAKER_CONSECUTIVE_FAILURES": "5",
+		"BREAKER_OPEN_DURATION":        "1m",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Breaker{
+		ConsecutiveFailures: 5,
+		ErrorRate:           0,
+		MinRequests:         20,
+		Window:              10 * time.Second,
+		OpenDuration:        time.Minute,
+	}
+	bc := env.BreakerConfig()
+	if got, want := bc, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !bc.Enabled() {
+		t.Fatal("breaker should be enabled")
+	}
+	if env.BalanceUpstreams {
+		t.Fatal("balancing should be disabled by default")
+	}
+}
+
+func TestEnv_ConcurrencyConfig(t *testing.T) {
+	pairs := map[string]string{
+		"MAX_CONCURRENCY_PER_SERVICE": "5",
+		"MAX_CONCURRENCY_BY_SERVICE":  "my.package.MyService:10,my.package.Other:0",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Concurrency{
+		MaxPerUpstream: 0,
+		MaxPerService:  5,
+		MaxByService:   map[string]int{"my.package.MyService": 10, "my.package.Other": 0},
+		QueueSize:      100,
+		QueueTimeout:   time.Second,
+	}
+	if got, want := env.ConcurrencyConfig(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestEnv_DialConfig(t *testing.T) {
+	pairs := map[string]string{
+		"GRPC_KEEPALIVE_TIME":    "1m",
+		"GRPC_MAX_RECV_MSG_SIZE": "16777216",
+		"GRPC_COMPRESSOR":        "gzip",
+		"GRPC_AUTHORITY":         "echo.example.com",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Dial{
+		KeepaliveTime:    time.Minute,
+		KeepaliveTimeout: 20 * time.Second,
+		MaxRecvMsgSize:   16777216,
+		Compressor:       "gzip",
+		Authority:        "echo.example.com",
+	}
+	if got, want := env.DialConfig(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestEnv_JSONConfig(t *testing.T) {
+	pairs := map[string]string{
+		"JSON_EMIT_DEFAULTS":    "true",
+		"JSON_INT64_AS_STRINGS": "true",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &JSON{
+		EmitDefaults:   true,
+		Int64AsStrings: true,
+		Strict:         true,
+	}
+	if got, want := env.JSONConfig(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestEnv_BatchConfig(t *testing.T) {
+	pairs := map[string]string{
+		"BATCH_PARALLELISM": "4",
+	}
+
+	reset := setEnvs(t, pairs)
+	defer reset()
+
+	env, err := ReadFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Batch{
+		Parallelism: 4,
+		MaxItems:    100,
+	}
+	if got, want := env.BatchConfig(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
 func setEnv(t *testing.T, key, value string) func() {
 	original := os.Getenv(key)
 	if err := os.Setenv(key, value); err != nil {
@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+// Dial is the configuration of connections and calls to upstreams.
+// Zero values mean that the defaults of gRPC are used.
+type Dial struct {
+	// KeepaliveTime is the interval of keepalive pings. Zero disables keepalive.
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout is how long to wait for the response to a keepalive ping
+	KeepaliveTimeout time.Duration
+
+	// KeepalivePermitWithoutStream allows keepalive pings without active calls
+	KeepalivePermitWithoutStream bool
+
+	// MaxSendMsgSize is the maximum size of request messages in bytes
+	MaxSendMsgSize int
+
+	// MaxRecvMsgSize is the maximum size of response messages in bytes
+	MaxRecvMsgSize int
+
+	// Compressor is the name of the compressor for request messages, such as "gzip"
+	Compressor string
+
+	// Authority overrides the :authority pseudo-header
+	Authority string
+
+	// UserAgent is prepended to the user agent of gRPC
+	UserAgent string
+}
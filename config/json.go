@@ -0,0 +1,19 @@
+package config
+
+// JSON is the configuration of the conversion between messages and JSON
+type JSON struct {
+	// EmitDefaults emits fields with zero values
+	EmitDefaults bool
+
+	// OrigName uses the field names in the proto files instead of lowerCamelCase names
+	OrigName bool
+
+	// EnumsAsInts emits the numbers of enum values instead of their names
+	EnumsAsInts bool
+
+	// Int64AsStrings emits 64-bit integers as strings instead of numbers
+	Int64AsStrings bool
+
+	// Strict rejects request bodies with fields which are not in the input message type
+	Strict bool
+}
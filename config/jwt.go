@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// JWT is the configuration of the authentication with JSON Web Tokens in the Authorization header
+type JWT struct {
+	// JWKSFile is the path of the JSON Web Key Set which verifies the signatures of tokens
+	JWKSFile string
+
+	// JWKSURL is the URL of the JSON Web Key Set, which is used if JWKSFile is blank
+	JWKSURL string
+
+	// JWKSRefreshInterval is the interval of reloading the key set. Zero disables reloading.
+	JWKSRefreshInterval time.Duration
+
+	// JWKSMinRefreshInterval is the minimum interval of reloading the key set when a token is signed by an unknown key
+	JWKSMinRefreshInterval time.Duration
+
+	// Issuer is the required "iss" claim of tokens
+	Issuer string
+
+	// Audiences are the audiences of the proxy, one of which the "aud" claim of tokens must have
+	Audiences []string
+
+	// Leeway is the allowed clock skew in checking the expiry of tokens
+	Leeway time.Duration
+
+	// RulesFile is the path of the YAML or JSON file of the rules which map claims to allow-lists
+	RulesFile string
+}
+
+// Enabled checks if a key set is configured
+func (j *JWT) Enabled() bool {
+	return j.JWKSFile != "" || j.JWKSURL != ""
+}
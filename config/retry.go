@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+// Retry is the policy for retrying calls which failed because the upstream was unavailable.
+// Methods are specified as "package.Service/Method", or "package.Service/*" for all methods of a service.
+type Retry struct {
+	// MaxAttempts is the maximum number of attempts for a call, including the first one
+	MaxAttempts int
+
+	// InitialBackoff is the upper limit of the randomized wait before the first retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the upper limit of the randomized wait between retries
+	MaxBackoff time.Duration
+
+	// Methods are retried regardless of their idempotency level
+	Methods []string
+
+	// ExcludedMethods are never retried
+	ExcludedMethods []string
+}
@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+// TokenReview is the configuration of the authentication with the TokenReview API of Kubernetes
+type TokenReview struct {
+	// Enabled authenticates bearer tokens, such as the projected tokens of ServiceAccounts, with the TokenReview API
+	Enabled bool
+
+	// Audiences are the audiences of the proxy, one of which the "aud" claim of tokens must have,
+	// so that tokens for other audiences, such as kube-apiserver, are rejected
+	Audiences []string
+
+	// CacheTTL is how long the results of TokenReviews and SubjectAccessReviews are cached. Zero disables caching.
+	CacheTTL time.Duration
+
+	// RulesFile is the path of the YAML or JSON file of the rules which map users to allow-lists
+	RulesFile string
+
+	// AccessReviewGroup is the API group of the virtual resources of gRPC services in SubjectAccessReviews.
+	// Blank disables SubjectAccessReviews.
+	AccessReviewGroup string
+}
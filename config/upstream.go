@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// Upstream is configuration specific to an upstream.
+// Zero values mean that the proxy-wide configuration is used.
+type Upstream struct {
+	// Timeout overrides the default deadline for gRPC calls
+	Timeout time.Duration
+
+	// MaxTimeout overrides the upper limit of deadlines for gRPC calls
+	MaxTimeout time.Duration
+
+	// RetryMaxAttempts overrides the maximum number of attempts for a call
+	RetryMaxAttempts int
+
+	// RetryMethods are added to the methods which are retried regardless of their idempotency level
+	RetryMethods []string
+
+	// NoRetryMethods are added to the methods which are never retried
+	NoRetryMethods []string
+
+	// Dial overrides the configuration of connections and calls for each non-zero field
+	Dial Dial
+}
@@ -0,0 +1,256 @@
+// Package connect implements the parts of the Connect protocol which don't depend on the messages
+// https://connectrpc.com/docs/protocol
+package connect
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	any "github.com/golang/protobuf/ptypes/any"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/metadata"
+)
+
+const (
+	// ProtocolVersionHeader is the header which Connect clients send with unary requests
+	ProtocolVersionHeader = "Connect-Protocol-Version"
+	// TimeoutHeader is the header which carries the timeout of a call in milliseconds
+	TimeoutHeader = "Connect-Timeout-Ms"
+
+	streamContentTypePrefix = "application/connect+"
+
+	compressedFlag byte = 0x01
+	endStreamFlag  byte = 0x02
+
+	envelopeHeaderLen = 5
+)
+
+// Codec is the encoding of messages
+type Codec string
+
+const (
+	// JSON is the proto3 JSON mapping
+	JSON Codec = "json"
+	// Proto is the protobuf wire format
+	Proto Codec = "proto"
+)
+
+// ParseContentType returns the codec of the content type, and whether it is for a streaming call.
+// ok is false if the content type is not one of the Connect protocol.
+func ParseContentType(contentType string) (codec Codec, streaming bool, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false, false
+	}
+	if strings.HasPrefix(mediaType, streamContentTypePrefix) {
+		streaming = true
+		mediaType = "application/" + strings.TrimPrefix(mediaType, streamContentTypePrefix)
+	}
+	switch mediaType {
+	case "application/json":
+		return JSON, streaming, true
+	case "application/proto":
+		return Proto, streaming, true
+	}
+	return "", false, false
+}
+
+// ContentType returns the content type of messages in the codec
+func (c Codec) ContentType(streaming bool) string {
+	if streaming {
+		return streamContentTypePrefix + string(c)
+	}
+	return "application/" + string(c)
+}
+
+// ParseTimeout parses the value of the Connect-Timeout-Ms header.
+// Zero is returned if the value is empty.
+func ParseTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if len(v) > 10 {
+		return 0, errors.Errorf("invalid timeout: %s", v)
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, errors.Errorf("invalid timeout: %s", v)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// codeNames are the names of gRPC status codes in the Connect protocol
+var codeNames = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+// CodeName returns the name of the gRPC status code in the Connect protocol
+func CodeName(c codes.Code) string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return codeNames[codes.Unknown]
+}
+
+// HTTPStatusCode returns the HTTP status code of unary responses with errors of the gRPC status code
+func HTTPStatusCode(c codes.Code) int {
+	switch c {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is the JSON representation of errors
+type Error struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message,omitempty"`
+	Details []*ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail is the JSON representation of an error detail
+type ErrorDetail struct {
+	// Type is the fully qualified name of the message type
+	Type string `json:"type"`
+	// Value is the message in the protobuf wire format, encoded in base64 without padding
+	Value string `json:"value"`
+}
+
+// NewError creates the representation of an error with the gRPC status code, message and details
+func NewError(c codes.Code, message string, details []*any.Any) *Error {
+	e := &Error{
+		Code:    CodeName(c),
+		Message: message,
+	}
+	for _, d := range details {
+		e.Details = append(e.Details, &ErrorDetail{
+			Type:  d.GetTypeUrl()[strings.LastIndex(d.GetTypeUrl(), "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(d.GetValue()),
+		})
+	}
+	return e
+}
+
+// EndStream is the JSON representation of the message which ends a stream
+type EndStream struct {
+	Error    *Error              `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+// ReadEnvelope reads the message in the first envelope of a streaming request body
+func ReadEnvelope(r io.Reader) ([]byte, error) {
+	header := make([]byte, envelopeHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "could not read envelope header")
+	}
+	if header[0]&compressedFlag != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	// the message is read without allocating the length up front, which is given by the client
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read envelope")
+	}
+	if uint32(len(b)) != length {
+		return nil, errors.Wrap(io.ErrUnexpectedEOF, "could not read envelope")
+	}
+	return b, nil
+}
+
+// WriteEnvelope writes the message in an envelope
+func WriteEnvelope(w io.Writer, b []byte) error {
+	return writeEnvelope(w, 0, b)
+}
+
+// WriteEndStream writes the message which ends a stream
+func WriteEndStream(w io.Writer, e *EndStream) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeEnvelope(w, endStreamFlag, b)
+}
+
+func writeEnvelope(w io.Writer, flags byte, b []byte) error {
+	envelope := make([]byte, envelopeHeaderLen+len(b))
+	envelope[0] = flags
+	binary.BigEndian.PutUint32(envelope[1:], uint32(len(b)))
+	copy(envelope[envelopeHeaderLen:], b)
+	_, err := w.Write(envelope)
+	return err
+}
+
+// excludedHeaders are the request headers which are not forwarded as metadata,
+// because they concern the HTTP transport, the Connect protocol or the proxy rather than the call
+var excludedHeaders = map[string]struct{}{
+	"accept":                   {},
+	"accept-encoding":          {},
+	"accept-language":          {},
+	"connect-accept-encoding":  {},
+	"connect-content-encoding": {},
+	"connect-protocol-version": {},
+	"connect-timeout-ms":       {},
+	"connection":               {},
+	"content-encoding":         {},
+	"content-length":           {},
+	"content-type":             {},
+	"cookie":                   {},
+	"host":                     {},
+	"origin":                   {},
+	"referer":                  {},
+	"te":                       {},
+	"transfer-encoding":        {},
+	"user-agent":               {},
+	"x-access-token":           {},
+}
+
+// MetadataFromHeaders converts the headers of a Connect request into metadata.
+// Connect clients send metadata as plain headers, so all headers other than excludedHeaders are converted.
+func MetadataFromHeaders(h map[string][]string) metadata.Metadata {
+	return metadata.MetadataFromRawHeaders(h, excludedHeaders)
+}
@@ -0,0 +1,188 @@
+package connect
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	any "github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		codec       Codec
+		streaming   bool
+		ok          bool
+	}{
+		{"application/json", JSON, false, true},
+		{"application/json; charset=utf-8", JSON, false, true},
+		{"application/proto", Proto, false, true},
+		{"application/connect+json", JSON, true, true},
+		{"application/connect+proto", Proto, true, true},
+		{"application/connect+thrift", "", false, false},
+		{"application/grpc-web", "", false, false},
+		{"", "", false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.contentType, func(t *testing.T) {
+			codec, streaming, ok := ParseContentType(tc.contentType)
+			if got, want := codec, tc.codec; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := streaming, tc.streaming; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+			if got, want := ok, tc.ok; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	cases := []struct {
+		value      string
+		timeout    time.Duration
+		errorIsNil bool
+	}{
+		{"", 0, true},
+		{"1500", 1500 * time.Millisecond, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"1s", 0, false},
+		{"12345678901", 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			timeout, err := ParseTimeout(tc.value)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if got, want := timeout, tc.timeout; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatusCode(t *testing.T) {
+	cases := []struct {
+		code   codes.Code
+		name   string
+		status int
+	}{
+		{codes.Canceled, "canceled", 499},
+		{codes.InvalidArgument, "invalid_argument", http.StatusBadRequest},
+		{codes.DeadlineExceeded, "deadline_exceeded", http.StatusGatewayTimeout},
+		{codes.NotFound, "not_found", http.StatusNotFound},
+		{codes.ResourceExhausted, "resource_exhausted", http.StatusTooManyRequests},
+		{codes.Unimplemented, "unimplemented", http.StatusNotImplemented},
+		{codes.Unavailable, "unavailable", http.StatusServiceUnavailable},
+		{codes.Unauthenticated, "unauthenticated", http.StatusUnauthorized},
+		{codes.DataLoss, "data_loss", http.StatusInternalServerError},
+		{codes.Code(100), "unknown", http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := CodeName(tc.code), tc.name; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := HTTPStatusCode(tc.code), tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	details := []*any.Any{
+		{TypeUrl: "type.googleapis.com/google.rpc.RetryInfo", Value: []byte{0x0a, 0x02}},
+	}
+	got := NewError(codes.NotFound, "not found", details)
+	want := &Error{
+		Code:    "not_found",
+		Message: "not found",
+		Details: []*ErrorDetail{
+			{Type: "google.rpc.RetryInfo", Value: "CgI"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadEnvelope(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       []byte
+		message    []byte
+		errorIsNil bool
+	}{
+		{
+			name:       "message",
+			body:       []byte{0x00, 0x00, 0x00, 0x00, 0x02, 'a', 'b'},
+			message:    []byte("ab"),
+			errorIsNil: true,
+		},
+		{
+			name:       "truncated",
+			body:       []byte{0x00, 0x00, 0x00, 0x00, 0x02, 'a'},
+			errorIsNil: false,
+		},
+		{
+			name:       "compressed",
+			body:       []byte{0x01, 0x00, 0x00, 0x00, 0x01, 'a'},
+			errorIsNil: false,
+		},
+		{
+			name:       "empty",
+			body:       []byte{},
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			message, err := ReadEnvelope(bytes.NewReader(tc.body))
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if got, want := message, tc.message; err == nil && !bytes.Equal(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteEndStream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEnvelope(&buf, []byte("ab")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := WriteEndStream(&buf, &EndStream{Error: NewError(codes.Internal, "", nil)}); err != nil {
+		t.Fatal(err.Error())
+	}
+	end := `{"error":{"code":"internal"}}`
+	want := append([]byte{0x00, 0x00, 0x00, 0x00, 0x02, 'a', 'b', 0x02, 0x00, 0x00, 0x00, byte(len(end))}, end...)
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMetadataFromHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("Connect-Timeout-Ms", "1000")
+	h.Set("X-Request-Id", "abc")
+	md := MetadataFromHeaders(h)
+	if got, want := strings.Join(md["x-request-id"], ","), "abc"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got, want := len(md), 1; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	any "github.com/golang/protobuf/ptypes/any"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // registers the standard error details
+)
+
+// ResolveRegisteredType resolves the type URL into a new message of the registered type,
+// which includes the well-known types and the standard error details in google.rpc
+func ResolveRegisteredType(typeURL string) (proto.Message, error) {
+	name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+	t := proto.MessageType(name)
+	if t == nil {
+		return nil, fmt.Errorf("unknown message type %s", name)
+	}
+	return reflect.New(t.Elem()).Interface().(proto.Message), nil
+}
+
+type registeredTypes struct{}
+
+func (registeredTypes) Resolve(typeURL string) (proto.Message, error) {
+	return ResolveRegisteredType(typeURL)
+}
+
+// detailJSON converts the detail of an error into the proto3 JSON representation of Any, which has the "@type" field.
+// The detail is written with its raw type URL and value if its type cannot be resolved.
+func detailJSON(d *any.Any, r jsonpb.AnyResolver) json.RawMessage {
+	if r == nil {
+		r = registeredTypes{}
+	}
+	if b, err := resolveDetail(d, r); err == nil {
+		return b
+	}
+	b, _ := json.Marshal(d)
+	return b
+}
+
+func resolveDetail(d *any.Any, r jsonpb.AnyResolver) ([]byte, error) {
+	m, err := r.Resolve(d.GetTypeUrl())
+	if err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(d.GetValue(), m); err != nil {
+		return nil, err
+	}
+	s, err := (&jsonpb.Marshaler{AnyResolver: r}).MarshalToString(m)
+	if err != nil {
+		return nil, err
+	}
+	t, err := json.Marshal(d.GetTypeUrl())
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(s, "{") {
+		// well-known types which are not represented as objects are in the "value" field
+		return []byte(fmt.Sprintf(`{"@type":%s,"value":%s}`, t, s)), nil
+	}
+	b := []byte(`{"@type":` + string(t))
+	if body := strings.TrimSpace(s[1:]); body != "}" {
+		b = append(b, ',')
+	}
+	return append(b, s[1:]...), nil
+}
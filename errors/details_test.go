@@ -0,0 +1,68 @@
+package errors
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes"
+	any "github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/duration"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGRPCError_WriteJSON(t *testing.T) {
+	badRequest, err := ptypes.MarshalAny(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "must not be empty"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	retryInfo, err := ptypes.MarshalAny(&errdetails.RetryInfo{
+		RetryDelay: &duration.Duration{Seconds: 1},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cases := []struct {
+		name    string
+		details []*any.Any
+		json    string
+	}{
+		{
+			name:    "no details",
+			details: nil,
+			json:    `{"code":3,"error_code":"INVALID_ARGUMENT","message":"invalid"}`,
+		},
+		{
+			name:    "standard error details",
+			details: []*any.Any{badRequest, retryInfo},
+			json: `{"code":3,"error_code":"INVALID_ARGUMENT","message":"invalid","details":[` +
+				`{"@type":"type.googleapis.com/google.rpc.BadRequest","fieldViolations":[{"field":"name","description":"must not be empty"}]},` +
+				`{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"1s"}]}`,
+		},
+		{
+			name:    "unknown type",
+			details: []*any.Any{{TypeUrl: "type.googleapis.com/my.Detail", Value: []byte("a")}},
+			json:    `{"code":3,"error_code":"INVALID_ARGUMENT","message":"invalid","details":[{"type_url":"type.googleapis.com/my.Detail","value":"YQ=="}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &GRPCError{
+				StatusCode: int(codes.InvalidArgument),
+				Message:    "invalid",
+				Details:    tc.details,
+			}
+			var b bytes.Buffer
+			if err := e.WriteJSON(&b); err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := b.String(), tc.json+"\n"; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -2,16 +2,22 @@ package errors
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 
+	"github.com/golang/protobuf/jsonpb"
 	any "github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc/codes"
 )
 
 type Error interface {
 	error
 	HTTPStatusCode() int
+	GRPCStatusCode() codes.Code
+	// ErrorCode returns the machine-readable code of the error, such as "MESSAGE_TYPE_MISMATCH" or "RESOURCE_EXHAUSTED"
+	ErrorCode() string
 	WriteJSON(w io.Writer) error
 }
 
@@ -20,6 +26,43 @@ type ProxyError struct {
 	Code
 	Message string
 	Err     error
+	// Field is the location of the mismatch of MessageTypeMismatch errors, if it is known
+	Field *FieldError
+	// Resolution explains errors in resolving the service of a request to its upstream, such as VersionNotSpecified
+	Resolution *ResolutionError
+}
+
+// ResolutionError is what is known about a service which a request could not be resolved with
+type ResolutionError struct {
+	// Service is the requested service
+	Service string `json:"service"`
+	// Version is the requested version, which is blank if it is not specified
+	Version string `json:"version,omitempty"`
+	// Versions are the known versions of the service, where the blank version is of unversioned upstreams
+	Versions []string `json:"versions,omitempty"`
+	// Suggestions are the known services whose names are the closest to the service, if the service is unknown
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// FieldError is the location and the reason of a mismatch between input JSON and the message type
+type FieldError struct {
+	// Path is the path of the offending field, such as "user.tags[0]", which is blank for the whole message
+	Path string `json:"path"`
+	// Expected is the type which the field expects
+	Expected string `json:"expected"`
+	// Offset is the position of the offending value in the input JSON in bytes
+	Offset int `json:"offset"`
+	// Reason is why the value doesn't match the type
+	Reason string `json:"reason"`
+}
+
+// Error satisfies the error interface
+func (e *FieldError) Error() string {
+	msg := fmt.Sprintf("expected %s at offset %d: %s", e.Expected, e.Offset, e.Reason)
+	if e.Path == "" {
+		return msg
+	}
+	return fmt.Sprintf("field %s: %s", e.Path, msg)
 }
 
 // Code represents type of internal error
@@ -42,8 +85,43 @@ const (
 	VersionNotSpecified Code = 7
 	// VersionUndecidable represents there being multiple upstreams that match the specified (service, version) pair
 	VersionUndecidable Code = 8
+	// DeadlineExceeded represents the deadline of the call expiring before the upstream responded
+	DeadlineExceeded Code = 9
+	// CircuitOpen represents the circuit breaker of the upstream being open
+	CircuitOpen Code = 10
+	// ConcurrencyLimitExceeded represents there being too many concurrent calls to the upstream or the gRPC service
+	ConcurrencyLimitExceeded Code = 11
+	// InvalidFieldMask represents a field mask of the response which doesn't match the output message's type
+	InvalidFieldMask Code = 12
+	// PermissionDenied represents the caller not being allowed to call the service, the method or the version
+	PermissionDenied Code = 13
 )
 
+// codeNames are the machine-readable names of the codes
+var codeNames = map[Code]string{
+	UpstreamConnFailure:      "UPSTREAM_CONN_FAILURE",
+	ServiceUnresolvable:      "SERVICE_UNRESOLVABLE",
+	ServiceNotFound:          "SERVICE_NOT_FOUND",
+	MethodNotFound:           "METHOD_NOT_FOUND",
+	MessageTypeMismatch:      "MESSAGE_TYPE_MISMATCH",
+	Unknown:                  "UNKNOWN",
+	VersionNotSpecified:      "VERSION_NOT_SPECIFIED",
+	VersionUndecidable:       "VERSION_UNDECIDABLE",
+	DeadlineExceeded:         "DEADLINE_EXCEEDED",
+	CircuitOpen:              "CIRCUIT_OPEN",
+	ConcurrencyLimitExceeded: "CONCURRENCY_LIMIT_EXCEEDED",
+	InvalidFieldMask:         "INVALID_FIELD_MASK",
+	PermissionDenied:         "PERMISSION_DENIED",
+}
+
+// Name returns the machine-readable name of the code, such as "MESSAGE_TYPE_MISMATCH"
+func (c Code) Name() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return codeNames[Unknown]
+}
+
 // Error satisfies the error interface
 func (e *ProxyError) Error() string {
 	switch e.Code {
@@ -61,6 +139,16 @@ func (e *ProxyError) Error() string {
 		return "multiple versions of this service exist. specify version in request"
 	case VersionUndecidable:
 		return "multiple backends exist. add version annotations"
+	case DeadlineExceeded:
+		return "deadline exceeded while calling backend gRPC service"
+	case CircuitOpen:
+		return "circuit breaker is open for backend gRPC service"
+	case ConcurrencyLimitExceeded:
+		return "too many concurrent calls to backend gRPC service"
+	case InvalidFieldMask:
+		return "invalid field mask"
+	case PermissionDenied:
+		return "permission denied"
 	default:
 		return "unknown failure"
 	}
@@ -83,20 +171,78 @@ func (e *ProxyError) HTTPStatusCode() int {
 		return http.StatusBadRequest
 	case VersionUndecidable:
 		return http.StatusBadRequest
+	case DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case CircuitOpen:
+		return http.StatusServiceUnavailable
+	case ConcurrencyLimitExceeded:
+		return http.StatusServiceUnavailable
+	case InvalidFieldMask:
+		return http.StatusBadRequest
+	case PermissionDenied:
+		return http.StatusForbidden
 	default:
 		return http.StatusInternalServerError
 	}
 }
 
+// GRPCStatusCode returns the gRPC status code for a internal error, which is used by gRPC based protocols
+func (e *ProxyError) GRPCStatusCode() codes.Code {
+	switch e.Code {
+	case UpstreamConnFailure:
+		return codes.Unavailable
+	case ServiceUnresolvable:
+		return codes.Unimplemented
+	case ServiceNotFound:
+		return codes.Unimplemented
+	case MethodNotFound:
+		return codes.Unimplemented
+	case MessageTypeMismatch:
+		return codes.InvalidArgument
+	case VersionNotSpecified:
+		return codes.InvalidArgument
+	case VersionUndecidable:
+		return codes.FailedPrecondition
+	case DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case CircuitOpen:
+		return codes.Unavailable
+	case ConcurrencyLimitExceeded:
+		return codes.ResourceExhausted
+	case InvalidFieldMask:
+		return codes.InvalidArgument
+	case PermissionDenied:
+		return codes.PermissionDenied
+	default:
+		return codes.Internal
+	}
+}
+
+// ErrorCode returns the name of the code of the internal error
+func (e *ProxyError) ErrorCode() string {
+	return e.Code.Name()
+}
+
 // WriteJSON writes an JSON representation of the internal error for responses
 func (e *ProxyError) WriteJSON(w io.Writer) error {
+	return e.writeJSON(w, e.HTTPStatusCode())
+}
+
+// writeJSON writes the JSON representation of the internal error with the HTTP status code
+func (e *ProxyError) writeJSON(w io.Writer, status int) error {
 	type JSONSchema struct {
-		Status  int    `json:"status"`
-		Message string `json:"message"`
+		Status     int              `json:"status"`
+		ErrorCode  string           `json:"error_code"`
+		Message    string           `json:"message"`
+		Field      *FieldError      `json:"field,omitempty"`
+		Resolution *ResolutionError `json:"resolution,omitempty"`
 	}
 	return json.NewEncoder(w).Encode(&JSONSchema{
-		Status:  e.HTTPStatusCode(),
-		Message: e.Message,
+		Status:     status,
+		ErrorCode:  e.ErrorCode(),
+		Message:    e.Message,
+		Field:      e.Field,
+		Resolution: e.Resolution,
 	})
 }
 
@@ -105,6 +251,9 @@ type GRPCError struct {
 	StatusCode int        `json:"code"`
 	Message    string     `json:"message"`
 	Details    []*any.Any `json:"details,omitempty"`
+	// Resolver resolves the message types of Details, so that they are written in JSON.
+	// The registered types, including the standard error details in google.rpc, are resolved if it is nil.
+	Resolver jsonpb.AnyResolver `json:"-"`
 }
 
 // HTTPStatusCode converts gRPC status codes to HTTP status codes
@@ -151,6 +300,19 @@ func (e *GRPCError) HTTPStatusCode() int {
 	}
 }
 
+// GRPCStatusCode returns the status code returned by the upstream
+func (e *GRPCError) GRPCStatusCode() codes.Code {
+	return codes.Code(e.StatusCode)
+}
+
+// ErrorCode returns the name of the status code returned by the upstream, such as "RESOURCE_EXHAUSTED"
+func (e *GRPCError) ErrorCode() string {
+	if name, ok := code.Code_name[int32(e.StatusCode)]; ok {
+		return name
+	}
+	return code.Code_name[int32(codes.Unknown)]
+}
+
 // Error satisfies the error interface
 func (e *GRPCError) Error() string {
 	return e.Message
@@ -158,5 +320,25 @@ func (e *GRPCError) Error() string {
 
 // WriteJSON writes an JSON representation of the gRPC error for responses
 func (e *GRPCError) WriteJSON(w io.Writer) error {
-	return json.NewEncoder(w).Encode(e)
+	type JSONSchema struct {
+		StatusCode int               `json:"code"`
+		ErrorCode  string            `json:"error_code"`
+		Message    string            `json:"message"`
+		Details    []json.RawMessage `json:"details,omitempty"`
+	}
+	return json.NewEncoder(w).Encode(&JSONSchema{
+		StatusCode: e.StatusCode,
+		ErrorCode:  e.ErrorCode(),
+		Message:    e.Message,
+		Details:    e.detailsJSON(),
+	})
+}
+
+// detailsJSON converts the details into JSON, with the types resolved by the resolver
+func (e *GRPCError) detailsJSON() []json.RawMessage {
+	details := make([]json.RawMessage, 0, len(e.Details))
+	for _, d := range e.Details {
+		details = append(details, detailJSON(d, e.Resolver))
+	}
+	return details
 }
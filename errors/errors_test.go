@@ -43,6 +43,26 @@ func TestError_Error(t *testing.T) {
 			Code: VersionUndecidable,
 			msg:  "multiple backends exist. add version annotations",
 		},
+		{
+			Code: DeadlineExceeded,
+			msg:  "deadline exceeded while calling backend gRPC service",
+		},
+		{
+			Code: CircuitOpen,
+			msg:  "circuit breaker is open for backend gRPC service",
+		},
+		{
+			Code: ConcurrencyLimitExceeded,
+			msg:  "too many concurrent calls to backend gRPC service",
+		},
+		{
+			Code: InvalidFieldMask,
+			msg:  "invalid field mask",
+		},
+		{
+			Code: PermissionDenied,
+			msg:  "permission denied",
+		},
 	}
 	for _, tc := range cases {
 		t.Run(fmt.Sprintf("%d", tc.Code), func(t *testing.T) {
@@ -56,6 +76,146 @@ func TestError_Error(t *testing.T) {
 	}
 }
 
+func TestProxyError_HTTPStatusCode(t *testing.T) {
+	cases := []struct {
+		Code
+		httpCode int
+	}{
+		{
+			UpstreamConnFailure,
+			http.StatusBadGateway,
+		},
+		{
+			ServiceUnresolvable,
+			http.StatusNotFound,
+		},
+		{
+			ServiceNotFound,
+			http.StatusInternalServerError,
+		},
+		{
+			MethodNotFound,
+			http.StatusNotFound,
+		},
+		{
+			MessageTypeMismatch,
+			http.StatusBadRequest,
+		},
+		{
+			Unknown,
+			http.StatusInternalServerError,
+		},
+		{
+			VersionNotSpecified,
+			http.StatusBadRequest,
+		},
+		{
+			VersionUndecidable,
+			http.StatusBadRequest,
+		},
+		{
+			DeadlineExceeded,
+			http.StatusGatewayTimeout,
+		},
+		{
+			CircuitOpen,
+			http.StatusServiceUnavailable,
+		},
+		{
+			ConcurrencyLimitExceeded,
+			http.StatusServiceUnavailable,
+		},
+		{
+			InvalidFieldMask,
+			http.StatusBadRequest,
+		},
+		{
+			PermissionDenied,
+			http.StatusForbidden,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%d", tc.Code), func(t *testing.T) {
+			err := &ProxyError{
+				Code: tc.Code,
+			}
+			if got, want := err.HTTPStatusCode(), tc.httpCode; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestProxyError_GRPCStatusCode(t *testing.T) {
+	cases := []struct {
+		Code
+		grpcCode codes.Code
+	}{
+		{
+			UpstreamConnFailure,
+			codes.Unavailable,
+		},
+		{
+			ServiceUnresolvable,
+			codes.Unimplemented,
+		},
+		{
+			ServiceNotFound,
+			codes.Unimplemented,
+		},
+		{
+			MethodNotFound,
+			codes.Unimplemented,
+		},
+		{
+			MessageTypeMismatch,
+			codes.InvalidArgument,
+		},
+		{
+			Unknown,
+			codes.Internal,
+		},
+		{
+			VersionNotSpecified,
+			codes.InvalidArgument,
+		},
+		{
+			VersionUndecidable,
+			codes.FailedPrecondition,
+		},
+		{
+			DeadlineExceeded,
+			codes.DeadlineExceeded,
+		},
+		{
+			CircuitOpen,
+			codes.Unavailable,
+		},
+		{
+			ConcurrencyLimitExceeded,
+			codes.ResourceExhausted,
+		},
+		{
+			InvalidFieldMask,
+			codes.InvalidArgument,
+		},
+		{
+			PermissionDenied,
+			codes.PermissionDenied,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%d", tc.Code), func(t *testing.T) {
+			err := &ProxyError{
+				Code: tc.Code,
+			}
+			if got, want := err.GRPCStatusCode(), tc.grpcCode; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
 func TestGRPCError_Error(t *testing.T) {
 	const msg = "error"
 	err := &GRPCError{
@@ -171,3 +331,51 @@ func TestInternalError_WriteJSON(t *testing.T) {
 		t.Fatalf("got %v, want %v", got, want)
 	}
 }
+
+func TestProxyError_WriteJSONWithField(t *testing.T) {
+	err := &ProxyError{
+		Code:    MessageTypeMismatch,
+		Message: "input JSON does not match the message type",
+		Field: &FieldError{
+			Path:     "user.id",
+			Expected: "int64",
+			Offset:   12,
+			Reason:   "got boolean",
+		},
+	}
+	var b bytes.Buffer
+	if err := err.WriteJSON(&b); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"status":400,"error_code":"MESSAGE_TYPE_MISMATCH","message":"input JSON does not match the message type",` +
+		`"field":{"path":"user.id","expected":"int64","offset":12,"reason":"got boolean"}}` + "\n"
+	if got, want := b.String(), expected; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFieldError_Error(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   *FieldError
+		error string
+	}{
+		{
+			name:  "field",
+			err:   &FieldError{Path: "user.id", Expected: "int64", Offset: 12, Reason: "got boolean"},
+			error: "field user.id: expected int64 at offset 12: got boolean",
+		},
+		{
+			name:  "whole message",
+			err:   &FieldError{Expected: "valid JSON", Offset: 0, Reason: "unexpected end of JSON input"},
+			error: "expected valid JSON at offset 0: unexpected end of JSON input",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := tc.err.Error(), tc.error; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
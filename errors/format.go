@@ -0,0 +1,189 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Format is a format of the bodies of error responses
+type Format string
+
+const (
+	// FormatProxy is the format written by WriteJSON, whose shape differs between errors of the proxy and of upstreams
+	FormatProxy Format = "proxy"
+	// FormatStatus is the proto3 JSON representation of google.rpc.Status.
+	// The error code is in a detail of the type google.rpc.ErrorInfo.
+	FormatStatus Format = "status"
+	// FormatProblem is the problem details of RFC 7807, with the error code in the "code" member
+	FormatProblem Format = "problem"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo details which carry the error codes
+const ErrorDomain = "grpc-http-proxy"
+
+// ContentType returns the media type of the bodies in the format
+func (f Format) ContentType() string {
+	if f == FormatProblem {
+		return "application/problem+json"
+	}
+	return "application/json"
+}
+
+// StatusMapping maps error codes, such as "RESOURCE_EXHAUSTED" and "CIRCUIT_OPEN", to HTTP status codes.
+// Errors whose codes are not in the mapping have the default status codes of HTTPStatusCode.
+type StatusMapping map[string]int
+
+// Formatter writes errors in a format, with the HTTP status codes of the mapping
+type Formatter struct {
+	Format   Format
+	Statuses StatusMapping
+}
+
+// NewFormatter creates a Formatter of the format named format, which defaults to FormatProxy if it is blank.
+// The keys of statuses are the error codes, in any case.
+func NewFormatter(format string, statuses map[string]int) (*Formatter, error) {
+	f := &Formatter{
+		Format:   Format(strings.ToLower(format)),
+		Statuses: make(StatusMapping, len(statuses)),
+	}
+	switch f.Format {
+	case "":
+		f.Format = FormatProxy
+	case FormatProxy, FormatStatus, FormatProblem:
+	default:
+		return nil, fmt.Errorf("unknown error format %q, which must be one of proxy, status and problem", format)
+	}
+	for code, status := range statuses {
+		if status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid HTTP status code %d of %s", status, code)
+		}
+		f.Statuses[strings.ToUpper(code)] = status
+	}
+	return f, nil
+}
+
+// HTTPStatusCode returns the HTTP status code of the error, which the mapping overrides
+func (f *Formatter) HTTPStatusCode(err Error) int {
+	if status, ok := f.Statuses[err.ErrorCode()]; ok {
+		return status
+	}
+	return err.HTTPStatusCode()
+}
+
+// WriteResponse writes the error as the response, with its HTTP status code and the content type of the format
+func (f *Formatter) WriteResponse(w http.ResponseWriter, err Error) error {
+	w.Header().Set("Content-Type", f.Format.ContentType())
+	w.WriteHeader(f.HTTPStatusCode(err))
+	return f.WriteJSON(w, err)
+}
+
+// WriteJSON writes the body of the error in the format
+func (f *Formatter) WriteJSON(w io.Writer, err Error) error {
+	switch f.Format {
+	case FormatStatus:
+		return f.writeStatus(w, err)
+	case FormatProblem:
+		return f.writeProblem(w, err)
+	}
+	if e, ok := err.(*ProxyError); ok {
+		return e.writeJSON(w, f.HTTPStatusCode(err))
+	}
+	return err.WriteJSON(w)
+}
+
+// writeStatus writes the error as google.rpc.Status, whose last detail is google.rpc.ErrorInfo with the error code
+func (f *Formatter) writeStatus(w io.Writer, err Error) error {
+	type ErrorInfo struct {
+		Type     string            `json:"@type"`
+		Reason   string            `json:"reason"`
+		Domain   string            `json:"domain"`
+		Metadata map[string]string `json:"metadata,omitempty"`
+	}
+	type JSONSchema struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details"`
+	}
+	var details []json.RawMessage
+	if e, ok := err.(*GRPCError); ok {
+		details = e.detailsJSON()
+	}
+	info, jerr := json.Marshal(&ErrorInfo{
+		Type:     "type.googleapis.com/google.rpc.ErrorInfo",
+		Reason:   err.ErrorCode(),
+		Domain:   ErrorDomain,
+		Metadata: metadata(err),
+	})
+	if jerr != nil {
+		return jerr
+	}
+	return json.NewEncoder(w).Encode(&JSONSchema{
+		Code:    int(err.GRPCStatusCode()),
+		Message: message(err),
+		Details: append(details, info),
+	})
+}
+
+// writeProblem writes the error as the problem details of RFC 7807.
+// The type is about:blank, so the title is the reason phrase of the HTTP status code.
+func (f *Formatter) writeProblem(w io.Writer, err Error) error {
+	type JSONSchema struct {
+		Type       string            `json:"type"`
+		Title      string            `json:"title"`
+		Status     int               `json:"status"`
+		Detail     string            `json:"detail,omitempty"`
+		Code       string            `json:"code"`
+		Field      *FieldError       `json:"field,omitempty"`
+		Resolution *ResolutionError  `json:"resolution,omitempty"`
+		Details    []json.RawMessage `json:"details,omitempty"`
+	}
+	status := f.HTTPStatusCode(err)
+	p := &JSONSchema{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: message(err),
+		Code:   err.ErrorCode(),
+	}
+	switch e := err.(type) {
+	case *ProxyError:
+		p.Field = e.Field
+		p.Resolution = e.Resolution
+	case *GRPCError:
+		if len(e.Details) > 0 {
+			p.Details = e.detailsJSON()
+		}
+	}
+	return json.NewEncoder(w).Encode(p)
+}
+
+// metadata returns the metadata of google.rpc.ErrorInfo, which has the resolution of the service of the request if any.
+// Lists are delimited by commas, since the values of metadata are strings.
+func metadata(err Error) map[string]string {
+	e, ok := err.(*ProxyError)
+	if !ok || e.Resolution == nil {
+		return nil
+	}
+	m := map[string]string{"service": e.Resolution.Service}
+	if e.Resolution.Version != "" {
+		m["version"] = e.Resolution.Version
+	}
+	if len(e.Resolution.Versions) > 0 {
+		m["versions"] = strings.Join(e.Resolution.Versions, ",")
+	}
+	if len(e.Resolution.Suggestions) > 0 {
+		m["suggestions"] = strings.Join(e.Resolution.Suggestions, ",")
+	}
+	return m
+}
+
+// message returns the message of the error for clients
+func message(err Error) string {
+	if e, ok := err.(*ProxyError); ok && e.Message != "" {
+		return e.Message
+	}
+	return err.Error()
+}
@@ -0,0 +1,237 @@
+package errors
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes"
+	any "github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestNewFormatter(t *testing.T) {
+	cases := []struct {
+		name         string
+		format       string
+		statuses     map[string]int
+		want         Format
+		wantStatuses StatusMapping
+		errorIsNil   bool
+	}{
+		{
+			name:         "default",
+			format:       "",
+			want:         FormatProxy,
+			wantStatuses: StatusMapping{},
+			errorIsNil:   true,
+		},
+		{
+			name:         "problem",
+			format:       "Problem",
+			statuses:     map[string]int{"resource_exhausted": 429},
+			want:         FormatProblem,
+			wantStatuses: StatusMapping{"RESOURCE_EXHAUSTED": 429},
+			errorIsNil:   true,
+		},
+		{
+			name:       "unknown format",
+			format:     "xml",
+			errorIsNil: false,
+		},
+		{
+			name:       "invalid status",
+			format:     "status",
+			statuses:   map[string]int{"RESOURCE_EXHAUSTED": 42},
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewFormatter(tc.format, tc.statuses)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := f.Format, tc.want; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := f.Statuses, tc.wantStatuses; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatter_HTTPStatusCode(t *testing.T) {
+	f, err := NewFormatter("proxy", map[string]int{"RESOURCE_EXHAUSTED": http.StatusTooManyRequests})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cases := []struct {
+		name string
+		err  Error
+		want int
+	}{
+		{
+			name: "overridden",
+			err:  &GRPCError{StatusCode: int(codes.ResourceExhausted)},
+			want: http.StatusTooManyRequests,
+		},
+		{
+			name: "default of the upstream",
+			err:  &GRPCError{StatusCode: int(codes.NotFound)},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "default of the proxy",
+			err:  &ProxyError{Code: CircuitOpen},
+			want: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := f.HTTPStatusCode(tc.err), tc.want; got != want {
+				t.Errorf("got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatter_WriteJSON(t *testing.T) {
+	retryInfo, err := ptypes.MarshalAny(&errdetails.RetryInfo{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	proxyError := &ProxyError{
+		Code:    MessageTypeMismatch,
+		Message: "input JSON does not match the message type",
+		Field:   &FieldError{Path: "id", Expected: "int64", Offset: 6, Reason: "got boolean"},
+	}
+	grpcError := &GRPCError{
+		StatusCode: int(codes.ResourceExhausted),
+		Message:    "exhausted",
+		Details:    []*any.Any{retryInfo},
+	}
+	resolutionError := &ProxyError{
+		Code:    VersionNotSpecified,
+		Message: "specify the version",
+		Resolution: &ResolutionError{
+			Service:  "a.Library",
+			Versions: []string{"v1", "v2"},
+		},
+	}
+	statuses := StatusMapping{"RESOURCE_EXHAUSTED": http.StatusTooManyRequests}
+	cases := []struct {
+		name   string
+		format Format
+		err    Error
+		want   string
+	}{
+		{
+			name:   "proxy format of an error of the proxy",
+			format: FormatProxy,
+			err:    proxyError,
+			want: `{"status":400,"error_code":"MESSAGE_TYPE_MISMATCH","message":"input JSON does not match the message type",` +
+				`"field":{"path":"id","expected":"int64","offset":6,"reason":"got boolean"}}`,
+		},
+		{
+			name:   "proxy format of an error of the upstream",
+			format: FormatProxy,
+			err:    grpcError,
+			want:   `{"code":8,"error_code":"RESOURCE_EXHAUSTED","message":"exhausted","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo"}]}`,
+		},
+		{
+			name:   "proxy format of a resolution error",
+			format: FormatProxy,
+			err:    resolutionError,
+			want: `{"status":400,"error_code":"VERSION_NOT_SPECIFIED","message":"specify the version",` +
+				`"resolution":{"service":"a.Library","versions":["v1","v2"]}}`,
+		},
+		{
+			name:   "status format of a resolution error",
+			format: FormatStatus,
+			err:    resolutionError,
+			want: `{"code":3,"message":"specify the version","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo",` +
+				`"reason":"VERSION_NOT_SPECIFIED","domain":"grpc-http-proxy","metadata":{"service":"a.Library","versions":"v1,v2"}}]}`,
+		},
+		{
+			name:   "problem format of a resolution error",
+			format: FormatProblem,
+			err:    resolutionError,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"specify the version",` +
+				`"code":"VERSION_NOT_SPECIFIED","resolution":{"service":"a.Library","versions":["v1","v2"]}}`,
+		},
+		{
+			name:   "status format of an error of the proxy",
+			format: FormatStatus,
+			err:    proxyError,
+			want: `{"code":3,"message":"input JSON does not match the message type","details":[` +
+				`{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"MESSAGE_TYPE_MISMATCH","domain":"grpc-http-proxy"}]}`,
+		},
+		{
+			name:   "status format of an error of the upstream",
+			format: FormatStatus,
+			err:    grpcError,
+			want: `{"code":8,"message":"exhausted","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo"},` +
+				`{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"RESOURCE_EXHAUSTED","domain":"grpc-http-proxy"}]}`,
+		},
+		{
+			name:   "problem format of an error of the proxy",
+			format: FormatProblem,
+			err:    proxyError,
+			want: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"input JSON does not match the message type",` +
+				`"code":"MESSAGE_TYPE_MISMATCH","field":{"path":"id","expected":"int64","offset":6,"reason":"got boolean"}}`,
+		},
+		{
+			name:   "problem format of an error of the upstream",
+			format: FormatProblem,
+			err:    grpcError,
+			want: `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"exhausted",` +
+				`"code":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo"}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &Formatter{Format: tc.format, Statuses: statuses}
+			var b bytes.Buffer
+			if err := f.WriteJSON(&b, tc.err); err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := b.String(), tc.want+"\n"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatter_WriteResponse(t *testing.T) {
+	cases := []struct {
+		format      Format
+		contentType string
+	}{
+		{format: FormatProxy, contentType: "application/json"},
+		{format: FormatStatus, contentType: "application/json"},
+		{format: FormatProblem, contentType: "application/problem+json"},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			f := &Formatter{Format: tc.format, Statuses: StatusMapping{"CIRCUIT_OPEN": http.StatusTooManyRequests}}
+			rr := httptest.NewRecorder()
+			if err := f.WriteResponse(rr, &ProxyError{Code: CircuitOpen}); err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := rr.Code, http.StatusTooManyRequests; got != want {
+				t.Errorf("got %d, want %d", got, want)
+			}
+			if got, want := rr.Header().Get("Content-Type"), tc.contentType; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// Package grpcweb implements the framing of the gRPC-Web protocol
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+package grpcweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	"github.com/mercari/grpc-http-proxy/metadata"
+)
+
+const (
+	// ContentType is the content type of binary gRPC-Web messages
+	ContentType = "application/grpc-web"
+	// TextContentType is the content type of base64 encoded gRPC-Web messages
+	TextContentType = "application/grpc-web-text"
+
+	dataFrame       byte = 0x00
+	compressedFrame byte = 0x01
+	trailerFrame    byte = 0x80
+
+	frameHeaderLen = 5
+)
+
+// Format is the encoding of a gRPC-Web request or response body
+type Format int
+
+const (
+	// Unknown means that the content type is not gRPC-Web
+	Unknown Format = iota
+	// Binary means that frames are written as they are
+	Binary
+	// Text means that frames are base64 encoded
+	Text
+)
+
+// FormatOf returns the format of the content type, such as "application/grpc-web+proto"
+func FormatOf(contentType string) Format {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Unknown
+	}
+	switch {
+	case mediaType == ContentType || strings.HasPrefix(mediaType, ContentType+"+"):
+		return Binary
+	case mediaType == TextContentType || strings.HasPrefix(mediaType, TextContentType+"+"):
+		return Text
+	}
+	return Unknown
+}
+
+// ContentType returns the content type of responses in the format
+func (f Format) ContentType() string {
+	if f == Text {
+		return TextContentType + "+proto"
+	}
+	return ContentType + "+proto"
+}
+
+// ReadMessages reads the messages from the frames of a request body in the format
+func ReadMessages(r io.Reader, f Format) ([][]byte, error) {
+	if f == Text {
+		r = newTextReader(r)
+	}
+	var messages [][]byte
+	header := make([]byte, frameHeaderLen)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return messages, nil
+			}
+			return nil, errors.Wrap(err, "could not read frame header")
+		}
+		length := binary.BigEndian.Uint32(header[1:])
+		// the payload is read without allocating the length up front, which is given by the client
+		payload, err := ioutil.ReadAll(io.LimitReader(r, int64(length)))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read frame payload")
+		}
+		if uint32(len(payload)) != length {
+			return nil, errors.Wrap(io.ErrUnexpectedEOF, "could not read frame payload")
+		}
+		switch header[0] {
+		case dataFrame:
+			messages = append(messages, payload)
+		case compressedFrame:
+			return nil, errors.New("compressed messages are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected frame type 0x%02x", header[0])
+		}
+	}
+}
+
+// Writer writes the frames of a response body in the format
+type Writer struct {
+	w io.Writer
+	f Format
+}
+
+// NewWriter creates a Writer of frames to w
+func NewWriter(w io.Writer, f Format) *Writer {
+	return &Writer{w: w, f: f}
+}
+
+// WriteMessage writes a data frame of the message
+func (w *Writer) WriteMessage(b []byte) error {
+	return w.writeFrame(dataFrame, b)
+}
+
+// WriteTrailer writes the trailer frame, which carries the trailer metadata in the form of HTTP/1 headers
+func (w *Writer) WriteTrailer(md grpc_metadata.MD) error {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		for _, v := range md[k] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", strings.ToLower(k), v)
+		}
+	}
+	return w.writeFrame(trailerFrame, buf.Bytes())
+}
+
+func (w *Writer) writeFrame(typ byte, payload []byte) error {
+	frame := make([]byte, frameHeaderLen+len(payload))
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[frameHeaderLen:], payload)
+	if w.f == Text {
+		// each frame is encoded separately, so that it can be decoded as soon as it arrives
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(frame)))
+		base64.StdEncoding.Encode(encoded, frame)
+		frame = encoded
+	}
+	_, err := w.w.Write(frame)
+	return err
+}
+
+// textReader decodes base64 text, which may be the concatenation of separately padded chunks
+type textReader struct {
+	r       *bufio.Reader
+	quantum []byte
+	decoded []byte
+	err     error
+}
+
+func newTextReader(r io.Reader) *textReader {
+	return &textReader{r: bufio.NewReader(r)}
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for len(t.decoded) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		if err := t.fill(); err != nil {
+			t.err = err
+		}
+	}
+	n := copy(p, t.decoded)
+	t.decoded = t.decoded[n:]
+	return n, nil
+}
+
+// fill decodes the next quantum of four characters, skipping whitespace
+func (t *textReader) fill() error {
+	for len(t.quantum) < 4 {
+		c, err := t.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(t.quantum) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		t.quantum = append(t.quantum, c)
+	}
+	decoded := make([]byte, 3)
+	n, err := base64.StdEncoding.Decode(decoded, t.quantum)
+	t.quantum = t.quantum[:0]
+	if err != nil {
+		return errors.Wrap(err, "invalid base64 text")
+	}
+	t.decoded = decoded[:n]
+	return nil
+}
+
+// excludedHeaders are the request headers which are not forwarded as metadata,
+// because they concern the HTTP/1 transport or the proxy rather than the call
+var excludedHeaders = map[string]struct{}{
+	"accept":            {},
+	"accept-encoding":   {},
+	"accept-language":   {},
+	"connection":        {},
+	"content-length":    {},
+	"content-type":      {},
+	"cookie":            {},
+	"grpc-timeout":      {},
+	"host":              {},
+	"origin":            {},
+	"referer":           {},
+	"te":                {},
+	"transfer-encoding": {},
+	"user-agent":        {},
+	"x-access-token":    {},
+	"x-grpc-web":        {},
+	"x-user-agent":      {},
+}
+
+// MetadataFromHeaders converts the headers of a gRPC-Web request into metadata.
+// gRPC-Web clients send metadata as plain headers, so all headers other than excludedHeaders are converted.
+func MetadataFromHeaders(h map[string][]string) metadata.Metadata {
+	return metadata.MetadataFromRawHeaders(h, excludedHeaders)
+}
+
+// EncodeMessage percent-encodes the grpc-message of a status
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#responses
+func EncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
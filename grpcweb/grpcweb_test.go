@@ -0,0 +1,152 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	"github.com/mercari/grpc-http-proxy/metadata"
+)
+
+func TestFormatOf(t *testing.T) {
+	cases := []struct {
+		contentType string
+		format      Format
+	}{
+		{"application/grpc-web", Binary},
+		{"application/grpc-web+proto", Binary},
+		{"application/grpc-web-text", Text},
+		{"application/grpc-web-text+proto; charset=utf-8", Text},
+		{"application/grpc", Unknown},
+		{"application/json", Unknown},
+		{"", Unknown},
+	}
+	for _, tc := range cases {
+		t.Run(tc.contentType, func(t *testing.T) {
+			if got, want := FormatOf(tc.contentType), tc.format; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestReadMessages(t *testing.T) {
+	frames := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 'a', 0x00, 0x00, 0x00, 0x00, 0x02, 'b', 'c'}
+	cases := []struct {
+		name       string
+		body       string
+		format     Format
+		messages   [][]byte
+		errorIsNil bool
+	}{
+		{
+			name:       "binary",
+			body:       string(frames),
+			format:     Binary,
+			messages:   [][]byte{[]byte("a"), []byte("bc")},
+			errorIsNil: true,
+		},
+		{
+			name:       "text",
+			body:       base64.StdEncoding.EncodeToString(frames),
+			format:     Text,
+			messages:   [][]byte{[]byte("a"), []byte("bc")},
+			errorIsNil: true,
+		},
+		{
+			name:       "text in padded chunks",
+			body:       base64.StdEncoding.EncodeToString(frames[:6]) + "\r\n" + base64.StdEncoding.EncodeToString(frames[6:]),
+			format:     Text,
+			messages:   [][]byte{[]byte("a"), []byte("bc")},
+			errorIsNil: true,
+		},
+		{
+			name:       "empty",
+			body:       "",
+			format:     Binary,
+			messages:   nil,
+			errorIsNil: true,
+		},
+		{
+			name:       "truncated",
+			body:       string(frames[:8]),
+			format:     Binary,
+			errorIsNil: false,
+		},
+		{
+			name:       "compressed",
+			body:       string([]byte{0x01, 0x00, 0x00, 0x00, 0x01, 'a'}),
+			format:     Binary,
+			errorIsNil: false,
+		},
+		{
+			name:       "invalid base64",
+			body:       "!!!!",
+			format:     Text,
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := ReadMessages(strings.NewReader(tc.body), tc.format)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if got, want := messages, tc.messages; err == nil && !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Binary)
+	if err := w.WriteMessage([]byte("a")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := w.WriteTrailer(grpc_metadata.Pairs("grpc-status", "0", "Foo", "bar")); err != nil {
+		t.Fatal(err.Error())
+	}
+	trailer := "foo: bar\r\ngrpc-status: 0\r\n"
+	expected := append([]byte{0x00, 0x00, 0x00, 0x00, 0x01, 'a', 0x80, 0x00, 0x00, 0x00, byte(len(trailer))}, trailer...)
+	if got, want := buf.Bytes(), expected; !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	w = NewWriter(&buf, Text)
+	if err := w.WriteMessage([]byte("a")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := buf.String(), base64.StdEncoding.EncodeToString(expected[:6]); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestMetadataFromHeaders(t *testing.T) {
+	h := map[string][]string{
+		"Authorization":  {"Bearer foo"},
+		"X-Custom":       {"a", "b"},
+		"Content-Type":   {"application/grpc-web"},
+		"X-Access-Token": {"secret"},
+		"X-Grpc-Web":     {"1"},
+	}
+	expected := metadata.Metadata{
+		"authorization": {"Bearer foo"},
+		"x-custom":      {"a", "b"},
+	}
+	if got, want := MetadataFromHeaders(h), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	if got, want := EncodeMessage("not found: 100%\n"), "not found: 100%25%0A"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy"
+)
+
+const (
+	defaultBatchParallelism = 10
+	defaultBatchMaxItems    = 100
+)
+
+// batchItem is a call in a batch request
+type batchItem struct {
+	Service  string            `json:"service"`
+	Method   string            `json:"method"`
+	Version  string            `json:"version,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Body     json.RawMessage   `json:"body,omitempty"`
+}
+
+// batchResult is the result of a call in a batch request.
+// Body is the response of the call if it succeeded, and Error is the error in the same format as single calls otherwise.
+type batchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// BatchHandler handles requests for making multiple gRPC calls at once.
+// The request body is a JSON array of calls, which are made concurrently up to the parallelism limit,
+// and the response body is a JSON array of their results in the same order.
+func (s *Server) BatchHandler(newClient func() Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var items []*batchItem
+		err := json.NewDecoder(r.Body).Decode(&items)
+		defer r.Body.Close()
+		if err != nil {
+			s.returnError(w, &perrors.ProxyError{
+				Code:    perrors.MessageTypeMismatch,
+				Message: fmt.Sprintf("batch request body must be a JSON array of calls: %s", err.Error()),
+			})
+			return
+		}
+		if err := s.validateBatch(items); err != nil {
+			s.returnError(w, err)
+			return
+		}
+		requested, err := requestedTimeout(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		jsonOptions, err := s.requestedJSONOptions(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		opts := []proxy.CallOption{proxy.WithJSONOptions(jsonOptions)}
+		dryRun, err := requestedDryRun(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		results := make([]*batchResult, len(items))
+		parallelism := s.batch.Parallelism
+		if parallelism < 1 {
+			parallelism = 1
+		}
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, item := range items {
+			i, item := i, item
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				md := metadata.MetadataFromHeaders(r.Header)
+				for k, v := range item.Metadata {
+					md[strings.ToLower(k)] = []string{v}
+				}
+				ctx := grpc_metadata.NewOutgoingContext(r.Context(), grpc_metadata.MD(md))
+				c := callee{
+					ServiceVersion: item.Version,
+					Service:        item.Service,
+					Method:         item.Method,
+				}
+				response, _, err := s.invoke(ctx, newClient, c, requested, dryRun, item.input(), opts...)
+				if err != nil {
+					s.logCallError(err)
+				}
+				results[i] = s.newBatchResult(response, err)
+			}()
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", jsonContentType)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// validateBatch checks that the batch is within the limit, and that each call has its service and method
+func (s *Server) validateBatch(items []*batchItem) perrors.Error {
+	if len(items) > s.batch.MaxItems {
+		return &perrors.ProxyError{
+			Code:    perrors.MessageTypeMismatch,
+			Message: fmt.Sprintf("a batch can contain at most %d calls", s.batch.MaxItems),
+		}
+	}
+	for i, item := range items {
+		if item == nil || item.Service == "" || item.Method == "" {
+			return &perrors.ProxyError{
+				Code:    perrors.MessageTypeMismatch,
+				Message: fmt.Sprintf("call %d in the batch must have its service and method", i),
+			}
+		}
+	}
+	return nil
+}
+
+// input returns the input message of the call, which is empty if the body is omitted
+func (i *batchItem) input() []byte {
+	if len(i.Body) == 0 || bytes.Equal(i.Body, []byte("null")) {
+		return []byte("{}")
+	}
+	return i.Body
+}
+
+// newBatchResult creates the result of a call from its response and error
+func (s *Server) newBatchResult(response []byte, err error) *batchResult {
+	if err == nil {
+		return &batchResult{
+			Status: http.StatusOK,
+			Body:   response,
+		}
+	}
+	perr, ok := errors.Cause(err).(perrors.Error)
+	if !ok {
+		perr = &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: err.Error(),
+		}
+	}
+	var buf bytes.Buffer
+	s.errorFormatter.WriteJSON(&buf, perr)
+	return &batchResult{
+		Status: s.errorFormatter.HTTPStatusCode(perr),
+		Error:  bytes.TrimSpace(buf.Bytes()),
+	}
+}
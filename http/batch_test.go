@@ -0,0 +1,102 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestServer_BatchHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		err    error
+		status int
+		resp   string
+	}{
+		{
+			name:   "success",
+			method: http.MethodPost,
+			body: `[{"service":"svc","method":"first","body":{}},` +
+				`{"service":"svc","method":"second","version":"v1","metadata":{"X-Foo":"bar"}},` +
+				`{"service":"svc","method":"third"}]`,
+			status: http.StatusOK,
+			resp: `[{"status":200,"body":{"serviceVersion":"","service":"svc","method":"first"}},` +
+				`{"status":200,"body":{"serviceVersion":"v1","service":"svc","method":"second"}},` +
+				`{"status":200,"body":{"serviceVersion":"","service":"svc","method":"third"}}]` + "\n",
+		},
+		{
+			name:   "errors",
+			method: http.MethodPost,
+			body:   `[{"service":"svc","method":"first"}]`,
+			err:    &perrors.GRPCError{StatusCode: int(codes.NotFound), Message: "not found"},
+			status: http.StatusOK,
+			resp:   `[{"status":404,"error":{"code":5,"error_code":"NOT_FOUND","message":"not found"}}]` + "\n",
+		},
+		{
+			name:   "empty",
+			method: http.MethodPost,
+			body:   `[]`,
+			status: http.StatusOK,
+			resp:   "[]\n",
+		},
+		{
+			name:   "missing method",
+			method: http.MethodPost,
+			body:   `[{"service":"svc"}]`,
+			status: http.StatusBadRequest,
+			resp:   `{"status":400,"error_code":"MESSAGE_TYPE_MISMATCH","message":"call 0 in the batch must have its service and method"}` + "\n",
+		},
+		{
+			name:   "too many calls",
+			method: http.MethodPost,
+			body:   `[{"service":"svc","method":"a"},{"service":"svc","method":"b"},{"service":"svc","method":"c"},{"service":"svc","method":"d"}]`,
+			status: http.StatusBadRequest,
+			resp:   `{"status":400,"error_code":"MESSAGE_TYPE_MISMATCH","message":"a batch can contain at most 3 calls"}` + "\n",
+		},
+		{
+			name:   "not an array",
+			method: http.MethodPost,
+			body:   `{"service":"svc","method":"first"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard(), WithBatchLimits(&config.Batch{Parallelism: 2, MaxItems: 3}))
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newClient := func() Client {
+				c := newFakeClient(t)
+				c.err = tc.err
+				return c
+			}
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/v1/batch", strings.NewReader(tc.body))
+			handlerF := server.BatchHandler(newClient)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.resp == "" {
+				return
+			}
+			if got, want := rr.Body.String(), tc.resp; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
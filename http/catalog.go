@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mercari/grpc-http-proxy/auth"
+)
+
+// catalogService is a discovered gRPC service in the catalog
+type catalogService struct {
+	Service  string           `json:"service"`
+	Versions []string         `json:"versions"`
+	Methods  []*catalogMethod `json:"methods,omitempty"`
+}
+
+// catalogMethod is a method of a gRPC service in the catalog
+type catalogMethod struct {
+	Name            string `json:"name"`
+	InputType       string `json:"inputType"`
+	OutputType      string `json:"outputType"`
+	ClientStreaming bool   `json:"clientStreaming"`
+	ServerStreaming bool   `json:"serverStreaming"`
+}
+
+// CatalogHandler handles GET requests for /v1/, which lists the discovered services and their versions,
+// and for /v1/<service>, which lists the methods of the service obtained through reflection.
+// Other requests, including those for services which are not discovered, are passed to next.
+func (s *Server) CatalogHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		services := s.discoverer.Services()
+		if r.URL.Path == "/v1/" {
+			writeCatalog(w, listCatalog(allowedServices(r.Context(), services)))
+			return
+		}
+		service := strings.TrimPrefix(r.URL.Path, "/v1/")
+		versions, ok := services[service]
+		if !ok || strings.Contains(service, "/") {
+			next(w, r)
+			return
+		}
+		version, err := requestedVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requested, err := requestedTimeout(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c := callee{
+			ServiceVersion: version,
+			Service:        service,
+		}
+		e, err := s.describeService(r.Context(), newClient, c, requested)
+		if err != nil {
+			s.logCallError(err)
+			s.returnError(w, proxyError(err))
+			return
+		}
+
+		cs := &catalogService{
+			Service:  service,
+			Versions: versions,
+			Methods:  []*catalogMethod{},
+		}
+		for _, md := range e.sd.GetMethods() {
+			cs.Methods = append(cs.Methods, &catalogMethod{
+				Name:            md.GetName(),
+				InputType:       md.GetInputType().GetFullyQualifiedName(),
+				OutputType:      md.GetOutputType().GetFullyQualifiedName(),
+				ClientStreaming: md.IsClientStreaming(),
+				ServerStreaming: md.IsServerStreaming(),
+			})
+		}
+		writeCatalog(w, cs)
+	}
+}
+
+// allowedServices filters the services and their versions by the identity of the request, if any
+func allowedServices(ctx context.Context, services map[string][]string) map[string][]string {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return services
+	}
+	allowed := make(map[string][]string, len(services))
+	for svc, versions := range services {
+		for _, v := range versions {
+			if id.Allows(svc, "", v) {
+				allowed[svc] = append(allowed[svc], v)
+			}
+		}
+	}
+	return allowed
+}
+
+// listCatalog lists the discovered services and their versions, sorted by the names of the services
+func listCatalog(services map[string][]string) interface{} {
+	list := make([]*catalogService, 0, len(services))
+	for svc, versions := range services {
+		list = append(list, &catalogService{
+			Service:  svc,
+			Versions: versions,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Service < list[j].Service
+	})
+	return struct {
+		Services []*catalogService `json:"services"`
+	}{
+		Services: list,
+	}
+}
+
+func writeCatalog(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/pkg/errors"
+
+	"github.com/mercari/grpc-http-proxy/auth"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestServer_CatalogHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		resp   string
+	}{
+		{
+			name:   "services",
+			method: http.MethodGet,
+			path:   "/v1/",
+			status: http.StatusOK,
+			resp: `{"services":[{"service":"a.Library","versions":[""]},` +
+				`{"service":"b.Shelf","versions":["v1","v2"]}]}` + "\n",
+		},
+		{
+			name:   "methods",
+			method: http.MethodGet,
+			path:   "/v1/a.Library",
+			status: http.StatusOK,
+			resp: `{"service":"a.Library","versions":[""],"methods":[{"name":"GetBook",` +
+				`"inputType":"a.Book","outputType":"a.Book","clientStreaming":false,"serverStreaming":false}]}` + "\n",
+		},
+		{
+			name:   "service not found upstream",
+			method: http.MethodGet,
+			path:   "/v1/b.Shelf?version=v1",
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "service not discovered",
+			method: http.MethodGet,
+			path:   "/v1/c.Unknown",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "call",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/GetBook",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "not GET",
+			method: http.MethodPost,
+			path:   "/v1/",
+			status: http.StatusTeapot,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {""},
+		"b.Shelf":   {"v1", "v2"},
+	}
+	server := New("foo", d, log.NewDiscard())
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			handlerF := server.CatalogHandler(newClient, next)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.resp == "" {
+				return
+			}
+			if got, want := rr.Body.String(), tc.resp; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// failingDescribeClient is a client whose reflection fails with an error which is not of the proxy
+type failingDescribeClient struct {
+	*fakeClient
+}
+
+func (c *failingDescribeClient) DescribeService(ctx context.Context, serviceName string) (*desc.ServiceDescriptor, error) {
+	return nil, errors.New("reflection failed")
+}
+
+func TestServer_CatalogHandlerUnknownError(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {""},
+	}
+	server := New("foo", d, log.NewDiscard())
+	newClient := func() Client {
+		return &failingDescribeClient{fakeClient: newFakeClient(t)}
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	rr := httptest.NewRecorder()
+	server.CatalogHandler(newClient, next)(rr, httptest.NewRequest(http.MethodGet, "/v1/a.Library", nil))
+	if got, want := rr.Result().StatusCode, http.StatusInternalServerError; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestAllowedServices(t *testing.T) {
+	services := map[string][]string{
+		"a.Library": {""},
+		"b.Shelf":   {"v1", "v2"},
+	}
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want map[string][]string
+	}{
+		{
+			name: "no identity",
+			ctx:  context.Background(),
+			want: services,
+		},
+		{
+			name: "allowed services",
+			ctx:  auth.NewContext(context.Background(), &auth.Identity{Name: "shelf", Services: []string{"b.*"}}),
+			want: map[string][]string{"b.Shelf": {"v1", "v2"}},
+		},
+		{
+			name: "allowed versions",
+			ctx:  auth.NewContext(context.Background(), &auth.Identity{Name: "v1", Versions: []string{"v1"}}),
+			want: map[string][]string{"b.Shelf": {"v1"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := allowedServices(tc.ctx, services), tc.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	"github.com/mercari/grpc-http-proxy/connect"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy"
+)
+
+// ConnectHandler handles Connect protocol requests for /<package.Service>/<Method>, and passes other requests to next.
+// Unary requests are recognized by the Connect-Protocol-Version header, or by the "connect" query parameter of GET requests,
+// and server-streaming requests by their content type.
+func (s *Server) ConnectHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isConnectRequest(r) {
+			next(w, r)
+			return
+		}
+		parts := strings.Split(r.URL.Path, "/")
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		codec, streaming, ok := connectCodec(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		version, err := requestedVersion(r)
+		if err != nil {
+			writeConnectError(w, invalidConnectRequest(err))
+			return
+		}
+		if v := r.Header.Get(connect.ProtocolVersionHeader); v != "" && v != "1" {
+			writeConnectError(w, invalidConnectRequest(fmt.Errorf("unsupported protocol version %s", v)))
+			return
+		}
+		requested, err := connect.ParseTimeout(r.Header.Get(connect.TimeoutHeader))
+		if err != nil {
+			writeConnectError(w, invalidConnectRequest(err))
+			return
+		}
+		inputMessage, err := readConnectMessage(r, streaming)
+		defer r.Body.Close()
+		if err != nil {
+			writeConnectError(w, invalidConnectRequest(err))
+			return
+		}
+
+		c := callee{
+			ServiceVersion: version,
+			Service:        parts[1],
+			Method:         parts[2],
+		}
+		ctx := grpc_metadata.NewOutgoingContext(r.Context(),
+			grpc_metadata.MD(connect.MetadataFromHeaders(r.Header)))
+		conn, err := s.connectUpstream(ctx, newClient, c, requested)
+		if err != nil {
+			s.logCallError(err)
+			if streaming {
+				writeConnectEndStream(w, codec, false, err)
+			} else {
+				writeConnectError(w, err)
+			}
+			return
+		}
+		defer conn.close()
+
+		var opts []proxy.CallOption
+		if codec == connect.Proto {
+			opts = append(opts, proxy.WithProtoInput(), proxy.WithProtoOutput())
+		}
+		if streaming {
+			s.connectServerStream(w, conn, c, codec, inputMessage, opts...)
+			return
+		}
+		s.connectUnary(w, conn, c, codec, inputMessage, opts...)
+	}
+}
+
+// connectUnary makes the unary call and writes the response as a Connect unary response
+func (s *Server) connectUnary(w http.ResponseWriter,
+	conn *connection,
+	c callee,
+	codec connect.Codec,
+	inputMessage []byte,
+	opts ...proxy.CallOption,
+) {
+	md := make(metadata.Metadata)
+	var attempts int
+	opts = append([]proxy.CallOption{
+		proxy.WithRetry(s.retryPolicy(conn.config), s.retryBudget(conn.upstream)),
+		proxy.Attempts(&attempts),
+	}, opts...)
+	response, err := conn.client.Call(conn.ctx, c.Service, c.Method, inputMessage, &md, opts...)
+	s.record(conn, err)
+	if attempts > 0 {
+		w.Header().Set(attemptsHeader, strconv.Itoa(attempts))
+	}
+	if err != nil {
+		s.logCallError(err)
+		writeConnectError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType(false))
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// connectServerStream makes the server-streaming call and writes each response message in an envelope,
+// followed by the end of the stream which carries the error of the call if any
+func (s *Server) connectServerStream(w http.ResponseWriter,
+	conn *connection,
+	c callee,
+	codec connect.Codec,
+	inputMessage []byte,
+	opts ...proxy.CallOption,
+) {
+	wroteHeader := false
+	recv := func(b []byte) error {
+		if !wroteHeader {
+			w.Header().Set("Content-Type", codec.ContentType(true))
+			w.WriteHeader(http.StatusOK)
+			wroteHeader = true
+		}
+		if err := connect.WriteEnvelope(w, b); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+	md := make(metadata.Metadata)
+	err := conn.client.CallServerStream(conn.ctx, c.Service, c.Method, inputMessage, &md, recv, opts...)
+	s.record(conn, err)
+	if err != nil {
+		s.logCallError(err)
+	}
+	writeConnectEndStream(w, codec, wroteHeader, err)
+}
+
+// isConnectRequest reports whether the request is a Connect unary or streaming request
+func isConnectRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet:
+		return r.URL.Query().Get("connect") == "v1"
+	case http.MethodPost:
+		if _, streaming, ok := connect.ParseContentType(r.Header.Get("Content-Type")); ok && streaming {
+			return true
+		}
+		return r.Header.Get(connect.ProtocolVersionHeader) != ""
+	}
+	return false
+}
+
+// connectCodec returns the codec of the request, and whether it is a streaming request
+func connectCodec(r *http.Request) (connect.Codec, bool, bool) {
+	if r.Method == http.MethodGet {
+		switch codec := connect.Codec(r.URL.Query().Get("encoding")); codec {
+		case connect.JSON, connect.Proto:
+			return codec, false, true
+		}
+		return "", false, false
+	}
+	return connect.ParseContentType(r.Header.Get("Content-Type"))
+}
+
+// readConnectMessage reads the input message from the request.
+// Messages of GET requests are in the "message" query parameter, optionally encoded in URL-safe base64.
+func readConnectMessage(r *http.Request, streaming bool) ([]byte, error) {
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		if c := q.Get("compression"); c != "" && c != "identity" {
+			return nil, fmt.Errorf("unsupported compression %s", c)
+		}
+		message := q.Get("message")
+		if q.Get("base64") != "1" {
+			return []byte(message), nil
+		}
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(message, "="))
+	}
+	if streaming {
+		if e := r.Header.Get("Connect-Content-Encoding"); e != "" && e != "identity" {
+			return nil, fmt.Errorf("unsupported content encoding %s", e)
+		}
+		return connect.ReadEnvelope(r.Body)
+	}
+	var body io.Reader = r.Body
+	switch e := r.Header.Get("Content-Encoding"); e {
+	case "", "identity":
+	case "gzip":
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		body = gr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", e)
+	}
+	return ioutil.ReadAll(body)
+}
+
+// invalidConnectRequest converts a malformed request into the error returned to the client
+func invalidConnectRequest(err error) error {
+	return &perrors.GRPCError{
+		StatusCode: int(codes.InvalidArgument),
+		Message:    fmt.Sprintf("invalid Connect request: %s", err.Error()),
+	}
+}
+
+// connectError converts the error of a call into its JSON representation in the Connect protocol
+func connectError(err error) (*connect.Error, codes.Code) {
+	st := statusOf(err)
+	code := codes.Code(st.Code)
+	return connect.NewError(code, st.Message, st.Details), code
+}
+
+// writeConnectError writes the error as a Connect unary response
+func writeConnectError(w http.ResponseWriter, err error) {
+	e, code := connectError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(connect.HTTPStatusCode(code))
+	json.NewEncoder(w).Encode(e)
+}
+
+// writeConnectEndStream writes the end of a Connect stream, which carries the error if any.
+// Streaming responses always have the status 200, so the header is written here if no message was written.
+func writeConnectEndStream(w http.ResponseWriter, codec connect.Codec, wroteHeader bool, err error) {
+	if !wroteHeader {
+		w.Header().Set("Content-Type", codec.ContentType(true))
+		w.WriteHeader(http.StatusOK)
+	}
+	end := &connect.EndStream{}
+	if err != nil {
+		end.Error, _ = connectError(err)
+	}
+	connect.WriteEndStream(w, end)
+}
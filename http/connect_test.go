@@ -0,0 +1,185 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/connect"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func connectEnvelopes(t *testing.T, messages []string, end *connect.EndStream) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range messages {
+		if err := connect.WriteEnvelope(&buf, []byte(m)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if end != nil {
+		if err := connect.WriteEndStream(&buf, end); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestServer_ConnectHandler(t *testing.T) {
+	cases := []struct {
+		name            string
+		method          string
+		path            string
+		contentType     string
+		protocolVersion string
+		body            []byte
+		err             error
+		status          int
+		respType        string
+		resp            []byte
+	}{
+		{
+			name:            "unary",
+			method:          http.MethodPost,
+			path:            "/svc/method?version=v1",
+			contentType:     "application/json",
+			protocolVersion: "1",
+			body:            []byte(`{}`),
+			status:          http.StatusOK,
+			respType:        "application/json",
+			resp:            []byte("{\"serviceVersion\":\"v1\",\"service\":\"svc\",\"method\":\"method\"}\n"),
+		},
+		{
+			name:     "unary GET",
+			method:   http.MethodGet,
+			path:     "/svc/method?connect=v1&encoding=json&message=%7B%7D",
+			status:   http.StatusOK,
+			respType: "application/json",
+			resp:     []byte("{\"serviceVersion\":\"\",\"service\":\"svc\",\"method\":\"method\"}\n"),
+		},
+		{
+			name:            "unary error",
+			method:          http.MethodPost,
+			path:            "/svc/method",
+			contentType:     "application/json",
+			protocolVersion: "1",
+			body:            []byte(`{}`),
+			err:             &perrors.GRPCError{StatusCode: int(codes.NotFound), Message: "not found"},
+			status:          http.StatusNotFound,
+			respType:        "application/json",
+			resp:            []byte("{\"code\":\"not_found\",\"message\":\"not found\"}\n"),
+		},
+		{
+			name:            "unary proxy error",
+			method:          http.MethodPost,
+			path:            "/svc/method",
+			contentType:     "application/json",
+			protocolVersion: "1",
+			body:            []byte(`{}`),
+			err:             &perrors.ProxyError{Code: perrors.MethodNotFound, Message: "no method"},
+			status:          http.StatusNotImplemented,
+			respType:        "application/json",
+			resp:            []byte("{\"code\":\"unimplemented\",\"message\":\"no method\"}\n"),
+		},
+		{
+			name:            "unsupported protocol version",
+			method:          http.MethodPost,
+			path:            "/svc/method",
+			contentType:     "application/json",
+			protocolVersion: "2",
+			body:            []byte(`{}`),
+			status:          http.StatusBadRequest,
+			respType:        "application/json",
+			resp:            []byte("{\"code\":\"invalid_argument\",\"message\":\"invalid Connect request: unsupported protocol version 2\"}\n"),
+		},
+		{
+			name:        "server streaming",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/connect+json",
+			body:        connectEnvelopes(t, []string{`{}`}, nil),
+			status:      http.StatusOK,
+			respType:    "application/connect+json",
+			resp: connectEnvelopes(t,
+				[]string{`{"serviceVersion":"","service":"svc","method":"method"}`},
+				&connect.EndStream{}),
+		},
+		{
+			name:        "server streaming error",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/connect+json",
+			body:        connectEnvelopes(t, []string{`{}`}, nil),
+			err:         &perrors.GRPCError{StatusCode: int(codes.Unavailable), Message: "unavailable"},
+			status:      http.StatusOK,
+			respType:    "application/connect+json",
+			resp: connectEnvelopes(t, nil, &connect.EndStream{
+				Error: connect.NewError(codes.Unavailable, "unavailable", nil),
+			}),
+		},
+		{
+			name:            "unsupported content type",
+			method:          http.MethodPost,
+			path:            "/svc/method",
+			contentType:     "text/plain",
+			protocolVersion: "1",
+			status:          http.StatusUnsupportedMediaType,
+			resp:            []byte{},
+		},
+		{
+			name:            "invalid path",
+			method:          http.MethodPost,
+			path:            "/v1/svc/method",
+			contentType:     "application/json",
+			protocolVersion: "1",
+			status:          http.StatusNotFound,
+			resp:            []byte{},
+		},
+		{
+			name:        "not Connect",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/json",
+			status:      http.StatusTeapot,
+			resp:        []byte{},
+		},
+	}
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard())
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newClient := func() Client {
+				c := newFakeClient(t)
+				c.err = tc.err
+				return c
+			}
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.protocolVersion != "" {
+				req.Header.Set(connect.ProtocolVersionHeader, tc.protocolVersion)
+			}
+			handlerF := server.ConnectHandler(newClient, next)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if got, want := rr.Result().Header.Get("Content-Type"), tc.respType; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := rr.Body.Bytes(), tc.resp; !bytes.Equal(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
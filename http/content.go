@@ -0,0 +1,64 @@
+package http
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const jsonContentType = "application/json"
+
+// protoContentTypes are the media types of messages in the protobuf wire format
+var protoContentTypes = map[string]struct{}{
+	"application/x-protobuf": {},
+	"application/protobuf":   {},
+}
+
+// isProtoContentType checks if the media type of the Content-Type header is one of protoContentTypes.
+// Any other media type, including none, is treated as JSON.
+func isProtoContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := protoContentTypes[mediaType]
+	return ok
+}
+
+// responseContentType negotiates the content type of the response from the Accept header.
+// The media type with the highest quality among JSON and protobuf is selected, and the first one listed wins ties.
+// JSON is selected if neither is acceptable.
+func responseContentType(accept string) string {
+	best, bestQ := jsonContentType, -1.0
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		var ct string
+		switch {
+		case mediaType == jsonContentType:
+			ct = jsonContentType
+		case isProtoContentType(mediaType):
+			ct = mediaType
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = ct, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"testing"
+)
+
+func TestIsProtoContentType(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"application/x-protobuf", true},
+		{"application/protobuf; proto=grpc.testing.Payload", true},
+		{"application/json", false},
+		{"application/x-www-form-urlencoded", false},
+		{"", false},
+		{"invalid;", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.contentType, func(t *testing.T) {
+			if got, want := isProtoContentType(tc.contentType), tc.expected; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestResponseContentType(t *testing.T) {
+	cases := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{
+			name:     "none",
+			accept:   "",
+			expected: "application/json",
+		},
+		{
+			name:     "any",
+			accept:   "*/*",
+			expected: "application/json",
+		},
+		{
+			name:     "protobuf",
+			accept:   "application/x-protobuf",
+			expected: "application/x-protobuf",
+		},
+		{
+			name:     "first one listed",
+			accept:   "application/protobuf, application/json",
+			expected: "application/protobuf",
+		},
+		{
+			name:     "quality",
+			accept:   "application/x-protobuf;q=0.5, application/json",
+			expected: "application/json",
+		},
+		{
+			name:     "not acceptable",
+			accept:   "application/x-protobuf;q=0",
+			expected: "application/json",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := responseContentType(tc.accept), tc.expected; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/pkg/errors"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+)
+
+// descriptorCache caches the descriptors of services obtained through reflection, along with the documents generated from them.
+// The entries are keyed by the upstream and the service, and expire after ttl. Zero ttl disables caching.
+// The message types which upstreams resolve for Any fields are cached for ttl as well.
+type descriptorCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*descriptorEntry
+	types   map[string]*reflection.TypeCache
+}
+
+// descriptorEntry is the descriptor of a service in the cache
+type descriptorEntry struct {
+	sd      *desc.ServiceDescriptor
+	expires time.Time
+	mu      sync.Mutex
+	docs    map[string][]byte
+}
+
+func newDescriptorCache(ttl time.Duration) *descriptorCache {
+	return &descriptorCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*descriptorEntry),
+		types:   make(map[string]*reflection.TypeCache),
+	}
+}
+
+// typeCache returns the cache of the message types resolved by the upstream, or nil if caching is disabled
+func (c *descriptorCache) typeCache(upstream *url.URL) *reflection.TypeCache {
+	if c.ttl <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := upstream.String()
+	tc, ok := c.types[key]
+	if !ok {
+		tc = reflection.NewTypeCache(c.ttl)
+		c.types[key] = tc
+	}
+	return tc
+}
+
+// get returns the entry of the key, or nil if there is no entry or it has expired
+func (c *descriptorCache) get(key string) *descriptorEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e
+}
+
+// put stores the descriptor as the entry of the key, and returns the entry
+func (c *descriptorCache) put(key string, sd *desc.ServiceDescriptor) *descriptorEntry {
+	e := &descriptorEntry{
+		sd:   sd,
+		docs: make(map[string][]byte),
+	}
+	if c.ttl <= 0 {
+		return e
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.expires = c.now().Add(c.ttl)
+	c.entries[key] = e
+	return e
+}
+
+// document returns the document named name generated from the descriptor,
+// which is generated on the first request and cached for the lifetime of the entry
+func (e *descriptorEntry) document(name string, generate func(*desc.ServiceDescriptor) ([]byte, error)) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if doc, ok := e.docs[name]; ok {
+		return doc, nil
+	}
+	doc, err := generate(e.sd)
+	if err != nil {
+		return nil, err
+	}
+	e.docs[name] = doc
+	return doc, nil
+}
+
+// describeService obtains the descriptor of the service of the callee through reflection, or from the cache.
+// The upstream is resolved once, so that the descriptor is cached under the upstream it was obtained from.
+func (s *Server) describeService(ctx context.Context,
+	newClient func() Client,
+	c callee,
+	requested time.Duration,
+) (*descriptorEntry, error) {
+	if err := authorize(ctx, c); err != nil {
+		return nil, err
+	}
+	u, err := s.discoverer.Resolve(c.Service, c.ServiceVersion)
+	if err != nil {
+		return nil, err
+	}
+	key := u.String() + "/" + c.Service
+	if e := s.descriptors.get(key); e != nil {
+		return e, nil
+	}
+	conn, err := s.connect(ctx, newClient, u, c.Service, requested)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	sd, err := conn.client.DescribeService(conn.ctx, c.Service)
+	s.record(conn, err)
+	if err != nil {
+		return nil, err
+	}
+	return s.descriptors.put(key, sd), nil
+}
+
+// writeServiceDocument writes the document of the service, which generate creates from its descriptor and the requested version.
+// Errors of the proxy returned by generate are written in the same way as those of calls.
+// The document is cached along with the descriptor under its name and the version.
+func (s *Server) writeServiceDocument(w http.ResponseWriter,
+	r *http.Request,
+	newClient func() Client,
+	service, name string,
+	generate func(sd *desc.ServiceDescriptor, version string) ([]byte, error),
+) {
+	version, err := requestedVersion(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	requested, err := requestedTimeout(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c := callee{
+		ServiceVersion: version,
+		Service:        service,
+	}
+	e, err := s.describeService(r.Context(), newClient, c, requested)
+	if err != nil {
+		s.logCallError(err)
+		s.returnError(w, proxyError(err))
+		return
+	}
+	doc, err := e.document(name+"?version="+version, func(sd *desc.ServiceDescriptor) ([]byte, error) {
+		return generate(sd, version)
+	})
+	if err != nil {
+		s.logCallError(err)
+		if perr, ok := errors.Cause(err).(perrors.Error); ok {
+			s.returnError(w, perr)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc)
+}
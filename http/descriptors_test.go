@@ -0,0 +1,175 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/mercari/grpc-http-proxy/breaker"
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+// rotatingDiscoverer resolves services to its upstreams in turn, as load balancing across upstreams does
+type rotatingDiscoverer struct {
+	*fakeDiscoverer
+	upstreams []string
+	resolved  int
+}
+
+func (d *rotatingDiscoverer) Resolve(service, version string) (*url.URL, error) {
+	u := proxytest.ParseURL(d.t, d.upstreams[d.resolved%len(d.upstreams)])
+	d.resolved++
+	return u, nil
+}
+
+func TestDescriptorCache(t *testing.T) {
+	cases := []struct {
+		name   string
+		ttl    time.Duration
+		after  time.Duration
+		cached bool
+	}{
+		{
+			name:   "cached",
+			ttl:    time.Minute,
+			after:  time.Second,
+			cached: true,
+		},
+		{
+			name:   "expired",
+			ttl:    time.Minute,
+			after:  time.Minute,
+			cached: false,
+		},
+		{
+			name:   "disabled",
+			ttl:    0,
+			after:  0,
+			cached: false,
+		},
+	}
+	sd := newLibraryDescriptor(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			c := newDescriptorCache(tc.ttl)
+			c.now = func() time.Time {
+				return now
+			}
+			c.put("svc:5000/a.Library", sd)
+			now = now.Add(tc.after)
+			e := c.get("svc:5000/a.Library")
+			if got, want := e != nil, tc.cached; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestDescriptorEntry_Document(t *testing.T) {
+	e := newDescriptorCache(time.Minute).put("svc:5000/a.Library", newLibraryDescriptor(t))
+	var generated int
+	generate := func(sd *desc.ServiceDescriptor) ([]byte, error) {
+		generated++
+		return []byte(sd.GetFullyQualifiedName()), nil
+	}
+	for i := 0; i < 2; i++ {
+		doc, err := e.document("doc", generate)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if got, want := string(doc), "a.Library"; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+	if got, want := generated, 1; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestDescriptorCache_TypeCache(t *testing.T) {
+	u := proxytest.ParseURL(t, "svc:5000")
+	c := newDescriptorCache(time.Minute)
+	if got, want := c.typeCache(u), c.typeCache(u); got == nil || got != want {
+		t.Errorf("got %p, want the same cache %p for the upstream", got, want)
+	}
+	if other := c.typeCache(proxytest.ParseURL(t, "other:5000")); other == c.typeCache(u) {
+		t.Error("got the same cache for different upstreams")
+	}
+	if got := newDescriptorCache(0).typeCache(u); got != nil {
+		t.Errorf("got %p, want nil when caching is disabled", got)
+	}
+}
+
+func TestServer_DescribeService(t *testing.T) {
+	d := &rotatingDiscoverer{
+		fakeDiscoverer: newFakeDiscoverer(t),
+		upstreams:      []string{"one:5000", "two:5000"},
+	}
+	server := New("foo", d, log.NewDiscard(), WithDescriptorCacheTTL(time.Minute))
+	client := newFakeClient(t)
+	client.sd = newLibraryDescriptor(t)
+	newClient := func() Client {
+		return client
+	}
+
+	if _, err := server.describeService(context.Background(), newClient, callee{Service: "a.Library"}, 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := d.resolved, 1; got != want {
+		t.Errorf("got %d resolutions, want %d", got, want)
+	}
+	if got, want := client.service, "one"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if server.descriptors.get("one:5000/a.Library") == nil {
+		t.Error("got no descriptor cached under the upstream it was obtained from")
+	}
+}
+
+func TestServer_DescribeServiceCircuitHalfOpen(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {""},
+	}
+	b := breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Millisecond,
+	})
+	u := proxytest.ParseURL(t, "a.Library:5000")
+	b.Record(u, &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	time.Sleep(2 * time.Millisecond)
+	server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b))
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	rr := httptest.NewRecorder()
+	server.CatalogHandler(newClient, next)(rr, httptest.NewRequest(http.MethodGet, "/v1/a.Library", nil))
+	if got, want := rr.Result().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	// the trial call of the half-open circuit is not left in flight
+	if got, want := b.State(u), breaker.Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	rr = httptest.NewRecorder()
+	server.CatalogHandler(newClient, next)(rr, httptest.NewRequest(http.MethodGet, "/v1/a.Library", nil))
+	if got, want := rr.Result().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+// dialConfig returns the dial configuration for the upstream, which is the proxy-wide configuration with the upstream's overrides applied
+func (s *Server) dialConfig(uc *config.Upstream) *config.Dial {
+	d := config.Dial{}
+	if s.dial != nil {
+		d = *s.dial
+	}
+	if uc == nil {
+		return &d
+	}
+	o := uc.Dial
+	if o.KeepaliveTime > 0 {
+		d.KeepaliveTime = o.KeepaliveTime
+	}
+	if o.KeepaliveTimeout > 0 {
+		d.KeepaliveTimeout = o.KeepaliveTimeout
+	}
+	if o.KeepalivePermitWithoutStream {
+		d.KeepalivePermitWithoutStream = true
+	}
+	if o.MaxSendMsgSize > 0 {
+		d.MaxSendMsgSize = o.MaxSendMsgSize
+	}
+	if o.MaxRecvMsgSize > 0 {
+		d.MaxRecvMsgSize = o.MaxRecvMsgSize
+	}
+	if o.Compressor != "" {
+		d.Compressor = o.Compressor
+	}
+	if o.Authority != "" {
+		d.Authority = o.Authority
+	}
+	if o.UserAgent != "" {
+		d.UserAgent = o.UserAgent
+	}
+	return &d
+}
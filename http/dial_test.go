@@ -0,0 +1,76 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestServer_dialConfig(t *testing.T) {
+	base := &config.Dial{
+		KeepaliveTime:    time.Minute,
+		KeepaliveTimeout: 20 * time.Second,
+		MaxRecvMsgSize:   4194304,
+		UserAgent:        "grpc-http-proxy",
+	}
+	cases := []struct {
+		name     string
+		dial     *config.Dial
+		upstream *config.Upstream
+		expected *config.Dial
+	}{
+		{
+			name:     "proxy-wide configuration",
+			dial:     base,
+			upstream: &config.Upstream{},
+			expected: &config.Dial{
+				KeepaliveTime:    time.Minute,
+				KeepaliveTimeout: 20 * time.Second,
+				MaxRecvMsgSize:   4194304,
+				UserAgent:        "grpc-http-proxy",
+			},
+		},
+		{
+			name: "upstream overrides",
+			dial: base,
+			upstream: &config.Upstream{
+				Dial: config.Dial{
+					MaxRecvMsgSize: 16777216,
+					Compressor:     "gzip",
+					Authority:      "echo.example.com",
+				},
+			},
+			expected: &config.Dial{
+				KeepaliveTime:    time.Minute,
+				KeepaliveTimeout: 20 * time.Second,
+				MaxRecvMsgSize:   16777216,
+				Compressor:       "gzip",
+				Authority:        "echo.example.com",
+				UserAgent:        "grpc-http-proxy",
+			},
+		},
+		{
+			name: "no proxy-wide configuration",
+			dial: nil,
+			upstream: &config.Upstream{
+				Dial: config.Dial{Compressor: "gzip"},
+			},
+			expected: &config.Dial{Compressor: "gzip"},
+		},
+	}
+	d := newFakeDiscoverer(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := New("foo", d, log.NewDiscard(), WithDialConfig(tc.dial))
+			if got, want := server.dialConfig(tc.upstream), tc.expected; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+	if got, want := base.MaxRecvMsgSize, 4194304; got != want {
+		t.Fatalf("proxy-wide configuration was modified: got %d, want %d", got, want)
+	}
+}
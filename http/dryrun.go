@@ -0,0 +1,30 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const dryRunHeader = "X-Grpc-Proxy-Dry-Run"
+
+// requestedDryRun checks if the request is a dry run, which is requested with the "dry_run" query parameter,
+// or with the X-Grpc-Proxy-Dry-Run header. The query parameter without a value also enables it.
+// A dry run only builds the input message after performing reflection, and responds with it instead of invoking the RPC.
+func requestedDryRun(r *http.Request) (bool, error) {
+	v := r.Header.Get(dryRunHeader)
+	if q, ok := r.URL.Query()["dry_run"]; ok {
+		if len(q) != 1 {
+			return false, errors.New("multiple dry_run parameters specified")
+		}
+		v = q[0]
+		if v == "" {
+			return true, nil
+		}
+	}
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
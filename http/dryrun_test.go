@@ -0,0 +1,134 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestRequestedDryRun(t *testing.T) {
+	cases := []struct {
+		name       string
+		path       string
+		header     string
+		dryRun     bool
+		errorIsNil bool
+	}{
+		{
+			name:       "none",
+			path:       "/v1/svc/method",
+			dryRun:     false,
+			errorIsNil: true,
+		},
+		{
+			name:       "query parameter",
+			path:       "/v1/svc/method?dry_run=true",
+			dryRun:     true,
+			errorIsNil: true,
+		},
+		{
+			name:       "query parameter without value",
+			path:       "/v1/svc/method?dry_run",
+			dryRun:     true,
+			errorIsNil: true,
+		},
+		{
+			name:       "header",
+			path:       "/v1/svc/method",
+			header:     "true",
+			dryRun:     true,
+			errorIsNil: true,
+		},
+		{
+			name:       "query parameter over header",
+			path:       "/v1/svc/method?dry_run=false",
+			header:     "true",
+			dryRun:     false,
+			errorIsNil: true,
+		},
+		{
+			name:       "invalid",
+			path:       "/v1/svc/method?dry_run=maybe",
+			errorIsNil: false,
+		},
+		{
+			name:       "multiple query parameters",
+			path:       "/v1/svc/method?dry_run=true&dry_run=false",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(dryRunHeader, tc.header)
+			}
+			dryRun, err := requestedDryRun(req)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+			if got, want := dryRun, tc.dryRun; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_RPCCallHandlerDryRun(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{
+			name:        "dry run",
+			path:        "/v1/svc/method?dry_run=true",
+			status:      http.StatusOK,
+			contentType: jsonContentType,
+		},
+		{
+			name:        "dry run responds in JSON",
+			path:        "/v1/svc/method?dry_run=true",
+			accept:      "application/x-protobuf",
+			status:      http.StatusOK,
+			contentType: jsonContentType,
+		},
+		{
+			name:   "invalid",
+			path:   "/v1/svc/method?dry_run=maybe",
+			status: http.StatusBadRequest,
+		},
+	}
+	server := New("foo", newFakeDiscoverer(t), log.NewDiscard())
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader("{}"))
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			handlerF := server.RPCCallHandler(func() Client {
+				return newFakeClient(t)
+			})
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if got, want := rr.Result().Header.Get("Content-Type"), tc.contentType; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := rr.Result().Header.Get(dryRunHeader), "true"; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+const fieldMaskHeader = "X-Field-Mask"
+
+// requestedFieldMask returns the paths of the field mask requested with the "fields" query parameter,
+// or with the X-Field-Mask header. Paths are comma separated as in the JSON representation of google.protobuf.FieldMask.
+// nil is returned if no field mask is requested.
+func requestedFieldMask(r *http.Request) []string {
+	v := r.Header.Get(fieldMaskHeader)
+	if q, ok := r.URL.Query()["fields"]; ok {
+		v = strings.Join(q, ",")
+	}
+	var paths []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
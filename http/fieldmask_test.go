@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRequestedFieldMask(t *testing.T) {
+	cases := []struct {
+		name   string
+		path   string
+		header string
+		paths  []string
+	}{
+		{
+			name:  "none",
+			path:  "/v1/svc/method",
+			paths: nil,
+		},
+		{
+			name:  "query parameter",
+			path:  "/v1/svc/method?fields=name,user.displayName",
+			paths: []string{"name", "user.displayName"},
+		},
+		{
+			name:  "multiple query parameters",
+			path:  "/v1/svc/method?fields=name&fields=id",
+			paths: []string{"name", "id"},
+		},
+		{
+			name:   "header",
+			path:   "/v1/svc/method",
+			header: "name, user.display_name",
+			paths:  []string{"name", "user.display_name"},
+		},
+		{
+			name:   "query parameter over header",
+			path:   "/v1/svc/method?fields=id",
+			header: "name",
+			paths:  []string{"id"},
+		},
+		{
+			name:  "empty",
+			path:  "/v1/svc/method?fields=",
+			paths: nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(fieldMaskHeader, tc.header)
+			}
+			if got, want := requestedFieldMask(req), tc.paths; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
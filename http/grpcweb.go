@@ -0,0 +1,172 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/grpcweb"
+)
+
+// GRPCWebHandler handles gRPC-Web requests for /<package.Service>/<Method>, and passes other requests to next.
+// Messages are forwarded to the upstream as they are, so no reflection is performed.
+func (s *Server) GRPCWebHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := grpcweb.FormatOf(r.Header.Get("Content-Type"))
+		if format == grpcweb.Unknown {
+			next(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(r.URL.Path, "/")
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		version, err := requestedVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requested, err := requestedTimeout(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		gw := &grpcWebResponseWriter{
+			w:      w,
+			frames: grpcweb.NewWriter(w, format),
+			format: format,
+		}
+		requests, err := grpcweb.ReadMessages(r.Body, format)
+		defer r.Body.Close()
+		if err != nil {
+			gw.writeStatus(&perrors.ProxyError{
+				Code:    perrors.MessageTypeMismatch,
+				Message: fmt.Sprintf("invalid gRPC-Web request body: %s", err.Error()),
+			}, nil)
+			return
+		}
+
+		c := callee{
+			ServiceVersion: version,
+			Service:        parts[1],
+			Method:         parts[2],
+		}
+		conn, err := s.connectUpstream(r.Context(), newClient, c, requested)
+		if err != nil {
+			s.logCallError(err)
+			gw.writeStatus(err, nil)
+			return
+		}
+		defer conn.close()
+
+		md := grpcweb.MetadataFromHeaders(r.Header)
+		trailer, err := conn.client.Forward(conn.ctx, "/"+c.Service+"/"+c.Method, requests, &md, gw)
+		s.record(conn, err)
+		if err != nil {
+			s.logCallError(err)
+		}
+		gw.writeStatus(err, trailer)
+	}
+}
+
+// grpcWebResponseWriter writes the response of a forwarded call in gRPC-Web
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	frames      *grpcweb.Writer
+	format      grpcweb.Format
+	wroteHeader bool
+}
+
+// WriteHeader writes the header metadata as HTTP headers
+func (gw *grpcWebResponseWriter) WriteHeader(md grpc_metadata.MD) {
+	h := gw.w.Header()
+	for k, v := range md {
+		for _, vv := range v {
+			h.Add(k, vv)
+		}
+	}
+	h.Set("Content-Type", gw.format.ContentType())
+	gw.w.WriteHeader(http.StatusOK)
+	gw.wroteHeader = true
+}
+
+// WriteMessage writes a data frame, and flushes it so that messages of server-streaming calls arrive as they are received
+func (gw *grpcWebResponseWriter) WriteMessage(b []byte) error {
+	if err := gw.frames.WriteMessage(b); err != nil {
+		return err
+	}
+	if f, ok := gw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeStatus writes the status of the call along with the trailer metadata.
+// It is written in the trailer frame if the header was written, and as HTTP headers otherwise.
+func (gw *grpcWebResponseWriter) writeStatus(err error, trailer grpc_metadata.MD) {
+	md := grpcStatusMetadata(err)
+	for k, v := range trailer {
+		md[k] = append(md[k], v...)
+	}
+	if gw.wroteHeader {
+		gw.frames.WriteTrailer(md)
+		return
+	}
+	h := gw.w.Header()
+	for k, v := range md {
+		for _, vv := range v {
+			h.Add(k, vv)
+		}
+	}
+	h.Set("Content-Type", gw.format.ContentType())
+	gw.w.WriteHeader(http.StatusOK)
+}
+
+// grpcStatusMetadata converts the error of a call into the metadata which carries its status
+func grpcStatusMetadata(err error) grpc_metadata.MD {
+	if err == nil {
+		return grpc_metadata.Pairs("grpc-status", "0")
+	}
+	st := statusOf(err)
+	md := grpc_metadata.Pairs(
+		"grpc-status", strconv.Itoa(int(st.Code)),
+		"grpc-message", grpcweb.EncodeMessage(st.Message),
+	)
+	if len(st.Details) > 0 {
+		if b, err := proto.Marshal(st); err == nil {
+			md.Set("grpc-status-details-bin", base64.RawStdEncoding.EncodeToString(b))
+		}
+	}
+	return md
+}
+
+// statusOf converts the error of a call into the gRPC status which the error represents
+func statusOf(err error) *spb.Status {
+	switch e := errors.Cause(err).(type) {
+	case *perrors.GRPCError:
+		return &spb.Status{Code: int32(e.StatusCode), Message: e.Message, Details: e.Details}
+	case perrors.Error:
+		st := &spb.Status{Code: int32(e.GRPCStatusCode()), Message: e.Error()}
+		if pe, ok := e.(*perrors.ProxyError); ok && pe.Message != "" {
+			st.Message = pe.Message
+		}
+		return st
+	default:
+		return &spb.Status{Code: int32(codes.Unknown), Message: err.Error()}
+	}
+}
@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/grpcweb"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func grpcWebFrames(t *testing.T, messages []string, trailer string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := grpcweb.NewWriter(&buf, grpcweb.Binary)
+	for _, m := range messages {
+		if err := w.WriteMessage([]byte(m)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if trailer != "" {
+		b := buf.Bytes()
+		frame := append([]byte{0x80, 0, 0, 0, byte(len(trailer))}, trailer...)
+		return append(b, frame...)
+	}
+	return buf.Bytes()
+}
+
+func TestServer_GRPCWebHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        []byte
+		err         error
+		status      int
+		respType    string
+		grpcStatus  string
+		resp        []byte
+	}{
+		{
+			name:        "binary",
+			method:      http.MethodPost,
+			path:        "/svc/method?version=v1",
+			contentType: "application/grpc-web+proto",
+			body:        grpcWebFrames(t, []string{"hello"}, ""),
+			status:      http.StatusOK,
+			respType:    "application/grpc-web+proto",
+			grpcStatus:  "",
+			resp:        grpcWebFrames(t, []string{"hello"}, "grpc-status: 0\r\nversion: v1\r\n"),
+		},
+		{
+			name:        "text",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/grpc-web-text",
+			body:        []byte(base64.StdEncoding.EncodeToString(grpcWebFrames(t, []string{"hello"}, ""))),
+			status:      http.StatusOK,
+			respType:    "application/grpc-web-text+proto",
+			grpcStatus:  "",
+			resp: []byte(base64.StdEncoding.EncodeToString(grpcWebFrames(t, []string{"hello"}, "")) +
+				base64.StdEncoding.EncodeToString(grpcWebFrames(t, nil, "grpc-status: 0\r\nversion: \r\n"))),
+		},
+		{
+			name:        "upstream error",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/grpc-web",
+			body:        grpcWebFrames(t, []string{"hello"}, ""),
+			err:         &perrors.GRPCError{StatusCode: int(codes.NotFound), Message: "not found"},
+			status:      http.StatusOK,
+			respType:    "application/grpc-web+proto",
+			grpcStatus:  "5",
+			resp:        []byte{},
+		},
+		{
+			name:        "invalid body",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/grpc-web",
+			body:        []byte{0x00, 0x00},
+			status:      http.StatusOK,
+			respType:    "application/grpc-web+proto",
+			grpcStatus:  "3",
+			resp:        []byte{},
+		},
+		{
+			name:        "invalid path",
+			method:      http.MethodPost,
+			path:        "/v1/svc/method",
+			contentType: "application/grpc-web",
+			status:      http.StatusNotFound,
+			resp:        []byte{},
+		},
+		{
+			name:        "method not allowed",
+			method:      http.MethodGet,
+			path:        "/svc/method",
+			contentType: "application/grpc-web",
+			status:      http.StatusMethodNotAllowed,
+			resp:        []byte{},
+		},
+		{
+			name:        "not gRPC-Web",
+			method:      http.MethodPost,
+			path:        "/svc/method",
+			contentType: "application/json",
+			status:      http.StatusTeapot,
+			resp:        []byte{},
+		},
+	}
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard())
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newClient := func() Client {
+				c := newFakeClient(t)
+				c.err = tc.err
+				return c
+			}
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			handlerF := server.GRPCWebHandler(newClient, next)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if got, want := rr.Result().Header.Get("Content-Type"), tc.respType; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := rr.Result().Header.Get("Grpc-Status"), tc.grpcStatus; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := rr.Body.Bytes(), tc.resp; !bytes.Equal(got, want) {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -1,16 +1,20 @@
 package http
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	"go.uber.org/zap"
 	grpc_metadata "google.golang.org/grpc/metadata"
 
 	perrors "github.com/mercari/grpc-http-proxy/errors"
 	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy"
 )
 
 type callee struct {
@@ -41,7 +45,7 @@ func (s *Server) CatchAllHandler() http.HandlerFunc {
 // RPCCallHandler handles requests for making gRPC calls
 func (s *Server) RPCCallHandler(newClient func() Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodPost && r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
@@ -57,52 +61,159 @@ func (s *Server) RPCCallHandler(newClient func() Client) http.HandlerFunc {
 			Service: parts[2],
 			Method:  parts[3],
 		}
-		if v, ok := r.URL.Query()["version"]; ok {
-			if len(v) != 1 {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-			c.ServiceVersion = v[0]
-		}
-		ctx := grpc_metadata.NewOutgoingContext(r.Context(),
-			grpc_metadata.MD(metadata.MetadataFromHeaders(r.Header)))
-		u, err := s.discoverer.Resolve(c.Service, c.ServiceVersion)
+		version, err := requestedVersion(r)
 		if err != nil {
-			s.logger.Error("error in handling call",
-				zap.String("err", err.Error()))
-			returnError(w, errors.Cause(err).(perrors.Error))
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		// TODO: Re-Use connections instead of creating a new connection for each request.
-		client := newClient()
-		client.Connect(ctx, u)
-		defer client.CloseConn()
-
-		md := make(metadata.Metadata)
+		c.ServiceVersion = version
 
+		if r.Method == http.MethodGet {
+			s.call(w, r, newClient, c, nil, proxy.WithQuery(inputQuery(r)))
+			return
+		}
 		inputMessage, err := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		response, err := client.Call(ctx, c.Service, c.Method, inputMessage, &md)
-		if err != nil {
-			returnError(w, errors.Cause(err).(perrors.Error))
-			s.logger.Error("error in handling call",
-				zap.String("err", err.Error()))
-			return
+		var opts []proxy.CallOption
+		if isProtoContentType(r.Header.Get("Content-Type")) {
+			opts = append(opts, proxy.WithProtoInput())
 		}
+		s.call(w, r, newClient, c, inputMessage, opts...)
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(response)
+// call makes the gRPC call to the callee and writes the response.
+// opts are added to the options of the call, and can change how the input message is built from the request.
+func (s *Server) call(w http.ResponseWriter,
+	r *http.Request,
+	newClient func() Client,
+	c callee,
+	inputMessage []byte,
+	opts ...proxy.CallOption,
+) {
+	requested, err := requestedTimeout(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	jsonOptions, err := s.requestedJSONOptions(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	dryRun, err := requestedDryRun(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx := grpc_metadata.NewOutgoingContext(r.Context(),
+		grpc_metadata.MD(metadata.MetadataFromHeaders(r.Header)))
+
+	contentType := responseContentType(r.Header.Get("Accept"))
+	if dryRun {
+		// the input message is responded in JSON
+		contentType = jsonContentType
+		w.Header().Set(dryRunHeader, "true")
+	} else if contentType != jsonContentType {
+		opts = append(opts, proxy.WithProtoOutput())
+	}
+	if paths := requestedFieldMask(r); paths != nil {
+		opts = append(opts, proxy.WithFieldMask(paths))
+	}
+	opts = append([]proxy.CallOption{proxy.WithJSONOptions(jsonOptions)}, opts...)
+	response, attempts, err := s.invoke(ctx, newClient, c, requested, dryRun, inputMessage, opts...)
+	if attempts > 0 {
+		w.Header().Set(attemptsHeader, strconv.Itoa(attempts))
+	}
+	if err != nil {
+		s.returnError(w, proxyError(err))
+		s.logCallError(err)
 		return
 	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// invoke connects to the upstream of the callee and makes the gRPC call with retries.
+// The number of attempts made is returned along with the response, which is zero if the upstream could not be called.
+// Dry runs only validate the input message, so their results are not recorded by the circuit breaker.
+func (s *Server) invoke(ctx context.Context,
+	newClient func() Client,
+	c callee,
+	requested time.Duration,
+	dryRun bool,
+	inputMessage []byte,
+	opts ...proxy.CallOption,
+) ([]byte, int, error) {
+	conn, err := s.connectUpstream(ctx, newClient, c, requested)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.close()
+
+	md := make(metadata.Metadata)
+	var attempts int
+	opts = append([]proxy.CallOption{
+		proxy.WithRetry(s.retryPolicy(conn.config), s.retryBudget(conn.upstream)),
+		proxy.Attempts(&attempts),
+	}, opts...)
+	if dryRun {
+		opts = append(opts, proxy.WithDryRun())
+	}
+	response, err := conn.client.Call(conn.ctx, c.Service, c.Method, inputMessage, &md, opts...)
+	if dryRun {
+		s.release(conn)
+	} else {
+		s.record(conn, err)
+	}
+	return response, attempts, err
 }
 
-func returnError(w http.ResponseWriter, err perrors.Error) {
-	w.WriteHeader(err.HTTPStatusCode())
-	err.WriteJSON(w)
-	return
+// requestedVersion returns the version of the service specified with the "version" query parameter.
+// The blank version is returned if it is not specified.
+func requestedVersion(r *http.Request) (string, error) {
+	v, ok := r.URL.Query()["version"]
+	if !ok {
+		return "", nil
+	}
+	if len(v) != 1 {
+		return "", errors.New("multiple versions specified")
+	}
+	return v[0], nil
+}
+
+// reservedQueryParameters are the query parameters used by the proxy itself,
+// which are never mapped to fields of the input message
+var reservedQueryParameters = []string{"version", "timeout", "json", "fields", "dry_run"}
+
+// inputQuery returns the query parameters which build the input message of GET requests
+func inputQuery(r *http.Request) url.Values {
+	q := r.URL.Query()
+	for _, k := range reservedQueryParameters {
+		q.Del(k)
+	}
+	return q
+}
+
+// returnError writes the error in the format of the server
+func (s *Server) returnError(w http.ResponseWriter, err perrors.Error) {
+	s.errorFormatter.WriteResponse(w, err)
+}
+
+// proxyError returns the error of the proxy or the upstream which caused err,
+// or an Unknown error of the proxy wrapping err if the cause is neither
+func proxyError(err error) perrors.Error {
+	if perr, ok := errors.Cause(err).(perrors.Error); ok {
+		return perr
+	}
+	return &perrors.ProxyError{
+		Code: perrors.Unknown,
+		Err:  err,
+	}
 }
@@ -2,19 +2,34 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jhump/protoreflect/desc"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+
+	"github.com/mercari/grpc-http-proxy/auth"
+	"github.com/mercari/grpc-http-proxy/breaker"
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
 	"github.com/mercari/grpc-http-proxy/log"
 	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
 )
 
 type fakeDiscoverer struct {
-	t *testing.T
+	t        *testing.T
+	services map[string][]string
 }
 
 func newFakeDiscoverer(t *testing.T) *fakeDiscoverer {
@@ -34,11 +49,20 @@ func (d *fakeDiscoverer) Resolve(service, version string) (*url.URL, error) {
 	return u, nil
 }
 
+func (d *fakeDiscoverer) UpstreamConfig(u *url.URL) *config.Upstream {
+	return &config.Upstream{}
+}
+
+func (d *fakeDiscoverer) Services() map[string][]string {
+	return d.services
+}
+
 type fakeClient struct {
 	t       *testing.T
 	service string
 	version string
 	err     error
+	sd      *desc.ServiceDescriptor
 }
 
 func newFakeClient(t *testing.T) *fakeClient {
@@ -47,7 +71,7 @@ func newFakeClient(t *testing.T) *fakeClient {
 	}
 }
 
-func (c *fakeClient) Connect(ctx context.Context, target *url.URL) error {
+func (c *fakeClient) Connect(ctx context.Context, target *url.URL, opts ...proxy.ConnectOption) error {
 	parts := strings.Split(target.String(), ".")
 	if len(parts) == 2 {
 		c.version = parts[0]
@@ -63,11 +87,22 @@ func (c *fakeClient) CloseConn() error {
 	return nil
 }
 
+func (c *fakeClient) DescribeService(ctx context.Context, serviceName string) (*desc.ServiceDescriptor, error) {
+	if c.sd == nil || c.sd.GetFullyQualifiedName() != serviceName {
+		return nil, &perrors.ProxyError{Code: perrors.ServiceNotFound}
+	}
+	return c.sd, nil
+}
+
 func (c *fakeClient) Call(ctx context.Context,
 	serviceName, methodName string,
 	message []byte,
 	md *metadata.Metadata,
+	opts ...proxy.CallOption,
 ) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	response := fmt.Sprintf("{\"serviceVersion\":\"%s\",\"service\":\"%s\",\"method\":\"%s\"}\n",
 		c.version,
 		c.service,
@@ -75,6 +110,41 @@ func (c *fakeClient) Call(ctx context.Context,
 	return []byte(response), nil
 }
 
+func (c *fakeClient) CallServerStream(ctx context.Context,
+	serviceName, methodName string,
+	message []byte,
+	md *metadata.Metadata,
+	recv func([]byte) error,
+	opts ...proxy.CallOption,
+) error {
+	if c.err != nil {
+		return c.err
+	}
+	response := fmt.Sprintf("{\"serviceVersion\":\"%s\",\"service\":\"%s\",\"method\":\"%s\"}",
+		c.version,
+		c.service,
+		methodName)
+	return recv([]byte(response))
+}
+
+func (c *fakeClient) Forward(ctx context.Context,
+	method string,
+	requests [][]byte,
+	md *metadata.Metadata,
+	w proxy.ResponseWriter,
+) (grpc_metadata.MD, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	w.WriteHeader(grpc_metadata.Pairs("method", method))
+	for _, req := range requests {
+		if err := w.WriteMessage(req); err != nil {
+			return nil, err
+		}
+	}
+	return grpc_metadata.Pairs("version", c.version), nil
+}
+
 func TestServer_LivenessProbeHandler(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -139,6 +209,7 @@ func TestServer_RPCCallHandler(t *testing.T) {
 		name        string
 		status      int
 		contentType string
+		accept      string
 		path        string
 		method      string
 		resp        string
@@ -159,6 +230,23 @@ func TestServer_RPCCallHandler(t *testing.T) {
 			method:      http.MethodPost,
 			resp:        "{\"serviceVersion\":\"v1\",\"service\":\"svc\",\"method\":\"method\"}\n",
 		},
+		{
+			name:        "success (GET)",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			path:        "/v1/svc/method?version=v1&name=foo",
+			method:      http.MethodGet,
+			resp:        "{\"serviceVersion\":\"v1\",\"service\":\"svc\",\"method\":\"method\"}\n",
+		},
+		{
+			name:        "success (protobuf)",
+			status:      http.StatusOK,
+			contentType: "application/x-protobuf",
+			accept:      "application/x-protobuf, application/json;q=0.5",
+			path:        "/v1/svc/method",
+			method:      http.MethodPost,
+			resp:        "{\"serviceVersion\":\"\",\"service\":\"svc\",\"method\":\"method\"}\n",
+		},
 		{
 			name:        "multiple versions specified",
 			status:      http.StatusBadRequest,
@@ -167,6 +255,14 @@ func TestServer_RPCCallHandler(t *testing.T) {
 			method:      http.MethodPost,
 			resp:        "",
 		},
+		{
+			name:        "invalid timeout",
+			status:      http.StatusBadRequest,
+			contentType: "",
+			path:        "/v1/svc/method?timeout=foo",
+			method:      http.MethodPost,
+			resp:        "",
+		},
 		{
 			name:        "invalid path",
 			status:      http.StatusNotFound,
@@ -180,7 +276,7 @@ func TestServer_RPCCallHandler(t *testing.T) {
 			status:      http.StatusMethodNotAllowed,
 			contentType: "",
 			path:        "/v1/svc/version",
-			method:      http.MethodGet,
+			method:      http.MethodPut,
 			resp:        "",
 		},
 	}
@@ -193,7 +289,11 @@ func TestServer_RPCCallHandler(t *testing.T) {
 		t.Run(tc.name, func(*testing.T) {
 			rr := httptest.NewRecorder()
 			handlerF := server.RPCCallHandler(newClient)
-			handlerF(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			handlerF(rr, req)
 
 			if got, want := rr.Result().StatusCode, tc.status; got != want {
 				t.Fatalf("got %d, want %d", got, want)
@@ -212,3 +312,245 @@ func TestServer_RPCCallHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestInputQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/svc/method?version=v1&timeout=1s&json=orig_name&fields=name&dry_run=true&name=foo&tags=a&tags=b", nil)
+	expected := url.Values{
+		"name": []string{"foo"},
+		"tags": []string{"a", "b"},
+	}
+	if got, want := inputQuery(r), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestServer_RPCCallHandlerCircuitOpen(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	b := breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Minute,
+	})
+	b.Record(proxytest.ParseURL(t, "svc:5000"), &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b))
+	newClient := func() Client {
+		t.Fatal("client should not be created while the circuit is open")
+		return nil
+	}
+
+	rr := httptest.NewRecorder()
+	handlerF := server.RPCCallHandler(newClient)
+	handlerF(rr, httptest.NewRequest(http.MethodPost, "/v1/svc/method", nil))
+
+	if got, want := rr.Result().StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestServer_RPCCallHandlerErrorFormat(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	b := breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Minute,
+	})
+	b.Record(proxytest.ParseURL(t, "svc:5000"), &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	f, err := perrors.NewFormatter("problem", map[string]int{"CIRCUIT_OPEN": http.StatusTooManyRequests})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b), WithErrorFormatter(f))
+	newClient := func() Client {
+		t.Fatal("client should not be created while the circuit is open")
+		return nil
+	}
+
+	rr := httptest.NewRecorder()
+	handlerF := server.RPCCallHandler(newClient)
+	handlerF(rr, httptest.NewRequest(http.MethodPost, "/v1/svc/method", nil))
+
+	if got, want := rr.Result().StatusCode, http.StatusTooManyRequests; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	if got, want := rr.Header().Get("Content-Type"), "application/problem+json"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	var problem struct {
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := problem.Code, "CIRCUIT_OPEN"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := problem.Status, http.StatusTooManyRequests; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+}
+
+func TestProxyError(t *testing.T) {
+	perr := &perrors.ProxyError{Code: perrors.MethodNotFound}
+	gerr := &perrors.GRPCError{StatusCode: int(codes.NotFound)}
+	other := errors.New("other")
+	cases := []struct {
+		name string
+		err  error
+		want perrors.Error
+	}{
+		{
+			name: "proxy error",
+			err:  errors.Wrap(perr, "wrapped"),
+			want: perr,
+		},
+		{
+			name: "gRPC error",
+			err:  gerr,
+			want: gerr,
+		},
+		{
+			name: "other error",
+			err:  other,
+			want: &perrors.ProxyError{Code: perrors.Unknown, Err: other},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := proxyError(tc.err); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestServer_RPCCallHandlerPermissionDenied(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard())
+	newClient := func() Client {
+		return newFakeClient(t)
+	}
+	id := &auth.Identity{
+		Name:     "frontend",
+		Services: []string{"svc"},
+		Methods:  []string{"Get*"},
+	}
+	cases := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{
+			name:   "allowed",
+			path:   "/v1/svc/GetBook",
+			status: http.StatusOK,
+		},
+		{
+			name:   "method not allowed",
+			path:   "/v1/svc/DeleteBook",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "service not allowed",
+			path:   "/v1/other/GetBook",
+			status: http.StatusForbidden,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			req = req.WithContext(auth.NewContext(req.Context(), id))
+			server.RPCCallHandler(newClient)(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.status != http.StatusForbidden {
+				return
+			}
+			var body struct {
+				ErrorCode string `json:"error_code"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := body.ErrorCode, "PERMISSION_DENIED"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_RPCCallHandlerCircuitDeadline(t *testing.T) {
+	cases := []struct {
+		name  string
+		path  string
+		state breaker.State
+	}{
+		{
+			name:  "deadline of the proxy",
+			path:  "/v1/svc/method",
+			state: breaker.Open,
+		},
+		{
+			name:  "deadline of the caller",
+			path:  "/v1/svc/method?timeout=1ms",
+			state: breaker.Closed,
+		},
+		{
+			name:  "deadline of the caller capped by the proxy",
+			path:  "/v1/svc/method?timeout=1h",
+			state: breaker.Open,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFakeDiscoverer(t)
+			b := breaker.New(&config.Breaker{
+				ConsecutiveFailures: 1,
+				OpenDuration:        time.Minute,
+			})
+			server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b), WithTimeouts(time.Second, time.Minute))
+			newClient := func() Client {
+				c := newFakeClient(t)
+				c.err = &perrors.ProxyError{Code: perrors.DeadlineExceeded}
+				return c
+			}
+			rr := httptest.NewRecorder()
+			server.RPCCallHandler(newClient)(rr, httptest.NewRequest(http.MethodPost, tc.path, nil))
+
+			if got, want := b.State(proxytest.ParseURL(t, "svc:5000")), tc.state; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_RPCCallHandlerCircuitDryRun(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	b := breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Millisecond,
+	})
+	u := proxytest.ParseURL(t, "svc:5000")
+	b.Record(u, &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	time.Sleep(2 * time.Millisecond)
+	server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b))
+	newClient := func() Client {
+		return newFakeClient(t)
+	}
+
+	rr := httptest.NewRecorder()
+	server.RPCCallHandler(newClient)(rr, httptest.NewRequest(http.MethodPost, "/v1/svc/method?dry_run=true", nil))
+	if got, want := rr.Result().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	if got, want := b.State(u), breaker.HalfOpen; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	// the trial call is given back to a real call
+	rr = httptest.NewRecorder()
+	server.RPCCallHandler(newClient)(rr, httptest.NewRequest(http.MethodPost, "/v1/svc/method", nil))
+	if got, want := b.State(u), breaker.Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/httprule"
+	"github.com/mercari/grpc-http-proxy/proxy"
+	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+)
+
+// httpRuleLoadTimeout is the timeout for reading the google.api.http options of a single service
+const httpRuleLoadTimeout = 10 * time.Second
+
+// HTTPRuleHandler handles requests for the routes defined by google.api.http options,
+// and passes requests which match none of them to next.
+func (s *Server) HTTPRuleHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.isGenericCall(r) {
+			next(w, r)
+			return
+		}
+		rule, params := s.rules.Match(r.Method, r.URL.EscapedPath())
+		if rule == nil {
+			next(w, r)
+			return
+		}
+		version, err := requestedVersion(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c := callee{
+			ServiceVersion: version,
+			Service:        rule.Service,
+			Method:         rule.Method,
+		}
+
+		input := &reflection.Input{PathParams: params}
+		if rule.Body != "" {
+			if isProtoContentType(r.Header.Get("Content-Type")) {
+				s.returnError(w, &perrors.ProxyError{
+					Code:    perrors.MessageTypeMismatch,
+					Message: "protobuf request bodies are only accepted by /v1/<service>/<method>",
+				})
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			defer r.Body.Close()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			input.JSON = body
+			if rule.Body != "*" {
+				input.BodyField = rule.Body
+			}
+		}
+		if rule.Body != "*" {
+			// fields bound by the path or the body are not taken from the query
+			q := inputQuery(r)
+			for field := range params {
+				q.Del(field)
+			}
+			if rule.Body != "" {
+				q.Del(rule.Body)
+			}
+			input.Query = q
+		}
+
+		opts := []proxy.CallOption{proxy.WithInput(input)}
+		if rule.ResponseBody != "" {
+			opts = append(opts, proxy.WithResponseBody(rule.ResponseBody))
+		}
+		s.call(w, r, newClient, c, nil, opts...)
+	}
+}
+
+// isGenericCall checks if the request is for the generic route /v1/<service>/<method> of a discovered service,
+// which takes precedence over the routes of google.api.http options, even if the rules of the service are not loaded
+func (s *Server) isGenericCall(r *http.Request) bool {
+	parts := strings.Split(r.URL.Path, "/")
+	return len(parts) == 4 && parts[1] == "v1" && s.isDiscovered(parts[2])
+}
+
+// LoadHTTPRules reads the google.api.http options of all services through reflection, and updates the routes.
+// The routes of services which cannot be reflected are kept as they are.
+func (s *Server) LoadHTTPRules(ctx context.Context, newClient func() Client) {
+	services := s.discoverer.Services()
+	names := make([]string, 0, len(services))
+	for svc, versions := range services {
+		names = append(names, svc)
+		if len(versions) == 0 {
+			continue
+		}
+		rules, err := s.loadHTTPRules(ctx, newClient, svc, versions[0])
+		if err != nil {
+			s.logger.Warn("could not load google.api.http options",
+				zap.String("service", svc),
+				zap.String("err", err.Error()))
+			continue
+		}
+		s.rules.SetRules(svc, rules)
+	}
+	s.rules.Retain(names)
+}
+
+// loadHTTPRules reads the google.api.http options of the service from its upstream of the version.
+// The upstream is called in the same way as calls, under its concurrency limits and circuit breaker.
+func (s *Server) loadHTTPRules(ctx context.Context, newClient func() Client, svc, version string) ([]*httprule.Rule, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpRuleLoadTimeout)
+	defer cancel()
+	u, err := s.discoverer.Resolve(svc, version)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.connect(ctx, newClient, u, svc, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	sd, err := conn.client.DescribeService(conn.ctx, svc)
+	s.record(conn, err)
+	if err != nil {
+		return nil, err
+	}
+	rules, errs := httprule.RulesFromService(sd)
+	for _, err := range errs {
+		s.logger.Warn("ignoring google.api.http option",
+			zap.String("service", svc),
+			zap.String("err", err.Error()))
+	}
+	return rules, nil
+}
+
+// RunHTTPRuleLoader loads the routes of google.api.http options every interval until stopCh is closed
+func (s *Server) RunHTTPRuleLoader(interval time.Duration, stopCh <-chan struct{}) {
+	newClient := func() Client {
+		return proxy.NewProxy()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.LoadHTTPRules(context.Background(), newClient)
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+
+	"github.com/mercari/grpc-http-proxy/breaker"
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/httprule"
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+func newLibraryDescriptor(t *testing.T) *desc.ServiceDescriptor {
+	t.Helper()
+	opts := &dpb.MethodOptions{}
+	err := proto.SetExtension(opts, annotations.E_Http, &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=books/*}"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("library.proto"),
+		Package: proto.String("a"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{Name: proto.String("Book")},
+		},
+		Service: []*dpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Library"),
+				Method: []*dpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("GetBook"),
+						InputType:  proto.String(".a.Book"),
+						OutputType: proto.String(".a.Book"),
+						Options:    opts,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd.FindService("a.Library")
+}
+
+func newRule(t *testing.T, httpMethod, template, service, method string) *httprule.Rule {
+	t.Helper()
+	tmpl, err := httprule.ParseTemplate(template)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return &httprule.Rule{
+		HTTPMethod: httpMethod,
+		Template:   tmpl,
+		Service:    service,
+		Method:     method,
+	}
+}
+
+func TestServer_HTTPRuleHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		resp   string
+	}{
+		{
+			name:   "matched",
+			method: http.MethodGet,
+			path:   "/v1/books/1",
+			status: http.StatusOK,
+			resp:   "{\"serviceVersion\":\"\",\"service\":\"library\",\"method\":\"GetBook\"}\n",
+		},
+		{
+			name:   "matched with version",
+			method: http.MethodDelete,
+			path:   "/v1/books/1?version=v1",
+			status: http.StatusOK,
+			resp:   "{\"serviceVersion\":\"v1\",\"service\":\"library\",\"method\":\"DeleteBook\"}\n",
+		},
+		{
+			name:   "generic route of a known service",
+			method: http.MethodPost,
+			path:   "/v1/library/GetBook",
+			status: http.StatusTeapot,
+			resp:   "",
+		},
+		{
+			name:   "generic route of a discovered service without rules",
+			method: http.MethodPost,
+			path:   "/v1/catalog/ListItems",
+			status: http.StatusTeapot,
+			resp:   "",
+		},
+		{
+			name:   "route of an unknown service",
+			method: http.MethodPost,
+			path:   "/v1/shelves/books",
+			status: http.StatusOK,
+			resp:   "{\"serviceVersion\":\"\",\"service\":\"library\",\"method\":\"MoveBook\"}\n",
+		},
+		{
+			name:   "not matched",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1",
+			status: http.StatusTeapot,
+			resp:   "",
+		},
+		{
+			name:   "multiple versions specified",
+			method: http.MethodGet,
+			path:   "/v1/books/1?version=v1&version=v2",
+			status: http.StatusBadRequest,
+			resp:   "",
+		},
+	}
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"library": {""},
+		"catalog": {""},
+	}
+	server := New("foo", d, log.NewDiscard())
+	server.rules.SetRules("library", []*httprule.Rule{
+		newRule(t, http.MethodGet, "/v1/{name=books/*}", "library", "GetBook"),
+		newRule(t, http.MethodDelete, "/v1/{name=books/*}", "library", "DeleteBook"),
+		newRule(t, http.MethodPost, "/v1/{parent}/{name}", "library", "MoveBook"),
+	})
+	newClient := func() Client {
+		return newFakeClient(t)
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handlerF := server.HTTPRuleHandler(newClient, next)
+			handlerF(rr, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if got, want := rr.Body.String(), tc.resp; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_LoadHTTPRules(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {""},
+		"b.Unknown": {"v1", "v2"},
+	}
+	server := New("foo", d, log.NewDiscard())
+	server.rules.SetRules("c.Removed", []*httprule.Rule{
+		newRule(t, http.MethodGet, "/v1/removed", "c.Removed", "Get"),
+	})
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+	server.LoadHTTPRules(context.Background(), newClient)
+
+	rule, params := server.rules.Match(http.MethodGet, "/v1/books/1")
+	if rule == nil {
+		t.Fatal("rule should be loaded")
+	}
+	if got, want := rule.Method, "GetBook"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got, want := params["name"], "books/1"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if server.rules.HasService("b.Unknown") {
+		t.Fatal("service which could not be reflected should not be loaded")
+	}
+	if rule, _ := server.rules.Match(http.MethodGet, "/v1/removed"); rule != nil {
+		t.Fatal("rules of services which no longer exist should be removed")
+	}
+}
+
+func TestServer_LoadHTTPRulesCircuitBreaker(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {""},
+	}
+	b := breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Minute,
+	})
+	u := proxytest.ParseURL(t, "a.Library:5000")
+	b.Record(u, &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	server := New("foo", d, log.NewDiscard(), WithCircuitBreaker(b))
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+
+	server.LoadHTTPRules(context.Background(), func() Client {
+		t.Fatal("client should not be created while the circuit is open")
+		return nil
+	})
+	if server.rules.HasService("a.Library") {
+		t.Fatal("rules should not be loaded from an upstream whose circuit is open")
+	}
+
+	// the result of the trial call of the half-open circuit is recorded
+	b = breaker.New(&config.Breaker{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Millisecond,
+	})
+	b.Record(u, &perrors.ProxyError{Code: perrors.UpstreamConnFailure})
+	time.Sleep(2 * time.Millisecond)
+	server = New("foo", d, log.NewDiscard(), WithCircuitBreaker(b))
+	server.LoadHTTPRules(context.Background(), newClient)
+	if !server.rules.HasService("a.Library") {
+		t.Fatal("rules should be loaded")
+	}
+	if got, want := b.State(u), breaker.Closed; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+)
+
+const jsonOptionsHeader = "X-Grpc-Proxy-Json"
+
+// requestedJSONOptions returns the options of the conversion between messages and JSON for the request.
+// The defaults of the proxy are overridden by the "json" query parameter, or by the X-Grpc-Proxy-Json header.
+// Both are comma separated lists of options such as "emit_defaults,orig_name=false".
+func (s *Server) requestedJSONOptions(r *http.Request) (*reflection.JSONOptions, error) {
+	c := config.JSON{Strict: true}
+	if s.json != nil {
+		c = *s.json
+	}
+	v := r.Header.Get(jsonOptionsHeader)
+	if q, ok := r.URL.Query()["json"]; ok {
+		if len(q) != 1 {
+			return nil, errors.New("multiple JSON options specified")
+		}
+		v = q[0]
+	}
+	if err := parseJSONOptions(v, &c); err != nil {
+		return nil, err
+	}
+	return &reflection.JSONOptions{
+		EmitDefaults:       c.EmitDefaults,
+		OrigName:           c.OrigName,
+		EnumsAsInts:        c.EnumsAsInts,
+		Int64AsStrings:     c.Int64AsStrings,
+		AllowUnknownFields: !c.Strict,
+	}, nil
+}
+
+// parseJSONOptions overrides c with the options in v.
+// Each option is its name, which enables it, or its name followed by "=" and a boolean.
+func parseJSONOptions(v string, c *config.JSON) error {
+	for _, opt := range strings.Split(v, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		name, enabled := opt, true
+		if i := strings.Index(opt, "="); i >= 0 {
+			b, err := strconv.ParseBool(opt[i+1:])
+			if err != nil {
+				return errors.Errorf("invalid JSON option: %s", opt)
+			}
+			name, enabled = opt[:i], b
+		}
+		switch name {
+		case "emit_defaults":
+			c.EmitDefaults = enabled
+		case "orig_name":
+			c.OrigName = enabled
+		case "enums_as_ints":
+			c.EnumsAsInts = enabled
+		case "int64_as_strings":
+			c.Int64AsStrings = enabled
+		case "strict":
+			c.Strict = enabled
+		default:
+			return errors.Errorf("unknown JSON option: %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+)
+
+func TestServer_requestedJSONOptions(t *testing.T) {
+	cases := []struct {
+		name       string
+		defaults   *config.JSON
+		path       string
+		header     string
+		opts       *reflection.JSONOptions
+		errorIsNil bool
+	}{
+		{
+			name:       "no defaults",
+			path:       "/v1/svc/method",
+			opts:       &reflection.JSONOptions{},
+			errorIsNil: true,
+		},
+		{
+			name:       "defaults",
+			defaults:   &config.JSON{EmitDefaults: true, Strict: false},
+			path:       "/v1/svc/method",
+			opts:       &reflection.JSONOptions{EmitDefaults: true, AllowUnknownFields: true},
+			errorIsNil: true,
+		},
+		{
+			name:       "query parameter",
+			defaults:   &config.JSON{EmitDefaults: true, Strict: true},
+			path:       "/v1/svc/method?json=emit_defaults=false,orig_name,int64_as_strings=true,strict=false",
+			header:     "enums_as_ints",
+			opts:       &reflection.JSONOptions{OrigName: true, Int64AsStrings: true, AllowUnknownFields: true},
+			errorIsNil: true,
+		},
+		{
+			name:       "header",
+			path:       "/v1/svc/method",
+			header:     "enums_as_ints, orig_name",
+			opts:       &reflection.JSONOptions{EnumsAsInts: true, OrigName: true},
+			errorIsNil: true,
+		},
+		{
+			name:       "unknown option",
+			path:       "/v1/svc/method?json=pretty",
+			errorIsNil: false,
+		},
+		{
+			name:       "invalid value",
+			path:       "/v1/svc/method?json=strict=maybe",
+			errorIsNil: false,
+		},
+		{
+			name:       "multiple query parameters",
+			path:       "/v1/svc/method?json=strict&json=orig_name",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := New("foo", newFakeDiscoverer(t), log.NewDiscard(), WithJSONConfig(tc.defaults))
+			if tc.defaults == nil {
+				server = New("foo", newFakeDiscoverer(t), log.NewDiscard())
+			}
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(jsonOptionsHeader, tc.header)
+			}
+			opts, err := server.requestedJSONOptions(req)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if got, want := opts, tc.opts; err == nil && !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
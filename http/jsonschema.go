@@ -0,0 +1,49 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+)
+
+// The last segments of the paths of the JSON Schema documents of the input and output messages of a method
+const (
+	inputSchemaDocument  = "input.schema.json"
+	outputSchemaDocument = "output.schema.json"
+)
+
+// JSONSchemaHandler handles GET requests for /v1/<service>/<method>/input.schema.json and /v1/<service>/<method>/output.schema.json,
+// which are the JSON Schema documents of the input and output messages of the method
+// generated from the descriptor of the service obtained through reflection.
+// Other requests, including those for services which are not discovered, are passed to next.
+func (s *Server) JSONSchemaHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		if r.Method != http.MethodGet || len(parts) != 5 || parts[1] != "v1" ||
+			(parts[4] != inputSchemaDocument && parts[4] != outputSchemaDocument) || !s.isDiscovered(parts[2]) {
+			next(w, r)
+			return
+		}
+		service, method, name := parts[2], parts[3], parts[4]
+		s.writeServiceDocument(w, r, newClient, service, method+"/"+name, func(sd *desc.ServiceDescriptor, version string) ([]byte, error) {
+			md := sd.FindMethodByName(method)
+			if md == nil {
+				return nil, &perrors.ProxyError{
+					Code:    perrors.MethodNotFound,
+					Message: fmt.Sprintf("the method %s was not found", method),
+				}
+			}
+			m := &reflection.MethodDescriptor{MethodDescriptor: md}
+			if name == inputSchemaDocument {
+				return json.Marshal(m.GetInputType().JSONSchema())
+			}
+			return json.Marshal(m.GetOutputType().JSONSchema())
+		})
+	}
+}
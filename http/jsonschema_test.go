@@ -0,0 +1,92 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestServer_JSONSchemaHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		resp   string
+	}{
+		{
+			name:   "input",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/GetBook/input.schema.json",
+			status: http.StatusOK,
+			resp: `{"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/a.Book",` +
+				`"$defs":{"a.Book":{"type":"object"}}}`,
+		},
+		{
+			name:   "output",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/GetBook/output.schema.json?version=v1",
+			status: http.StatusOK,
+			resp: `{"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/a.Book",` +
+				`"$defs":{"a.Book":{"type":"object"}}}`,
+		},
+		{
+			name:   "method not found",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/ListBooks/input.schema.json",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "service not discovered",
+			method: http.MethodGet,
+			path:   "/v1/c.Unknown/GetBook/input.schema.json",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "other document",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/GetBook/schema.json",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "not GET",
+			method: http.MethodPost,
+			path:   "/v1/a.Library/GetBook/input.schema.json",
+			status: http.StatusTeapot,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {"", "v1"},
+	}
+	server := New("foo", d, log.NewDiscard())
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			handlerF := server.JSONSchemaHandler(newClient, next)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.resp == "" {
+				return
+			}
+			if got, want := rr.Body.String(), tc.resp; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
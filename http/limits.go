@@ -0,0 +1,24 @@
+package http
+
+import (
+	"context"
+	"net/url"
+)
+
+// acquire acquires slots for a call to the upstream and the gRPC service.
+// The returned function must be called to release the slots once the call is finished.
+func (s *Server) acquire(ctx context.Context, u *url.URL, service string) (func(), error) {
+	releaseUpstream, err := s.upstreamLimits.Acquire(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	releaseService, err := s.serviceLimits.Acquire(ctx, service)
+	if err != nil {
+		releaseUpstream()
+		return nil, err
+	}
+	return func() {
+		releaseService()
+		releaseUpstream()
+	}, nil
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+func TestServer_acquire(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard(), WithConcurrencyLimits(&config.Concurrency{
+		MaxPerUpstream: 2,
+		MaxPerService:  1,
+		QueueSize:      0,
+		QueueTimeout:   time.Second,
+	}))
+	ctx := context.Background()
+	u := proxytest.ParseURL(t, "svc:5000")
+
+	release, err := server.acquire(ctx, u, "svc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := server.acquire(ctx, u, "svc"); err == nil {
+		t.Fatal("err should not be nil")
+	}
+	stats := server.ConcurrencyStats()
+	if got, want := stats["upstreams"][u.String()], 1; got != want {
+		t.Fatalf("upstream slot should be released on failure: got %d, want %d", got, want)
+	}
+	if got, want := stats["services"]["svc"], 1; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	release()
+	stats = server.ConcurrencyStats()
+	if got, want := stats["upstreams"][u.String()], 0; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
@@ -2,8 +2,11 @@ package http
 
 import (
 	"net/http"
+	"strings"
 
 	"go.uber.org/zap"
+
+	"github.com/mercari/grpc-http-proxy/auth"
 )
 
 // Adapter represents a middleware adapter
@@ -16,24 +19,91 @@ func apply(handler http.HandlerFunc, adapters ...Adapter) http.HandlerFunc {
 	return handler
 }
 
+// defaultTokenName is the name of the token passed to New
+const defaultTokenName = "default"
+
+// newTokenStore creates the store of the token, which is allowed to make any call.
+// The store is empty if the token is blank.
+func newTokenStore(token string) *auth.Store {
+	if token == "" {
+		return auth.NewStore()
+	}
+	return auth.NewStore(&auth.Token{
+		Identity: auth.Identity{Name: defaultTokenName},
+		Token:    token,
+	})
+}
+
+// withAccessToken authenticates requests with the X-Access-Token header, or with bearer tokens if there is an authenticator,
+// and passes the identity of the token in their contexts.
+// Requests without either of them are passed as they are if there are no tokens and no authenticator.
 func (s *Server) withAccessToken(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if bearer, ok := bearerToken(r); ok && s.authenticator != nil {
+			s.withBearerToken(bearer, next)(w, r)
+			return
+		}
 		providedToken := r.Header.Get("X-Access-Token")
-		if providedToken == "" && s.accessToken != "" {
+		if providedToken == "" {
+			if s.tokens.Len() > 0 || s.authenticator != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				s.logger.Info("unauthorized",
+					zap.String("reason", "no token"),
+				)
+				return
+			}
+			next(w, r)
+			return
+		}
+		id, ok := s.tokens.Authenticate(providedToken)
+		if !ok {
 			w.WriteHeader(http.StatusUnauthorized)
 			s.logger.Info("unauthorized",
-				zap.String("reason", "no token"),
+				zap.String("reason", "invalid token"),
 			)
 			return
 		}
-		if providedToken != s.accessToken {
+		recordIdentity(w, id)
+		next(w, r.WithContext(auth.NewContext(r.Context(), id)))
+	}
+}
+
+// withBearerToken authenticates the request with the bearer token by the authenticator,
+// and removes the Authorization header of the authenticated request
+func (s *Server) withBearerToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := s.authenticator.Authenticate(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
 			w.WriteHeader(http.StatusUnauthorized)
 			s.logger.Info("unauthorized",
-				zap.String("reason", "invalid token"),
+				zap.String("reason", "invalid bearer token"),
+				zap.String("err", err.Error()),
 			)
 			return
 		}
-		next(w, r)
+		recordIdentity(w, id)
+		// the token is a credential for the proxy, which must not be forwarded to upstreams
+		r.Header.Del("Authorization")
+		next(w, r.WithContext(auth.NewContext(r.Context(), id)))
+	}
+}
+
+// bearerToken returns the bearer token in the Authorization header, if any
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(h[len(prefix):])
+	return token, token != ""
+}
+
+// recordIdentity records the name of the identity in the access log of the request, if it is written by withLog
+func recordIdentity(w http.ResponseWriter, id *auth.Identity) {
+	if d, ok := w.(*responseWriterDelegator); ok {
+		d.identity = id.Name
 	}
 }
 
@@ -41,17 +111,23 @@ func (s *Server) withLog(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		d := newDelegator(w)
 		next(d, r)
-		s.logger.Info("request",
+		fields := []zap.Field{
 			zap.String("host", r.URL.Host),
 			zap.String("path", r.URL.Path),
 			zap.Int("status", d.status),
 			zap.String("method", r.Method),
-		)
+		}
+		if d.identity != "" {
+			fields = append(fields, zap.String("token", d.identity))
+		}
+		s.logger.Info("request", fields...)
 	}
 }
 
 type responseWriterDelegator struct {
 	status int
+	// identity is the name of the authenticated caller
+	identity string
 	http.ResponseWriter
 }
 
@@ -66,3 +142,10 @@ func (w *responseWriterDelegator) WriteHeader(code int) {
 	w.status = code
 	w.ResponseWriter.WriteHeader(code)
 }
+
+// Flush sends buffered data to the client, if the underlying ResponseWriter supports it
+func (w *responseWriterDelegator) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
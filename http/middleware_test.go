@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -9,6 +11,8 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mercari/grpc-http-proxy/auth"
 )
 
 func TestServer_withAccessTokenInvalidToken(t *testing.T) {
@@ -140,3 +144,161 @@ func TestServer_withLog(t *testing.T) {
 		}
 	}
 }
+
+func TestServer_withAccessTokenIdentity(t *testing.T) {
+	logger, logs := observer.New(zapcore.InfoLevel)
+	d := newFakeDiscoverer(t)
+	store := auth.NewStore(&auth.Token{Identity: auth.Identity{Name: "frontend"}, Token: "secret"})
+	server := New("foo", d, zap.New(logger), WithTokenStore(store))
+	rr := httptest.NewRecorder()
+	var name string
+	handlerF := server.withLog(server.withAccessToken(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := auth.FromContext(r.Context()); ok {
+			name = id.Name
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Access-Token", "secret")
+	handlerF(rr, req)
+
+	if got, want := rr.Result().StatusCode, http.StatusOK; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	if got, want := name, "frontend"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if logs.Len() != 1 {
+		t.Fatalf("incorrect number of log entries: got %d, want %d", logs.Len(), 1)
+	}
+	fields := logs.All()[0].ContextMap()
+	if got, want := fields["token"], "frontend"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+type fakeAuthenticator struct {
+	tokens map[string]*auth.Identity
+}
+
+func (a *fakeAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Identity, error) {
+	id, ok := a.tokens[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return id, nil
+}
+
+func TestServer_withAccessTokenBearer(t *testing.T) {
+	cases := []struct {
+		name          string
+		authorization string
+		accessToken   string
+		status        int
+		identity      string
+		// forwarded is the Authorization header which is passed on to the upstream
+		forwarded string
+	}{
+		{
+			name:          "valid bearer token",
+			authorization: "Bearer jwt",
+			status:        http.StatusOK,
+			identity:      "frontend",
+		},
+		{
+			name:          "case insensitive scheme",
+			authorization: "bearer jwt",
+			status:        http.StatusOK,
+			identity:      "frontend",
+		},
+		{
+			name:          "access token with other scheme",
+			authorization: "Basic Zm9vOmJhcg==",
+			accessToken:   "foo",
+			status:        http.StatusOK,
+			identity:      defaultTokenName,
+			forwarded:     "Basic Zm9vOmJhcg==",
+		},
+		{
+			name:          "invalid bearer token",
+			authorization: "Bearer other",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:        "access token",
+			accessToken: "foo",
+			status:      http.StatusOK,
+			identity:    defaultTokenName,
+		},
+		{
+			name:          "other scheme",
+			authorization: "Basic Zm9vOmJhcg==",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:   "no token",
+			status: http.StatusUnauthorized,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	a := &fakeAuthenticator{tokens: map[string]*auth.Identity{"jwt": {Name: "frontend"}}}
+	server := New("foo", d, zap.NewNop(), WithAuthenticator(a))
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			var identity, forwarded string
+			handlerF := server.withAccessToken(func(w http.ResponseWriter, r *http.Request) {
+				if id, ok := auth.FromContext(r.Context()); ok {
+					identity = id.Name
+				}
+				forwarded = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			if tc.accessToken != "" {
+				req.Header.Set("X-Access-Token", tc.accessToken)
+			}
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if got, want := identity, tc.identity; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := forwarded, tc.forwarded; got != want {
+				t.Errorf("got %q, want %q forwarded", got, want)
+			}
+		})
+	}
+
+	t.Run("no authenticator", func(t *testing.T) {
+		server := New("foo", d, zap.NewNop())
+		rr := httptest.NewRecorder()
+		var forwarded string
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer backend")
+		req.Header.Set("X-Access-Token", "foo")
+		server.withAccessToken(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		})(rr, req)
+		if got, want := forwarded, "Bearer backend"; got != want {
+			t.Errorf("got %q, want %q forwarded", got, want)
+		}
+	})
+
+	t.Run("no access tokens", func(t *testing.T) {
+		server := New("", d, zap.NewNop(), WithAuthenticator(a))
+		rr := httptest.NewRecorder()
+		server.withAccessToken(func(w http.ResponseWriter, r *http.Request) {
+			panic("this shouldn't be called")
+		})(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got, want := rr.Result().StatusCode, http.StatusUnauthorized; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/mercari/grpc-http-proxy/openapi"
+)
+
+// openAPIDocument is the last segment of the path of the OpenAPI document of a service
+const openAPIDocument = "openapi.json"
+
+// OpenAPIHandler handles GET requests for /v1/<service>/openapi.json, which is the OpenAPI document of the service
+// generated from its descriptor obtained through reflection.
+// Other requests, including those for services which are not discovered, are passed to next.
+func (s *Server) OpenAPIHandler(newClient func() Client, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		service, ok := s.documentService(r, openAPIDocument)
+		if !ok {
+			next(w, r)
+			return
+		}
+		s.writeServiceDocument(w, r, newClient, service, openAPIDocument, func(sd *desc.ServiceDescriptor, version string) ([]byte, error) {
+			return json.Marshal(openapi.New(sd, version))
+		})
+	}
+}
+
+// documentService returns the service whose document named name is requested with GET /v1/<service>/<name>,
+// if the service is discovered
+func (s *Server) documentService(r *http.Request, name string) (string, bool) {
+	if r.Method != http.MethodGet {
+		return "", false
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 4 || parts[1] != "v1" || parts[3] != name {
+		return "", false
+	}
+	if !s.isDiscovered(parts[2]) {
+		return "", false
+	}
+	return parts[2], true
+}
+
+// isDiscovered checks if the service is discovered
+func (s *Server) isDiscovered(service string) bool {
+	_, ok := s.discoverer.Services()[service]
+	return ok
+}
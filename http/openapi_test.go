@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/openapi"
+)
+
+func TestServer_OpenAPIHandler(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		version string
+	}{
+		{
+			name:   "document",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/openapi.json",
+			status: http.StatusOK,
+		},
+		{
+			name:    "versioned document",
+			method:  http.MethodGet,
+			path:    "/v1/a.Library/openapi.json?version=v1",
+			status:  http.StatusOK,
+			version: "v1",
+		},
+		{
+			name:   "service not found upstream",
+			method: http.MethodGet,
+			path:   "/v1/b.Shelf/openapi.json?version=v1",
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "service not discovered",
+			method: http.MethodGet,
+			path:   "/v1/c.Unknown/openapi.json",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "call",
+			method: http.MethodGet,
+			path:   "/v1/a.Library/GetBook",
+			status: http.StatusTeapot,
+		},
+		{
+			name:   "not GET",
+			method: http.MethodPost,
+			path:   "/v1/a.Library/openapi.json",
+			status: http.StatusTeapot,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	d.services = map[string][]string{
+		"a.Library": {"", "v1"},
+		"b.Shelf":   {"v1"},
+	}
+	server := New("foo", d, log.NewDiscard())
+	sd := newLibraryDescriptor(t)
+	newClient := func() Client {
+		c := newFakeClient(t)
+		c.sd = sd
+		return c
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			handlerF := server.OpenAPIHandler(newClient, next)
+			handlerF(rr, req)
+
+			if got, want := rr.Result().StatusCode, tc.status; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var doc openapi.Document
+			if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := doc.Info.Version, tc.version; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if _, ok := doc.Paths["/v1/a.Library/GetBook"]; !ok {
+				t.Errorf("operation of GetBook is missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/url"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/proxy/retry"
+)
+
+const attemptsHeader = "X-Grpc-Proxy-Attempts"
+
+// retryPolicy returns the retry policy for the upstream, which is the proxy-wide policy with the upstream's overrides applied.
+// nil is returned if retries are disabled.
+func (s *Server) retryPolicy(uc *config.Upstream) *config.Retry {
+	if s.retry == nil {
+		return nil
+	}
+	p := *s.retry
+	if uc != nil {
+		if uc.RetryMaxAttempts > 0 {
+			p.MaxAttempts = uc.RetryMaxAttempts
+		}
+		p.Methods = append(append([]string{}, p.Methods...), uc.RetryMethods...)
+		p.ExcludedMethods = append(append([]string{}, p.ExcludedMethods...), uc.NoRetryMethods...)
+	}
+	if p.MaxAttempts < 2 {
+		return nil
+	}
+	return &p
+}
+
+// retryBudget returns the retry budget for the upstream, creating it if it doesn't exist yet
+func (s *Server) retryBudget(u *url.URL) *retry.Budget {
+	s.budgetsMu.Lock()
+	defer s.budgetsMu.Unlock()
+	b, ok := s.budgets[u.String()]
+	if !ok {
+		b = retry.NewBudget(s.budgetRatio, s.budgetBurst)
+		s.budgets[u.String()] = b
+	}
+	return b
+}
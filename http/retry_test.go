@@ -0,0 +1,92 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/log"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+func TestServer_retryPolicy(t *testing.T) {
+	base := &config.Retry{
+		MaxAttempts:     3,
+		InitialBackoff:  100 * time.Millisecond,
+		MaxBackoff:      time.Second,
+		Methods:         []string{"a.Service/*"},
+		ExcludedMethods: []string{"a.Service/Delete"},
+	}
+	cases := []struct {
+		name     string
+		policy   *config.Retry
+		upstream *config.Upstream
+		expected *config.Retry
+	}{
+		{
+			name:     "proxy-wide policy",
+			policy:   base,
+			upstream: &config.Upstream{},
+			expected: &config.Retry{
+				MaxAttempts:     3,
+				InitialBackoff:  100 * time.Millisecond,
+				MaxBackoff:      time.Second,
+				Methods:         []string{"a.Service/*"},
+				ExcludedMethods: []string{"a.Service/Delete"},
+			},
+		},
+		{
+			name:   "upstream overrides",
+			policy: base,
+			upstream: &config.Upstream{
+				RetryMaxAttempts: 5,
+				RetryMethods:     []string{"b.Service/Get"},
+				NoRetryMethods:   []string{"a.Service/Update"},
+			},
+			expected: &config.Retry{
+				MaxAttempts:     5,
+				InitialBackoff:  100 * time.Millisecond,
+				MaxBackoff:      time.Second,
+				Methods:         []string{"a.Service/*", "b.Service/Get"},
+				ExcludedMethods: []string{"a.Service/Delete", "a.Service/Update"},
+			},
+		},
+		{
+			name:     "retries disabled by upstream",
+			policy:   base,
+			upstream: &config.Upstream{RetryMaxAttempts: 1},
+			expected: nil,
+		},
+		{
+			name:     "no policy",
+			policy:   nil,
+			upstream: &config.Upstream{RetryMaxAttempts: 3},
+			expected: nil,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := New("foo", d, log.NewDiscard(), WithRetry(tc.policy, 0.1, 10))
+			if got, want := server.retryPolicy(tc.upstream), tc.expected; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+	if got, want := base.Methods, []string{"a.Service/*"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("proxy-wide policy was modified: got %v, want %v", got, want)
+	}
+}
+
+func TestServer_retryBudget(t *testing.T) {
+	d := newFakeDiscoverer(t)
+	server := New("foo", d, log.NewDiscard(), WithRetry(&config.Retry{}, 0.1, 10))
+	a := server.retryBudget(proxytest.ParseURL(t, "a:5000"))
+	if got, want := server.retryBudget(proxytest.ParseURL(t, "a:5000")), a; got != want {
+		t.Fatal("budget should be shared for the same upstream")
+	}
+	if got, want := server.retryBudget(proxytest.ParseURL(t, "b:5000")), a; got == want {
+		t.Fatal("budget should not be shared between upstreams")
+	}
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"expvar"
+
 	"github.com/mercari/grpc-http-proxy/proxy"
 )
 
@@ -10,11 +12,19 @@ func (s *Server) registerHandlers() {
 	}
 
 	s.router.HandleFunc("/healthz", s.withLog(s.LivenessProbeHandler()))
-	s.router.HandleFunc("/v1/", apply(s.RPCCallHandler(newClient), []Adapter{
+	s.router.HandleFunc("/debug/vars", apply(expvar.Handler().ServeHTTP, []Adapter{
+		s.withAccessToken,
+		s.withLog,
+	}...))
+	s.router.HandleFunc("/v1/batch", apply(s.BatchHandler(newClient), []Adapter{
+		s.withAccessToken,
+		s.withLog,
+	}...))
+	s.router.HandleFunc("/v1/", apply(s.CatalogHandler(newClient, s.OpenAPIHandler(newClient, s.JSONSchemaHandler(newClient, s.HTTPRuleHandler(newClient, s.RPCCallHandler(newClient))))), []Adapter{
 		s.withAccessToken,
 		s.withLog,
 	}...))
-	s.router.HandleFunc("/", apply(s.CatchAllHandler(), []Adapter{
+	s.router.HandleFunc("/", apply(s.GRPCWebHandler(newClient, s.ConnectHandler(newClient, s.HTTPRuleHandler(newClient, s.CatchAllHandler()))), []Adapter{
 		s.withAccessToken,
 		s.withLog,
 	}...))
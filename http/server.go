@@ -5,37 +5,174 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
+	"github.com/jhump/protoreflect/desc"
 	"go.uber.org/zap"
+	grpc_metadata "google.golang.org/grpc/metadata"
 
+	"github.com/mercari/grpc-http-proxy/auth"
+	"github.com/mercari/grpc-http-proxy/breaker"
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/httprule"
+	"github.com/mercari/grpc-http-proxy/limiter"
 	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy"
+	"github.com/mercari/grpc-http-proxy/proxy/retry"
 )
 
 // Server is an grpc-http-proxy server
 type Server struct {
-	router      *http.ServeMux
-	accessToken string
-	client      Client
-	discoverer  Discoverer
-	logger      *zap.Logger
+	router         *http.ServeMux
+	tokens         *auth.Store
+	authenticator  auth.Authenticator
+	client         Client
+	discoverer     Discoverer
+	logger         *zap.Logger
+	defaultTimeout time.Duration
+	maxTimeout     time.Duration
+	retry          *config.Retry
+	budgetRatio    float64
+	budgetBurst    int
+	budgets        map[string]*retry.Budget
+	budgetsMu      sync.Mutex
+	breakers       *breaker.Breakers
+	upstreamLimits *limiter.Set
+	serviceLimits  *limiter.Set
+	dial           *config.Dial
+	rules          *httprule.Router
+	json           *config.JSON
+	batch          *config.Batch
+	descriptors    *descriptorCache
+	errorFormatter *perrors.Formatter
 }
 
-// New creates a new Server
+// Option configures the Server
+type Option func(*Server)
+
+// WithTimeouts sets the default deadline for calls, and the upper limit of deadlines.
+// Zero means no default deadline, or no upper limit respectively.
+func WithTimeouts(defaultTimeout, maxTimeout time.Duration) Option {
+	return func(s *Server) {
+		s.defaultTimeout = defaultTimeout
+		s.maxTimeout = maxTimeout
+	}
+}
+
+// WithRetry sets the proxy-wide retry policy, and the retry budget of each upstream.
+// See retry.NewBudget for the budget parameters.
+func WithRetry(policy *config.Retry, budgetRatio float64, budgetBurst int) Option {
+	return func(s *Server) {
+		s.retry = policy
+		s.budgetRatio = budgetRatio
+		s.budgetBurst = budgetBurst
+	}
+}
+
+// WithCircuitBreaker makes calls to upstreams fail fast while their circuits are open
+func WithCircuitBreaker(b *breaker.Breakers) Option {
+	return func(s *Server) {
+		s.breakers = b
+	}
+}
+
+// WithConcurrencyLimits limits the number of calls in flight to each upstream and each gRPC service
+func WithConcurrencyLimits(c *config.Concurrency) Option {
+	return func(s *Server) {
+		s.upstreamLimits = limiter.NewSet(c.MaxPerUpstream, nil, c.QueueSize, c.QueueTimeout)
+		s.serviceLimits = limiter.NewSet(c.MaxPerService, c.MaxByService, c.QueueSize, c.QueueTimeout)
+	}
+}
+
+// WithDialConfig sets the proxy-wide configuration of connections and calls to upstreams
+func WithDialConfig(d *config.Dial) Option {
+	return func(s *Server) {
+		s.dial = d
+	}
+}
+
+// WithJSONConfig sets the default options of the conversion between messages and JSON, which requests can override
+func WithJSONConfig(c *config.JSON) Option {
+	return func(s *Server) {
+		s.json = c
+	}
+}
+
+// WithBatchLimits sets the number of calls in a batch which are made concurrently, and the maximum number of calls in a batch
+func WithBatchLimits(b *config.Batch) Option {
+	return func(s *Server) {
+		s.batch = b
+	}
+}
+
+// WithDescriptorCacheTTL caches the descriptors of services obtained through reflection,
+// and the documents generated from them, for ttl
+func WithDescriptorCacheTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.descriptors = newDescriptorCache(ttl)
+	}
+}
+
+// WithErrorFormatter sets the format of the bodies of error responses, and their HTTP status codes
+func WithErrorFormatter(f *perrors.Formatter) Option {
+	return func(s *Server) {
+		s.errorFormatter = f
+	}
+}
+
+// WithTokenStore authenticates requests with the tokens in the store, instead of the token passed to New
+func WithTokenStore(store *auth.Store) Option {
+	return func(s *Server) {
+		s.tokens = store
+	}
+}
+
+// WithAuthenticator authenticates requests with bearer tokens in the Authorization header by the authenticator,
+// in addition to the access tokens
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(s *Server) {
+		s.authenticator = a
+	}
+}
+
+// New creates a new Server.
+// Requests must have the token, unless it is blank. The token is allowed to make any call.
 func New(token string,
 	discoverer Discoverer,
 	logger *zap.Logger,
+	opts ...Option,
 ) *Server {
 	s := &Server{
-		router:      http.NewServeMux(),
-		accessToken: token,
-		discoverer:  discoverer,
-		logger:      logger,
+		router:         http.NewServeMux(),
+		tokens:         newTokenStore(token),
+		discoverer:     discoverer,
+		logger:         logger,
+		budgets:        make(map[string]*retry.Budget),
+		upstreamLimits: limiter.NewSet(0, nil, 0, 0),
+		serviceLimits:  limiter.NewSet(0, nil, 0, 0),
+		rules:          httprule.NewRouter(),
+		batch:          &config.Batch{Parallelism: defaultBatchParallelism, MaxItems: defaultBatchMaxItems},
+		descriptors:    newDescriptorCache(0),
+		errorFormatter: &perrors.Formatter{Format: perrors.FormatProxy},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.registerHandlers()
 
 	return s
 }
 
+// ConcurrencyStats returns the number of calls in flight for each upstream and each gRPC service
+func (s *Server) ConcurrencyStats() map[string]map[string]int {
+	return map[string]map[string]int{
+		"upstreams": s.upstreamLimits.InFlight(),
+		"services":  s.serviceLimits.InFlight(),
+	}
+}
+
 // Serve starts the Server
 func (s *Server) Serve(ln net.Listener) error {
 	srv := &http.Server{
@@ -49,17 +186,35 @@ func (s *Server) Serve(ln net.Listener) error {
 
 // Client is a dynamic gRPC client that performs reflection
 type Client interface {
-	Connect(context.Context, *url.URL) error
+	Connect(context.Context, *url.URL, ...proxy.ConnectOption) error
 	CloseConn() error
+	DescribeService(context.Context, string) (*desc.ServiceDescriptor, error)
 	Call(context.Context,
 		string,
 		string,
 		[]byte,
 		*metadata.Metadata,
+		...proxy.CallOption,
 	) ([]byte, error)
+	CallServerStream(context.Context,
+		string,
+		string,
+		[]byte,
+		*metadata.Metadata,
+		func([]byte) error,
+		...proxy.CallOption,
+	) error
+	Forward(context.Context,
+		string,
+		[][]byte,
+		*metadata.Metadata,
+		proxy.ResponseWriter,
+	) (grpc_metadata.MD, error)
 }
 
 // Discoverer performs service discover
 type Discoverer interface {
 	Resolve(svc, version string) (*url.URL, error)
+	UpstreamConfig(u *url.URL) *config.Upstream
+	Services() map[string][]string
 }
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mercari/grpc-http-proxy/config"
+)
+
+const grpcTimeoutHeader = "Grpc-Timeout"
+
+// requestedTimeout returns the timeout requested by the caller, or zero if there is none.
+// The timeout is taken from the "timeout" query parameter in Go duration format (e.g. "1.5s"),
+// or from the Grpc-Timeout header in the gRPC wire format (e.g. "1500m").
+func requestedTimeout(r *http.Request) (time.Duration, error) {
+	if v, ok := r.URL.Query()["timeout"]; ok {
+		if len(v) != 1 {
+			return 0, errors.New("multiple timeouts specified")
+		}
+		d, err := time.ParseDuration(v[0])
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid timeout")
+		}
+		if d <= 0 {
+			return 0, errors.Errorf("timeout must be positive: %s", v[0])
+		}
+		return d, nil
+	}
+	if v := r.Header.Get(grpcTimeoutHeader); v != "" {
+		return parseGRPCTimeout(v)
+	}
+	return 0, nil
+}
+
+// parseGRPCTimeout parses timeouts formatted as the grpc-timeout header
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#requests
+func parseGRPCTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errors.Errorf("invalid timeout: %s", s)
+	}
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, errors.Errorf("invalid timeout unit: %s", s)
+	}
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.Errorf("invalid timeout value: %s", s)
+	}
+	return time.Duration(v) * unit, nil
+}
+
+// callTimeout decides the timeout of a call.
+// The requested timeout is used if there is one, and falls back to the upstream's and then the proxy's default.
+// The result is capped by the upstream's maximum timeout, or the proxy's if the upstream has none.
+func (s *Server) callTimeout(requested time.Duration, uc *config.Upstream) time.Duration {
+	if uc == nil {
+		uc = &config.Upstream{}
+	}
+	timeout := requested
+	if timeout == 0 {
+		timeout = uc.Timeout
+	}
+	if timeout == 0 {
+		timeout = s.defaultTimeout
+	}
+	max := uc.MaxTimeout
+	if max == 0 {
+		max = s.maxTimeout
+	}
+	if max > 0 && (timeout == 0 || timeout > max) {
+		timeout = max
+	}
+	return timeout
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	"github.com/mercari/grpc-http-proxy/log"
+)
+
+func TestRequestedTimeout(t *testing.T) {
+	cases := []struct {
+		name     string
+		path     string
+		header   string
+		timeout  time.Duration
+		errIsNil bool
+	}{
+		{
+			name:     "none",
+			path:     "/v1/svc/method",
+			timeout:  0,
+			errIsNil: true,
+		},
+		{
+			name:     "query parameter",
+			path:     "/v1/svc/method?timeout=1.5s",
+			timeout:  1500 * time.Millisecond,
+			errIsNil: true,
+		},
+		{
+			name:     "header",
+			path:     "/v1/svc/method",
+			header:   "200m",
+			timeout:  200 * time.Millisecond,
+			errIsNil: true,
+		},
+		{
+			name:     "query parameter takes precedence",
+			path:     "/v1/svc/method?timeout=1s",
+			header:   "200m",
+			timeout:  time.Second,
+			errIsNil: true,
+		},
+		{
+			name:     "multiple query parameters",
+			path:     "/v1/svc/method?timeout=1s&timeout=2s",
+			timeout:  0,
+			errIsNil: false,
+		},
+		{
+			name:     "negative query parameter",
+			path:     "/v1/svc/method?timeout=-1s",
+			timeout:  0,
+			errIsNil: false,
+		},
+		{
+			name:     "invalid header",
+			path:     "/v1/svc/method",
+			header:   "1s",
+			timeout:  0,
+			errIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.header != "" {
+				r.Header.Set(grpcTimeoutHeader, tc.header)
+			}
+			timeout, err := requestedTimeout(r)
+			if got, want := timeout, tc.timeout; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := err == nil, tc.errIsNil; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	cases := []struct {
+		value    string
+		timeout  time.Duration
+		errIsNil bool
+	}{
+		{"1H", time.Hour, true},
+		{"2M", 2 * time.Minute, true},
+		{"3S", 3 * time.Second, true},
+		{"4m", 4 * time.Millisecond, true},
+		{"5u", 5 * time.Microsecond, true},
+		{"6n", 6 * time.Nanosecond, true},
+		{"99999999S", 99999999 * time.Second, true},
+		{"100000000S", 0, false},
+		{"0S", 0, false},
+		{"S", 0, false},
+		{"1s", 0, false},
+		{"-1S", 0, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			timeout, err := parseGRPCTimeout(tc.value)
+			if got, want := timeout, tc.timeout; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := err == nil, tc.errIsNil; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_callTimeout(t *testing.T) {
+	cases := []struct {
+		name           string
+		defaultTimeout time.Duration
+		maxTimeout     time.Duration
+		upstream       *config.Upstream
+		requested      time.Duration
+		timeout        time.Duration
+	}{
+		{
+			name:     "no timeouts",
+			upstream: &config.Upstream{},
+			timeout:  0,
+		},
+		{
+			name:      "requested",
+			upstream:  &config.Upstream{},
+			requested: time.Second,
+			timeout:   time.Second,
+		},
+		{
+			name:           "proxy default",
+			defaultTimeout: 3 * time.Second,
+			upstream:       &config.Upstream{},
+			timeout:        3 * time.Second,
+		},
+		{
+			name:           "upstream default",
+			defaultTimeout: 3 * time.Second,
+			upstream:       &config.Upstream{Timeout: 2 * time.Second},
+			timeout:        2 * time.Second,
+		},
+		{
+			name:       "capped by proxy maximum",
+			maxTimeout: 10 * time.Second,
+			upstream:   &config.Upstream{},
+			requested:  time.Minute,
+			timeout:    10 * time.Second,
+		},
+		{
+			name:       "capped by upstream maximum",
+			maxTimeout: 10 * time.Second,
+			upstream:   &config.Upstream{MaxTimeout: 20 * time.Second},
+			requested:  time.Minute,
+			timeout:    20 * time.Second,
+		},
+		{
+			name:       "maximum without default",
+			maxTimeout: 10 * time.Second,
+			upstream:   nil,
+			timeout:    10 * time.Second,
+		},
+	}
+	d := newFakeDiscoverer(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := New("foo", d, log.NewDiscard(), WithTimeouts(tc.defaultTimeout, tc.maxTimeout))
+			if got, want := server.callTimeout(tc.requested, tc.upstream), tc.timeout; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/mercari/grpc-http-proxy/auth"
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/proxy"
+)
+
+// connection is a connection to the upstream of a callee, which is ready for a call
+type connection struct {
+	ctx      context.Context
+	upstream *url.URL
+	config   *config.Upstream
+	client   Client
+	closers  []func()
+	// requestedDeadline tells that the deadline of the call is the one requested by the caller
+	requestedDeadline bool
+}
+
+// close closes the connection and releases the resources held for the call
+func (c *connection) close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
+	}
+}
+
+// connectUpstream resolves the upstream of the callee and connects to it,
+// after applying the timeout, the concurrency limits and the circuit breaker.
+// The result of the call must be passed to record, and the connection must be closed afterwards.
+func (s *Server) connectUpstream(ctx context.Context,
+	newClient func() Client,
+	c callee,
+	requested time.Duration,
+) (*connection, error) {
+	if err := authorize(ctx, c); err != nil {
+		return nil, err
+	}
+	u, err := s.discoverer.Resolve(c.Service, c.ServiceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return s.connect(ctx, newClient, u, c.Service, requested)
+}
+
+// connect connects to the upstream u of the service in the same way as connectUpstream, for callers which resolved it already
+func (s *Server) connect(ctx context.Context,
+	newClient func() Client,
+	u *url.URL,
+	service string,
+	requested time.Duration,
+) (*connection, error) {
+	conn := &connection{
+		upstream: u,
+		config:   s.discoverer.UpstreamConfig(u),
+	}
+	if timeout := s.callTimeout(requested, conn.config); timeout > 0 {
+		conn.requestedDeadline = timeout == requested
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		conn.closers = append(conn.closers, cancel)
+	}
+	conn.ctx = ctx
+	release, err := s.acquire(ctx, u, service)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+	conn.closers = append(conn.closers, release)
+	if s.breakers != nil {
+		if err := s.breakers.Allow(u); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+
+	// TODO: Re-Use connections instead of creating a new connection for each request.
+	client := newClient()
+	if err := client.Connect(ctx, u,
+		proxy.WithDialConfig(s.dialConfig(conn.config)),
+		proxy.WithTypeCache(s.descriptors.typeCache(u)),
+	); err != nil {
+		perr := &perrors.ProxyError{
+			Code:    perrors.UpstreamConnFailure,
+			Message: fmt.Sprintf("could not connect to upstream %s: %s", u.String(), err.Error()),
+		}
+		s.record(conn, perr)
+		conn.close()
+		return nil, perr
+	}
+	conn.client = client
+	conn.closers = append(conn.closers, func() {
+		client.CloseConn()
+	})
+	return conn, nil
+}
+
+// authorize checks that the identity of the request, if any, is allowed to call the callee
+func authorize(ctx context.Context, c callee) error {
+	id, ok := auth.FromContext(ctx)
+	if !ok || id.Allows(c.Service, c.Method, c.ServiceVersion) {
+		return nil
+	}
+	target := c.Service
+	if c.Method != "" {
+		target += "/" + c.Method
+	}
+	if c.ServiceVersion != "" {
+		target += " of version " + c.ServiceVersion
+	}
+	return &perrors.ProxyError{
+		Code:    perrors.PermissionDenied,
+		Message: fmt.Sprintf("the token %s is not allowed to call %s", id.Name, target),
+	}
+}
+
+// record records the result of the call made through the connection.
+// Calls which exceeded the deadline requested by the caller are released without being recorded.
+func (s *Server) record(conn *connection, err error) {
+	if s.breakers == nil {
+		return
+	}
+	if perr, ok := errors.Cause(err).(*perrors.ProxyError); ok && perr.Code == perrors.DeadlineExceeded && conn.requestedDeadline {
+		s.breakers.Release(conn.upstream)
+		return
+	}
+	s.breakers.Record(conn.upstream, err)
+}
+
+// release ends the call made through the connection without recording its result, such as a dry run
+func (s *Server) release(conn *connection) {
+	if s.breakers != nil {
+		s.breakers.Release(conn.upstream)
+	}
+}
+
+// logCallError logs the error of a call.
+// Errors in resolving the service are logged with the known versions and the suggested services.
+func (s *Server) logCallError(err error) {
+	fields := []zap.Field{zap.String("err", err.Error())}
+	if perr, ok := errors.Cause(err).(*perrors.ProxyError); ok && perr.Resolution != nil {
+		fields = append(fields,
+			zap.String("message", perr.Message),
+			zap.String("service", perr.Resolution.Service),
+			zap.String("version", perr.Resolution.Version),
+			zap.Strings("known_versions", perr.Resolution.Versions),
+			zap.Strings("suggested_services", perr.Resolution.Suggestions),
+		)
+	}
+	s.logger.Error("error in handling call", fields...)
+}
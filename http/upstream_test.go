@@ -0,0 +1,85 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+func TestServer_LogCallError(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		fields map[string]interface{}
+	}{
+		{
+			name: "error",
+			err:  &perrors.ProxyError{Code: perrors.MethodNotFound, Message: "the method a was not found"},
+			fields: map[string]interface{}{
+				"err": "no such gRPC method",
+			},
+		},
+		{
+			name: "resolution",
+			err: errors.Wrap(&perrors.ProxyError{
+				Code:    perrors.VersionNotSpecified,
+				Message: "specify the version",
+				Resolution: &perrors.ResolutionError{
+					Service:  "a.Library",
+					Versions: []string{"v1", "v2"},
+				},
+			}, "resolving"),
+			fields: map[string]interface{}{
+				"err":                "resolving: multiple versions of this service exist. specify version in request",
+				"message":            "specify the version",
+				"service":            "a.Library",
+				"version":            "",
+				"known_versions":     []interface{}{"v1", "v2"},
+				"suggested_services": []interface{}{},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			server := New("foo", newFakeDiscoverer(t), zap.New(core))
+			server.logCallError(tc.err)
+
+			if got, want := logs.Len(), 1; got != want {
+				t.Fatalf("got %d log entries, want %d", got, want)
+			}
+			got := logs.All()[0].ContextMap()
+			if len(got) != len(tc.fields) {
+				t.Fatalf("got %v, want %v", got, tc.fields)
+			}
+			for k, want := range tc.fields {
+				if got := got[k]; !equalLogField(got, want) {
+					t.Errorf("%s: got %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+// equalLogField compares a field of a log entry, whose arrays are compared by their elements
+func equalLogField(got, want interface{}) bool {
+	w, ok := want.([]interface{})
+	if !ok {
+		return got == want
+	}
+	g, ok := got.([]interface{})
+	if !ok || len(g) != len(w) {
+		return false
+	}
+	for i := range w {
+		if g[i] != w[i] {
+			return false
+		}
+	}
+	return true
+}
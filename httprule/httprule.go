@@ -0,0 +1,189 @@
+package httprule
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// Rule maps an HTTP method and path template to a gRPC method, as specified by a google.api.http option
+type Rule struct {
+	// HTTPMethod is the HTTP method, such as "GET", or the kind of a custom pattern
+	HTTPMethod string
+
+	// Template is the path template
+	Template *Template
+
+	// Service is the fully qualified name of the gRPC service
+	Service string
+
+	// Method is the name of the gRPC method
+	Method string
+
+	// Body is the field of the input message which the request body is mapped to.
+	// "*" means the whole message, and empty means that the request has no body.
+	Body string
+
+	// ResponseBody is the field of the output message which is mapped to the response body.
+	// Empty means the whole message.
+	ResponseBody string
+}
+
+// RulesFromService reads the rules from the google.api.http options of the methods of the service.
+// Rules which cannot be parsed are returned as errors along with the valid ones.
+func RulesFromService(sd *desc.ServiceDescriptor) ([]*Rule, []error) {
+	var rules []*Rule
+	var errs []error
+	for _, md := range sd.GetMethods() {
+		if md.IsClientStreaming() || md.IsServerStreaming() {
+			continue
+		}
+		opts := md.GetMethodOptions()
+		if opts == nil || !proto.HasExtension(opts, annotations.E_Http) {
+			continue
+		}
+		ext, err := proto.GetExtension(opts, annotations.E_Http)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid google.api.http option of %s", md.GetFullyQualifiedName()))
+			continue
+		}
+		hr, ok := ext.(*annotations.HttpRule)
+		if !ok {
+			continue
+		}
+		bindings := append([]*annotations.HttpRule{hr}, hr.GetAdditionalBindings()...)
+		for _, b := range bindings {
+			r, err := newRule(sd.GetFullyQualifiedName(), md.GetName(), b)
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "invalid google.api.http option of %s", md.GetFullyQualifiedName()))
+				continue
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, errs
+}
+
+func newRule(service, method string, hr *annotations.HttpRule) (*Rule, error) {
+	var httpMethod, path string
+	switch p := hr.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		httpMethod, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		httpMethod, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		httpMethod, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		httpMethod, path = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		httpMethod, path = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		httpMethod, path = strings.ToUpper(p.Custom.GetKind()), p.Custom.GetPath()
+	default:
+		return nil, errors.New("no pattern is specified")
+	}
+	t, err := ParseTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{
+		HTTPMethod:   httpMethod,
+		Template:     t,
+		Service:      service,
+		Method:       method,
+		Body:         hr.GetBody(),
+		ResponseBody: hr.GetResponseBody(),
+	}, nil
+}
+
+// Router finds the rule for HTTP requests.
+// It is safe for concurrent use, and its rules can be replaced while requests are being routed.
+type Router struct {
+	services map[string][]*Rule
+	rules    []*Rule
+	mu       sync.RWMutex
+}
+
+// NewRouter creates a Router without rules
+func NewRouter() *Router {
+	return &Router{
+		services: make(map[string][]*Rule),
+	}
+}
+
+// SetRules replaces the rules of the gRPC service
+func (r *Router) SetRules(service string, rules []*Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services[service] = rules
+	r.sortRules()
+}
+
+// Retain removes the rules of the gRPC services other than services
+func (r *Router) Retain(services []string) {
+	retained := make(map[string][]*Rule, len(services))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range services {
+		if rules, ok := r.services[s]; ok {
+			retained[s] = rules
+		}
+	}
+	r.services = retained
+	r.sortRules()
+}
+
+// sortRules flattens the rules of all services.
+// Templates with more literal segments come first, so that "/v1/books:search" is matched before "/v1/{name}".
+func (r *Router) sortRules() {
+	names := make([]string, 0, len(r.services))
+	for s := range r.services {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	rules := make([]*Rule, 0)
+	for _, s := range names {
+		rules = append(rules, r.services[s]...)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Template.literals() > rules[j].Template.literals()
+	})
+	r.rules = rules
+}
+
+// Rules returns the rules of all gRPC services
+func (r *Router) Rules() []*Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rules
+}
+
+// HasService checks if the rules of the gRPC service were loaded into the router
+func (r *Router) HasService(service string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.services[service]
+	return ok
+}
+
+// Match finds the rule for the HTTP method and escaped path, and returns it with the values of the path variables.
+// nil is returned if no rule matches.
+func (r *Router) Match(httpMethod, path string) (*Rule, map[string]string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rule := range r.rules {
+		if rule.HTTPMethod != httpMethod {
+			continue
+		}
+		if values, ok := rule.Template.Match(path); ok {
+			return rule, values
+		}
+	}
+	return nil, nil
+}
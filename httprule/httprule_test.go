@@ -0,0 +1,217 @@
+package httprule
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/genproto/googleapis/api/annotations"
+)
+
+func newServiceDescriptor(t *testing.T) *desc.ServiceDescriptor {
+	t.Helper()
+	method := func(name string, hr *annotations.HttpRule) *dpb.MethodDescriptorProto {
+		opts := &dpb.MethodOptions{}
+		if hr != nil {
+			if err := proto.SetExtension(opts, annotations.E_Http, hr); err != nil {
+				t.Fatal(err.Error())
+			}
+			// options of reflected descriptors hold the extension as raw bytes
+			b, err := proto.Marshal(opts)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			opts = &dpb.MethodOptions{}
+			if err := proto.Unmarshal(b, opts); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		return &dpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".httprule.testing.Book"),
+			OutputType: proto.String(".httprule.testing.Book"),
+			Options:    opts,
+		}
+	}
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("httprule_testing.proto"),
+		Package: proto.String("httprule.testing"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*dpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+		},
+		Service: []*dpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Library"),
+				Method: []*dpb.MethodDescriptorProto{
+					method("GetBook", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=books/*}"},
+						AdditionalBindings: []*annotations.HttpRule{
+							{Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"}},
+						},
+					}),
+					method("UpdateBook", &annotations.HttpRule{
+						Pattern:      &annotations.HttpRule_Patch{Patch: "/v1/{name=books/*}"},
+						Body:         "*",
+						ResponseBody: "name",
+					}),
+					method("SearchBooks", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Custom{
+							Custom: &annotations.CustomHttpPattern{Kind: "search", Path: "/v1/books"},
+						},
+					}),
+					method("Invalid", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Get{Get: "v1/invalid"},
+					}),
+					method("Unannotated", nil),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd.FindService("httprule.testing.Library")
+}
+
+func TestRulesFromService(t *testing.T) {
+	rules, errs := RulesFromService(newServiceDescriptor(t))
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("got %d, want %d: %v", got, want, errs)
+	}
+	expected := []struct {
+		httpMethod   string
+		template     string
+		method       string
+		body         string
+		responseBody string
+	}{
+		{http.MethodGet, "/v1/{name=books/*}", "GetBook", "", ""},
+		{http.MethodGet, "/v1/{name=shelves/*/books/*}", "GetBook", "", ""},
+		{http.MethodPatch, "/v1/{name=books/*}", "UpdateBook", "*", "name"},
+		{"SEARCH", "/v1/books", "SearchBooks", "", ""},
+	}
+	if got, want := len(rules), len(expected); got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+	for i, e := range expected {
+		r := rules[i]
+		if got, want := r.HTTPMethod, e.httpMethod; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := r.Template.String(), e.template; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := r.Service, "httprule.testing.Library"; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := r.Method, e.method; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := r.Body, e.body; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := r.ResponseBody, e.responseBody; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestRouter_Match(t *testing.T) {
+	rule := func(httpMethod, template, method string) *Rule {
+		tmpl, err := ParseTemplate(template)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return &Rule{
+			HTTPMethod: httpMethod,
+			Template:   tmpl,
+			Service:    "a.Library",
+			Method:     method,
+		}
+	}
+	r := NewRouter()
+	r.SetRules("a.Library", []*Rule{
+		rule(http.MethodGet, "/v1/books/{id}", "GetBook"),
+		rule(http.MethodGet, "/v1/books/featured", "GetFeaturedBook"),
+		rule(http.MethodDelete, "/v1/books/{id}", "DeleteBook"),
+	})
+	r.SetRules("b.Library", nil)
+
+	cases := []struct {
+		name       string
+		httpMethod string
+		path       string
+		method     string
+	}{
+		{
+			name:       "variable",
+			httpMethod: http.MethodGet,
+			path:       "/v1/books/1",
+			method:     "GetBook",
+		},
+		{
+			name:       "more literals first",
+			httpMethod: http.MethodGet,
+			path:       "/v1/books/featured",
+			method:     "GetFeaturedBook",
+		},
+		{
+			name:       "other HTTP method",
+			httpMethod: http.MethodDelete,
+			path:       "/v1/books/1",
+			method:     "DeleteBook",
+		},
+		{
+			name:       "no HTTP method",
+			httpMethod: http.MethodPut,
+			path:       "/v1/books/1",
+			method:     "",
+		},
+		{
+			name:       "no path",
+			httpMethod: http.MethodGet,
+			path:       "/v1/shelves/1",
+			method:     "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, _ := r.Match(tc.httpMethod, tc.path)
+			var method string
+			if rule != nil {
+				method = rule.Method
+			}
+			if got, want := method, tc.method; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+	if !r.HasService("b.Library") {
+		t.Fatal("service without rules should be loaded")
+	}
+	if r.HasService("c.Library") {
+		t.Fatal("service should not be loaded")
+	}
+
+	r.Retain([]string{"b.Library"})
+	if rule, _ := r.Match(http.MethodGet, "/v1/books/1"); rule != nil {
+		t.Fatal("rules of removed services should not match")
+	}
+	if r.HasService("a.Library") {
+		t.Fatal("service should be removed")
+	}
+}
@@ -0,0 +1,233 @@
+package httprule
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type segmentKind int
+
+const (
+	literal segmentKind = iota
+	// wildcard matches a single path segment
+	wildcard
+	// deepWildcard matches zero or more path segments
+	deepWildcard
+)
+
+type segment struct {
+	kind    segmentKind
+	literal string
+}
+
+// variable binds the path segments from start to end (exclusive) of a template to a field
+type variable struct {
+	fieldPath  string
+	start, end int
+}
+
+// Template is a parsed path template of a google.api.http rule, such as "/v1/{name=shelves/*/books/*}:publish"
+type Template struct {
+	raw       string
+	segments  []segment
+	variables []variable
+	verb      string
+}
+
+// ParseTemplate parses a path template following the syntax described in google/api/http.proto
+func ParseTemplate(s string) (*Template, error) {
+	if !strings.HasPrefix(s, "/") {
+		return nil, errors.Errorf("path template %s must start with /", s)
+	}
+	t := &Template{raw: s}
+	p := &templateParser{s: s[1:], t: t}
+	if err := p.parseSegments(); err != nil {
+		return nil, errors.Wrapf(err, "invalid path template %s", s)
+	}
+	if strings.HasPrefix(p.s, ":") {
+		t.verb = p.s[1:]
+		p.s = ""
+	}
+	if p.s != "" {
+		return nil, errors.Errorf("invalid path template %s: unexpected %q", s, p.s)
+	}
+	for i, seg := range t.segments {
+		if seg.kind == deepWildcard && i != len(t.segments)-1 {
+			return nil, errors.Errorf("invalid path template %s: ** must be the last segment", s)
+		}
+	}
+	return t, nil
+}
+
+type templateParser struct {
+	s string
+	t *Template
+}
+
+func (p *templateParser) parseSegments() error {
+	for {
+		if err := p.parseSegment(); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(p.s, "/") {
+			return nil
+		}
+		p.s = p.s[1:]
+	}
+}
+
+func (p *templateParser) parseSegment() error {
+	switch {
+	case strings.HasPrefix(p.s, "**"):
+		p.s = p.s[2:]
+		p.t.segments = append(p.t.segments, segment{kind: deepWildcard})
+	case strings.HasPrefix(p.s, "*"):
+		p.s = p.s[1:]
+		p.t.segments = append(p.t.segments, segment{kind: wildcard})
+	case strings.HasPrefix(p.s, "{"):
+		return p.parseVariable()
+	default:
+		i := strings.IndexAny(p.s, "/:{}*")
+		if i < 0 {
+			i = len(p.s)
+		}
+		if i == 0 {
+			return fmt.Errorf("empty segment at %q", p.s)
+		}
+		p.t.segments = append(p.t.segments, segment{kind: literal, literal: p.s[:i]})
+		p.s = p.s[i:]
+	}
+	return nil
+}
+
+func (p *templateParser) parseVariable() error {
+	end := strings.Index(p.s, "}")
+	if end < 0 {
+		return fmt.Errorf("unclosed variable at %q", p.s)
+	}
+	body := p.s[1:end]
+	rest := p.s[end+1:]
+	fieldPath, segments := body, "*"
+	if i := strings.Index(body, "="); i >= 0 {
+		fieldPath, segments = body[:i], body[i+1:]
+	}
+	if fieldPath == "" {
+		return fmt.Errorf("variable without a field path at %q", p.s)
+	}
+	if p.t.variable(fieldPath) != nil {
+		return fmt.Errorf("variable %s is bound more than once", fieldPath)
+	}
+	if strings.ContainsAny(segments, "{}") {
+		return fmt.Errorf("nested variable in %s", fieldPath)
+	}
+	start := len(p.t.segments)
+	inner := &templateParser{s: segments, t: p.t}
+	if err := inner.parseSegments(); err != nil {
+		return err
+	}
+	if inner.s != "" {
+		return fmt.Errorf("unexpected %q in variable %s", inner.s, fieldPath)
+	}
+	p.t.variables = append(p.t.variables, variable{
+		fieldPath: fieldPath,
+		start:     start,
+		end:       len(p.t.segments),
+	})
+	p.s = rest
+	return nil
+}
+
+func (t *Template) variable(fieldPath string) *variable {
+	for i := range t.variables {
+		if t.variables[i].fieldPath == fieldPath {
+			return &t.variables[i]
+		}
+	}
+	return nil
+}
+
+// String returns the template as it was written
+func (t *Template) String() string {
+	return t.raw
+}
+
+// FieldPaths returns the field paths bound by the variables of the template
+func (t *Template) FieldPaths() []string {
+	paths := make([]string, 0, len(t.variables))
+	for _, v := range t.variables {
+		paths = append(paths, v.fieldPath)
+	}
+	return paths
+}
+
+// literals returns the number of literal segments, which is used to prefer more specific templates
+func (t *Template) literals() int {
+	n := 0
+	for _, seg := range t.segments {
+		if seg.kind == literal {
+			n++
+		}
+	}
+	if t.verb != "" {
+		n++
+	}
+	return n
+}
+
+// Match matches the path against the template, and returns the unescaped values of the variables keyed by their field paths.
+// The path must be escaped, as returned by url.URL.EscapedPath, so that escaped slashes in variables are not taken as separators.
+// The second return value is false if the path doesn't match.
+func (t *Template) Match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	path = path[1:]
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+	parts := strings.Split(path, "/")
+	if path == "" {
+		parts = nil
+	}
+
+	// positions[i] is the index of the first part matched by segments[i]
+	positions := make([]int, len(t.segments)+1)
+	i := 0
+	for ; i < len(t.segments); i++ {
+		positions[i] = i
+		if t.segments[i].kind == deepWildcard {
+			break
+		}
+		if i >= len(parts) || parts[i] == "" {
+			return nil, false
+		}
+		if t.segments[i].kind == literal && t.segments[i].literal != parts[i] {
+			return nil, false
+		}
+	}
+	switch {
+	case i < len(t.segments):
+		// the last segment is **, which matches the rest of the path
+		positions[len(t.segments)] = len(parts)
+	case i == len(parts):
+		positions[len(t.segments)] = len(parts)
+	default:
+		return nil, false
+	}
+
+	values := make(map[string]string, len(t.variables))
+	for _, v := range t.variables {
+		value := strings.Join(parts[positions[v.start]:positions[v.end]], "/")
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		values[v.fieldPath] = value
+	}
+	return values, true
+}
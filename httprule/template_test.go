@@ -0,0 +1,177 @@
+package httprule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	cases := []struct {
+		name       string
+		template   string
+		fieldPaths []string
+		errorIsNil bool
+	}{
+		{
+			name:       "literals",
+			template:   "/v1/books",
+			fieldPaths: []string{},
+			errorIsNil: true,
+		},
+		{
+			name:       "variables",
+			template:   "/v1/shelves/{shelf}/books/{book.id}",
+			fieldPaths: []string{"shelf", "book.id"},
+			errorIsNil: true,
+		},
+		{
+			name:       "variable with segments",
+			template:   "/v1/{name=shelves/*/books/*}:publish",
+			fieldPaths: []string{"name"},
+			errorIsNil: true,
+		},
+		{
+			name:       "deep wildcard",
+			template:   "/v1/{name=files/**}",
+			fieldPaths: []string{"name"},
+			errorIsNil: true,
+		},
+		{
+			name:       "no leading slash",
+			template:   "v1/books",
+			errorIsNil: false,
+		},
+		{
+			name:       "unclosed variable",
+			template:   "/v1/{name",
+			errorIsNil: false,
+		},
+		{
+			name:       "variable bound twice",
+			template:   "/v1/{name}/{name}",
+			errorIsNil: false,
+		},
+		{
+			name:       "deep wildcard in the middle",
+			template:   "/v1/**/books",
+			errorIsNil: false,
+		},
+		{
+			name:       "empty segment",
+			template:   "/v1//books",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tc.template)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := tmpl.FieldPaths(), tc.fieldPaths; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTemplate_Match(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		path     string
+		values   map[string]string
+		matched  bool
+	}{
+		{
+			name:     "literals",
+			template: "/v1/books",
+			path:     "/v1/books",
+			values:   map[string]string{},
+			matched:  true,
+		},
+		{
+			name:     "variables",
+			template: "/v1/shelves/{shelf}/books/{book.id}",
+			path:     "/v1/shelves/1/books/2",
+			values:   map[string]string{"shelf": "1", "book.id": "2"},
+			matched:  true,
+		},
+		{
+			name:     "variable with segments",
+			template: "/v1/{name=shelves/*/books/*}",
+			path:     "/v1/shelves/1/books/2",
+			values:   map[string]string{"name": "shelves/1/books/2"},
+			matched:  true,
+		},
+		{
+			name:     "verb",
+			template: "/v1/{name=books/*}:publish",
+			path:     "/v1/books/1:publish",
+			values:   map[string]string{"name": "books/1"},
+			matched:  true,
+		},
+		{
+			name:     "deep wildcard",
+			template: "/v1/{name=files/**}",
+			path:     "/v1/files/a/b/c",
+			values:   map[string]string{"name": "files/a/b/c"},
+			matched:  true,
+		},
+		{
+			name:     "escaped variable",
+			template: "/v1/books/{id}",
+			path:     "/v1/books/a%2Fb",
+			values:   map[string]string{"id": "a/b"},
+			matched:  true,
+		},
+		{
+			name:     "different literal",
+			template: "/v1/books/{id}",
+			path:     "/v1/shelves/1",
+			matched:  false,
+		},
+		{
+			name:     "too long",
+			template: "/v1/books/{id}",
+			path:     "/v1/books/1/pages",
+			matched:  false,
+		},
+		{
+			name:     "too short",
+			template: "/v1/books/{id}",
+			path:     "/v1/books",
+			matched:  false,
+		},
+		{
+			name:     "empty variable",
+			template: "/v1/books/{id}",
+			path:     "/v1/books/",
+			matched:  false,
+		},
+		{
+			name:     "missing verb",
+			template: "/v1/{name=books/*}:publish",
+			path:     "/v1/books/1",
+			matched:  false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			values, matched := tmpl.Match(tc.path)
+			if got, want := matched, tc.matched; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+			if got, want := values, tc.values; matched && !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// Set holds a Limiter for each key, which share the same limits unless they are overridden
+type Set struct {
+	max          int
+	overrides    map[string]int
+	queueSize    int
+	queueTimeout time.Duration
+	m            map[string]*Limiter
+	mu           sync.Mutex
+}
+
+// NewSet creates a new Set.
+// Each key allows max calls in flight, or the max in overrides for the key if any,
+// and up to queueSize calls waiting for at most queueTimeout.
+// A max of zero means no limit.
+func NewSet(max int, overrides map[string]int, queueSize int, queueTimeout time.Duration) *Set {
+	return &Set{
+		max:          max,
+		overrides:    overrides,
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+		m:            make(map[string]*Limiter),
+	}
+}
+
+// Acquire acquires a slot for a call for the key.
+// The returned function must be called to release the slot once the call is finished.
+func (s *Set) Acquire(ctx context.Context, key string) (func(), error) {
+	return s.limiter(key).Acquire(ctx)
+}
+
+// InFlight returns the number of calls in flight for each key
+func (s *Set) InFlight() map[string]int {
+	s.mu.Lock()
+	limiters := make(map[string]*Limiter, len(s.m))
+	for k, l := range s.m {
+		limiters[k] = l
+	}
+	s.mu.Unlock()
+
+	m := make(map[string]int, len(limiters))
+	for k, l := range limiters {
+		m[k] = l.InFlight()
+	}
+	return m
+}
+
+func (s *Set) limiter(key string) *Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.m[key]
+	if !ok {
+		max, ok := s.overrides[key]
+		if !ok {
+			max = s.max
+		}
+		l = New(key, max, s.queueSize, s.queueTimeout)
+		s.m[key] = l
+	}
+	return l
+}
+
+// Limiter limits the number of calls in flight, and queues calls over the limit
+type Limiter struct {
+	name         string
+	sem          chan struct{}
+	queueSize    int
+	queueTimeout time.Duration
+	inFlight     int
+	waiting      int
+	mu           sync.Mutex
+}
+
+// New creates a new Limiter which allows max calls in flight,
+// and up to queueSize calls waiting for at most queueTimeout.
+// A max of zero means no limit, in which case calls in flight are only counted.
+func New(name string, max, queueSize int, queueTimeout time.Duration) *Limiter {
+	l := &Limiter{
+		name:         name,
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+	}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+// Acquire acquires a slot for a call, waiting in the queue if necessary.
+// The returned function must be called to release the slot once the call is finished.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l.sem == nil {
+		l.add(1)
+		return func() { l.add(-1) }, nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		l.add(1)
+		return l.release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.waiting >= l.queueSize {
+		l.mu.Unlock()
+		return nil, l.limitExceeded("the queue is full")
+	}
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		l.add(1)
+		return l.release, nil
+	case <-timer.C:
+		return nil, l.limitExceeded("timed out in the queue")
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &perrors.ProxyError{
+				Code:    perrors.DeadlineExceeded,
+				Message: fmt.Sprintf("deadline exceeded while waiting for a call to %s", l.name),
+			}
+		}
+		return nil, l.limitExceeded("the call was finished in the queue")
+	}
+}
+
+// InFlight returns the number of calls in flight
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+func (l *Limiter) add(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight += n
+}
+
+func (l *Limiter) release() {
+	l.add(-1)
+	<-l.sem
+}
+
+func (l *Limiter) limitExceeded(reason string) error {
+	return &perrors.ProxyError{
+		Code:    perrors.ConcurrencyLimitExceeded,
+		Message: fmt.Sprintf("too many concurrent calls to %s; %s", l.name, reason),
+	}
+}
@@ -0,0 +1,174 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+func assertLimitExceeded(t *testing.T, err error) {
+	t.Helper()
+	perr, ok := err.(*perrors.ProxyError)
+	if !ok {
+		t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+	}
+	if got, want := perr.Code, perrors.ConcurrencyLimitExceeded; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	t.Run("within limit", func(t *testing.T) {
+		l := New("a", 2, 0, time.Second)
+		r1, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		r2, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if got, want := l.InFlight(), 2; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+		r1()
+		r2()
+		if got, want := l.InFlight(), 0; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		l := New("a", 1, 0, time.Second)
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer release()
+		_, err = l.Acquire(context.Background())
+		assertLimitExceeded(t, err)
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		l := New("a", 1, 1, 10*time.Millisecond)
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer release()
+		_, err = l.Acquire(context.Background())
+		assertLimitExceeded(t, err)
+	})
+
+	t.Run("context finished in queue", func(t *testing.T) {
+		l := New("a", 1, 1, time.Minute)
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer release()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = l.Acquire(ctx)
+		assertLimitExceeded(t, err)
+	})
+
+	t.Run("deadline exceeded in queue", func(t *testing.T) {
+		l := New("a", 1, 1, time.Minute)
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer release()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = l.Acquire(ctx)
+		perr, ok := err.(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.DeadlineExceeded; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("released while queued", func(t *testing.T) {
+		l := New("a", 1, 1, time.Minute)
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			release()
+		}()
+		release, err = l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		release()
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		l := New("a", 0, 0, 0)
+		for i := 0; i < 10; i++ {
+			if _, err := l.Acquire(context.Background()); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if got, want := l.InFlight(), 10; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+}
+
+func TestSet(t *testing.T) {
+	s := NewSet(1, nil, 0, time.Second)
+	release, err := s.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := s.Acquire(context.Background(), "a"); err == nil {
+		t.Fatal("err should not be nil")
+	}
+	releaseB, err := s.Acquire(context.Background(), "b")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got, want := s.InFlight(), map[string]int{"a": 1, "b": 1}; got["a"] != want["a"] || got["b"] != want["b"] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	release()
+	releaseB()
+	if got, want := s.InFlight(), map[string]int{"a": 0, "b": 0}; got["a"] != want["a"] || got["b"] != want["b"] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestSet_overrides(t *testing.T) {
+	s := NewSet(1, map[string]int{"large": 2, "unlimited": 0}, 0, time.Second)
+	cases := []struct {
+		key   string
+		calls int
+	}{
+		{key: "default", calls: 1},
+		{key: "large", calls: 2},
+		{key: "unlimited", calls: 10},
+	}
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			for i := 0; i < tc.calls; i++ {
+				if _, err := s.Acquire(context.Background(), tc.key); err != nil {
+					t.Fatalf("call %d: %s", i, err.Error())
+				}
+			}
+			if tc.key == "unlimited" {
+				return
+			}
+			_, err := s.Acquire(context.Background(), tc.key)
+			assertLimitExceeded(t, err)
+		})
+	}
+}
@@ -19,6 +19,20 @@ func MetadataFromHeaders(raw map[string][]string) Metadata {
 	return m
 }
 
+// MetadataFromRawHeaders converts all headers into metadata except the ones in excluded, which are in lower case.
+// This is for protocols whose clients send metadata as plain headers, such as gRPC-Web.
+func MetadataFromRawHeaders(raw map[string][]string, excluded map[string]struct{}) Metadata {
+	m := make(map[string][]string, len(raw))
+	for rawK, v := range raw {
+		k := strings.ToLower(rawK)
+		if _, ok := excluded[k]; ok {
+			continue
+		}
+		m[k] = append(m[k], v...)
+	}
+	return m
+}
+
 func extractGrpcMetadataKey(rawKey string) string {
 	if !strings.HasPrefix(rawKey, metadataHeaderPrefix) {
 		return ""
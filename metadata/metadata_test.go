@@ -58,3 +58,21 @@ func TestMetadata_ToHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataFromRawHeaders(t *testing.T) {
+	headers := map[string][]string{
+		"Authorization": {"Bearer foo"},
+		"X-Custom":      {"a", "b"},
+		"Content-Type":  {"application/grpc-web"},
+	}
+	excluded := map[string]struct{}{
+		"content-type": {},
+	}
+	expected := Metadata{
+		"authorization": {"Bearer foo"},
+		"x-custom":      {"a", "b"},
+	}
+	if got, want := MetadataFromRawHeaders(headers, excluded), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
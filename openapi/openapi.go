@@ -0,0 +1,160 @@
+// Package openapi generates OpenAPI 3 documents of gRPC services called through the proxy
+package openapi
+
+import (
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/mercari/grpc-http-proxy/schema"
+)
+
+// Version is the version of the OpenAPI specification the documents follow
+const Version = "3.0.3"
+
+// errorSchemaName is the name of the schema of errors returned by the proxy
+const errorSchemaName = "grpc_http_proxy.Error"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       *Info                `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components"`
+}
+
+// Info is the metadata of the API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem is the operations available on a path
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+}
+
+// Operation is an operation on a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a parameter of an operation
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+// RequestBody is the request body of an operation
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a request or response body in a media type
+type MediaType struct {
+	Schema *schema.Schema `json:"schema"`
+}
+
+// Components holds the schemas referred to in the document
+type Components struct {
+	Schemas map[string]*schema.Schema `json:"schemas"`
+}
+
+// New generates the document of the service.
+// Each unary method is a POST operation on /v1/<service>/<method>, whose request and response bodies are the JSON of its messages.
+// Streaming methods are left out, since they can't be called on the path.
+// version is the version of the service which is called, and may be blank.
+func New(sd *desc.ServiceDescriptor, version string) *Document {
+	g := schema.NewGenerator("#/components/schemas/")
+	g.Definitions[errorSchemaName] = errorSchema()
+	doc := &Document{
+		OpenAPI: Version,
+		Info: &Info{
+			Title:   sd.GetFullyQualifiedName(),
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem),
+		Components: &Components{
+			Schemas: g.Definitions,
+		},
+	}
+	for _, md := range sd.GetMethods() {
+		if md.IsClientStreaming() || md.IsServerStreaming() {
+			continue
+		}
+		doc.Paths["/v1/"+sd.GetFullyQualifiedName()+"/"+md.GetName()] = &PathItem{
+			Post: operation(g, md, version),
+		}
+	}
+	return doc
+}
+
+func operation(g *schema.Generator, md *desc.MethodDescriptor, version string) *Operation {
+	op := &Operation{
+		OperationID: md.GetName(),
+		RequestBody: &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: g.Message(md.GetInputType())},
+			},
+		},
+		Responses: map[string]*Response{
+			"200": {
+				Description: "the output message of the method",
+				Content: map[string]*MediaType{
+					"application/json": {Schema: g.Message(md.GetOutputType())},
+				},
+			},
+			"default": {
+				Description: "the error of the call",
+				Content: map[string]*MediaType{
+					"application/json": {Schema: &schema.Schema{Ref: g.RefPrefix + errorSchemaName}},
+				},
+			},
+		},
+	}
+	if version != "" {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:        "version",
+			In:          "query",
+			Description: "the version of the service",
+			Schema: &schema.Schema{
+				Type: "string",
+				Enum: []string{version},
+			},
+		})
+	}
+	return op
+}
+
+// errorSchema returns the schema of errors, which are either errors of the proxy with their HTTP status codes,
+// or errors returned by upstream with their gRPC status codes.
+func errorSchema() *schema.Schema {
+	return &schema.Schema{
+		Type: "object",
+		Properties: map[string]*schema.Schema{
+			"status":  {Type: "integer", Format: "int32", Description: "the HTTP status code of the error of the proxy"},
+			"code":    {Type: "integer", Format: "int32", Description: "the gRPC status code of the error returned by upstream"},
+			"message": {Type: "string"},
+			"details": {
+				Type: "array",
+				Items: &schema.Schema{
+					Type:                 "object",
+					Properties:           map[string]*schema.Schema{"@type": {Type: "string"}},
+					AdditionalProperties: &schema.Schema{},
+				},
+			},
+		},
+		Required: []string{"message"},
+	}
+}
@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/mercari/grpc-http-proxy/schema"
+)
+
+func newServiceDescriptor(t *testing.T) *desc.ServiceDescriptor {
+	t.Helper()
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("library.proto"),
+		Package: proto.String("a"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*dpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+			{Name: proto.String("GetBookRequest")},
+		},
+		Service: []*dpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Library"),
+				Method: []*dpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("GetBook"),
+						InputType:  proto.String(".a.GetBookRequest"),
+						OutputType: proto.String(".a.Book"),
+					},
+					{
+						Name:            proto.String("ListBooks"),
+						InputType:       proto.String(".a.GetBookRequest"),
+						OutputType:      proto.String(".a.Book"),
+						ServerStreaming: proto.Bool(true),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd.FindService("a.Library")
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		version    string
+		parameters []*Parameter
+	}{
+		{
+			name:    "versioned",
+			version: "v1",
+			parameters: []*Parameter{
+				{
+					Name:        "version",
+					In:          "query",
+					Description: "the version of the service",
+					Schema:      &schema.Schema{Type: "string", Enum: []string{"v1"}},
+				},
+			},
+		},
+		{
+			name:       "unversioned",
+			version:    "",
+			parameters: nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := New(newServiceDescriptor(t), tc.version)
+			if got, want := doc.OpenAPI, Version; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := *doc.Info, (Info{Title: "a.Library", Version: tc.version}); got != want {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := len(doc.Paths), 1; got != want {
+				t.Fatalf("got %d paths, want %d", got, want)
+			}
+			item, ok := doc.Paths["/v1/a.Library/GetBook"]
+			if !ok || item.Post == nil {
+				t.Fatal("operation of the unary method is missing")
+			}
+			op := item.Post
+			if got, want := op.OperationID, "GetBook"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := op.Parameters, tc.parameters; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got, want := op.RequestBody.Content["application/json"].Schema.Ref, "#/components/schemas/a.GetBookRequest"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := op.Responses["200"].Content["application/json"].Schema.Ref, "#/components/schemas/a.Book"; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got, want := op.Responses["default"].Content["application/json"].Schema.Ref, "#/components/schemas/"+errorSchemaName; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			for _, name := range []string{"a.Book", "a.GetBookRequest", errorSchemaName} {
+				if _, ok := doc.Components.Schemas[name]; !ok {
+					t.Errorf("schema %s is missing", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/metadata"
+)
+
+// rawCodec passes messages through as they are in the protobuf wire format
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec cannot marshal %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) String() string {
+	return "proto"
+}
+
+// forwardStreamDesc describes the calls made by Forward.
+// Unary methods are indistinguishable from server-streaming ones on the wire, so both are called as the latter.
+var forwardStreamDesc = &grpc.StreamDesc{
+	ServerStreams: true,
+}
+
+// ResponseWriter receives the response of a call made by Forward
+type ResponseWriter interface {
+	// WriteHeader is called with the header metadata of the response, before any message
+	WriteHeader(md grpc_metadata.MD)
+	// WriteMessage is called with each response message in the protobuf wire format
+	WriteMessage(b []byte) error
+}
+
+// Forward calls the method with the request messages in the protobuf wire format, without performing reflection.
+// method is the full method name in the form of "/package.Service/Method".
+// The response is passed to w, and the trailer metadata is returned along with a GRPCError if the call failed.
+func (p *Proxy) Forward(ctx context.Context,
+	method string,
+	requests [][]byte,
+	md *metadata.Metadata,
+	w ResponseWriter,
+) (grpc_metadata.MD, error) {
+	if md != nil {
+		ctx = grpc_metadata.NewOutgoingContext(ctx, grpc_metadata.MD(*md))
+	}
+	stream, err := p.cc.NewStream(ctx, forwardStreamDesc, method, grpc.CallCustomCodec(rawCodec{}))
+	if err != nil {
+		return nil, forwardError(err)
+	}
+	for _, req := range requests {
+		req := req
+		if err := stream.SendMsg(&req); err != nil {
+			if err == io.EOF {
+				// the actual status is returned by RecvMsg
+				break
+			}
+			return stream.Trailer(), forwardError(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return stream.Trailer(), forwardError(err)
+	}
+
+	header, err := stream.Header()
+	if err != nil {
+		return stream.Trailer(), forwardError(err)
+	}
+	w.WriteHeader(header)
+	for {
+		var b []byte
+		err := stream.RecvMsg(&b)
+		if err == io.EOF {
+			return stream.Trailer(), nil
+		}
+		if err != nil {
+			return stream.Trailer(), forwardError(err)
+		}
+		if err := w.WriteMessage(b); err != nil {
+			return stream.Trailer(), &perrors.ProxyError{
+				Code:    perrors.Unknown,
+				Message: "could not write response message",
+				Err:     err,
+			}
+		}
+	}
+}
+
+// forwardError converts the error of a forwarded call into a GRPCError, keeping its status code as it is
+func forwardError(err error) error {
+	stat := status.Convert(err)
+	return &perrors.GRPCError{
+		StatusCode: int(stat.Code()),
+		Message:    stat.Message(),
+		Details:    stat.Proto().Details,
+	}
+}
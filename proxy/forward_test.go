@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/metadata"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+type recordingResponseWriter struct {
+	header   grpc_metadata.MD
+	messages [][]byte
+}
+
+func (w *recordingResponseWriter) WriteHeader(md grpc_metadata.MD) {
+	w.header = md
+}
+
+func (w *recordingResponseWriter) WriteMessage(b []byte) error {
+	w.messages = append(w.messages, b)
+	return nil
+}
+
+// startEchoServer starts a gRPC server which responds to any method with each request message twice
+func startEchoServer(t *testing.T) (string, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s := grpc.NewServer(
+		grpc.CustomCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			if method == "/echo.Echo/Fail" {
+				return status.Error(codes.NotFound, "not found")
+			}
+			md, _ := grpc_metadata.FromIncomingContext(stream.Context())
+			stream.SetHeader(grpc_metadata.Pairs("foo", md.Get("foo")[0]))
+			var b []byte
+			if err := stream.RecvMsg(&b); err != nil {
+				return err
+			}
+			for i := 0; i < 2; i++ {
+				if err := stream.SendMsg(&b); err != nil {
+					return err
+				}
+			}
+			stream.SetTrailer(grpc_metadata.Pairs("bar", "baz"))
+			return nil
+		}),
+	)
+	go s.Serve(ln)
+	return fmt.Sprintf("localhost:%d", ln.Addr().(*net.TCPAddr).Port), s.Stop
+}
+
+func TestProxy_Forward(t *testing.T) {
+	addr, stop := startEchoServer(t)
+	defer stop()
+	p := NewProxy()
+	if err := p.Connect(context.Background(), proxytest.ParseURL(t, addr)); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer p.CloseConn()
+
+	t.Run("success", func(t *testing.T) {
+		md := metadata.Metadata{"foo": {"hoge"}}
+		w := &recordingResponseWriter{}
+		trailer, err := p.Forward(context.Background(), "/echo.Echo/Say", [][]byte{[]byte("hello")}, &md, w)
+		if err != nil {
+			t.Fatalf("err should be nil, got %s", err.Error())
+		}
+		if got, want := w.header.Get("foo"), []string{"hoge"}; len(got) != 1 || got[0] != want[0] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if got, want := len(w.messages), 2; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+		for _, m := range w.messages {
+			if got, want := string(m), "hello"; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		}
+		if got, want := trailer.Get("bar"), []string{"baz"}; len(got) != 1 || got[0] != want[0] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		w := &recordingResponseWriter{}
+		_, err := p.Forward(context.Background(), "/echo.Echo/Fail", [][]byte{[]byte("hello")}, nil, w)
+		gerr, ok := err.(*perrors.GRPCError)
+		if !ok {
+			t.Fatalf("err should be *errors.GRPCError, got %#v", err)
+		}
+		if got, want := codes.Code(gerr.StatusCode), codes.NotFound; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	})
+}
@@ -2,16 +2,24 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/grpc/keepalive"
 	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
 	"github.com/mercari/grpc-http-proxy/metadata"
 	"github.com/mercari/grpc-http-proxy/proxy/reflection"
+	"github.com/mercari/grpc-http-proxy/proxy/retry"
 	pstub "github.com/mercari/grpc-http-proxy/proxy/stub"
 )
 
@@ -27,19 +35,185 @@ func NewProxy() *Proxy {
 	return &Proxy{}
 }
 
+// CallOption configures a call
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	retry        *config.Retry
+	budget       *retry.Budget
+	attempts     *int
+	input        *reflection.Input
+	responseBody string
+	protoInput   bool
+	protoOutput  bool
+	json         *reflection.JSONOptions
+	fieldMask    []string
+	dryRun       bool
+}
+
+// WithRetry makes the call retried according to the policy, as long as the budget allows it.
+// The budget may be nil, in which case retries are not limited by a budget.
+func WithRetry(policy *config.Retry, budget *retry.Budget) CallOption {
+	return func(o *callOptions) {
+		o.retry = policy
+		o.budget = budget
+	}
+}
+
+// Attempts stores the number of attempts made to invoke the RPC into n
+func Attempts(n *int) CallOption {
+	return func(o *callOptions) {
+		o.attempts = n
+	}
+}
+
+// WithQuery makes the input message be built from the query parameters instead of the JSON message
+func WithQuery(q url.Values) CallOption {
+	return WithInput(&reflection.Input{Query: q})
+}
+
+// WithInput makes the input message be built from the input instead of the JSON message
+func WithInput(in *reflection.Input) CallOption {
+	return func(o *callOptions) {
+		o.input = in
+	}
+}
+
+// WithResponseBody makes the response only contain the field of the output message named field
+func WithResponseBody(field string) CallOption {
+	return func(o *callOptions) {
+		o.responseBody = field
+	}
+}
+
+// WithProtoInput makes the input message be read in the protobuf wire format instead of JSON
+func WithProtoInput() CallOption {
+	return func(o *callOptions) {
+		o.protoInput = true
+	}
+}
+
+// WithProtoOutput makes the output message be written in the protobuf wire format instead of JSON
+func WithProtoOutput() CallOption {
+	return func(o *callOptions) {
+		o.protoOutput = true
+	}
+}
+
+// WithFieldMask makes the output message only contain the fields selected by the paths of a field mask.
+// The paths are validated against the output message type before the RPC is invoked.
+func WithFieldMask(paths []string) CallOption {
+	return func(o *callOptions) {
+		o.fieldMask = paths
+	}
+}
+
+// WithJSONOptions makes the input and output messages be converted from and into JSON with the options
+func WithJSONOptions(opts *reflection.JSONOptions) CallOption {
+	return func(o *callOptions) {
+		o.json = opts
+	}
+}
+
+// WithDryRun makes the call only build the input message after performing reflection, without invoking the RPC.
+// The input message is returned in JSON instead of the output message.
+func WithDryRun() CallOption {
+	return func(o *callOptions) {
+		o.dryRun = true
+	}
+}
+
+// ConnectOption configures a connection
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	dial  *config.Dial
+	types *reflection.TypeCache
+}
+
+// WithDialConfig configures the connection and the calls made through it
+func WithDialConfig(d *config.Dial) ConnectOption {
+	return func(o *connectOptions) {
+		o.dial = d
+	}
+}
+
+// WithTypeCache caches the message types which the upstream resolves through reflection in c.
+// They are resolved for the type URLs in Any fields which the files of the services don't define.
+func WithTypeCache(c *reflection.TypeCache) ConnectOption {
+	return func(o *connectOptions) {
+		o.types = c
+	}
+}
+
 // Connect opens a connection to target.
-func (p *Proxy) Connect(ctx context.Context, target *url.URL) error {
-	cc, err := grpc.DialContext(ctx, target.String(), grpc.WithInsecure())
+func (p *Proxy) Connect(ctx context.Context, target *url.URL, opts ...ConnectOption) error {
+	o := &connectOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	dialOpts, err := dialOptions(o.dial)
+	if err != nil {
+		return err
+	}
+	cc, err := grpc.DialContext(ctx, target.String(), dialOpts...)
 	if err != nil {
 		return err
 	}
 	p.cc = cc
 	rc := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(p.cc))
-	p.reflector = reflection.NewReflector(rc)
+	p.reflector = reflection.NewReflector(rc, reflection.WithTypeCache(o.types))
 	p.stub = pstub.NewStub(grpcdynamic.NewStub(p.cc))
 	return err
 }
 
+// dialOptions converts the configuration into gRPC dial options
+func dialOptions(d *config.Dial) ([]grpc.DialOption, error) {
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if d == nil {
+		return opts, nil
+	}
+	if d.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                d.KeepaliveTime,
+			Timeout:             d.KeepaliveTimeout,
+			PermitWithoutStream: d.KeepalivePermitWithoutStream,
+		}))
+	}
+	if d.Authority != "" {
+		opts = append(opts, grpc.WithAuthority(d.Authority))
+	}
+	if d.UserAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(d.UserAgent))
+	}
+	var callOpts []grpc.CallOption
+	if d.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(d.MaxSendMsgSize))
+	}
+	if d.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(d.MaxRecvMsgSize))
+	}
+	if d.Compressor != "" {
+		if encoding.GetCompressor(d.Compressor) == nil {
+			return nil, errors.Errorf("compressor %s is not registered", d.Compressor)
+		}
+		callOpts = append(callOpts, grpc.UseCompressor(d.Compressor))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	return opts, nil
+}
+
+// DescribeService performs reflection to obtain the descriptor of the service
+func (p *Proxy) DescribeService(ctx context.Context, serviceName string) (*desc.ServiceDescriptor, error) {
+	sd, err := p.reflector.ResolveService(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return sd.ServiceDescriptor, nil
+}
+
 // CloseConn closes the underlying connection
 func (p *Proxy) CloseConn() error {
 	return p.cc.Close()
@@ -50,19 +224,127 @@ func (p *Proxy) Call(ctx context.Context,
 	serviceName, methodName string,
 	message []byte,
 	md *metadata.Metadata,
+	opts ...CallOption,
 ) ([]byte, error) {
-	invocation, err := p.reflector.CreateInvocation(ctx, serviceName, methodName, message)
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	invocation, err := p.createInvocation(ctx, serviceName, methodName, message, o)
 	if err != nil {
 		return nil, err
 	}
+	if o.dryRun {
+		return invocation.Message.MarshalJSONWith(o.json)
+	}
 
-	outputMsg, err := p.stub.InvokeRPC(ctx, invocation, md)
+	var outputMsg reflection.Message
+	retryable := retry.Retryable(invocation.AsProtoreflectDescriptor(), o.retry)
+	attempts, err := retry.Do(ctx, o.retry, o.budget, retryable, func() error {
+		var err error
+		outputMsg, err = p.stub.InvokeRPC(ctx, invocation, md)
+		return err
+	})
+	if o.attempts != nil {
+		*o.attempts = attempts
+	}
 	if err != nil {
 		return nil, err
 	}
-	m, err := outputMsg.MarshalJSON()
+	return marshalOutput(outputMsg, o)
+}
+
+// CallServerStream performs the server-streaming gRPC call after doing reflection to obtain type information,
+// and passes each response message to recv in the same format as Call returns it.
+// Server-streaming calls are never retried.
+func (p *Proxy) CallServerStream(ctx context.Context,
+	serviceName, methodName string,
+	message []byte,
+	md *metadata.Metadata,
+	recv func([]byte) error,
+	opts ...CallOption,
+) error {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	invocation, err := p.createInvocation(ctx, serviceName, methodName, message, o)
+	if err != nil {
+		return err
+	}
+	if d := invocation.AsProtoreflectDescriptor(); d.IsClientStreaming() || !d.IsServerStreaming() {
+		return &perrors.ProxyError{
+			Code:    perrors.MethodNotFound,
+			Message: fmt.Sprintf("the method %s is not a server-streaming method", methodName),
+		}
+	}
+	if o.attempts != nil {
+		*o.attempts = 1
+	}
+	return p.stub.InvokeServerStream(ctx, invocation, md, func(outputMsg reflection.Message) error {
+		m, err := marshalOutput(outputMsg, o)
+		if err != nil {
+			return err
+		}
+		return recv(m)
+	})
+}
+
+// createInvocation performs reflection, and builds the input message in the way the call options specify
+func (p *Proxy) createInvocation(ctx context.Context,
+	serviceName, methodName string,
+	message []byte,
+	o *callOptions,
+) (*reflection.MethodInvocation, error) {
+	var invocation *reflection.MethodInvocation
+	var err error
+	if o.input != nil {
+		invocation, err = p.reflector.CreateInvocationFromInput(ctx, serviceName, methodName, o.input, o.json)
+	} else if o.protoInput {
+		invocation, err = p.reflector.CreateInvocationFromProto(ctx, serviceName, methodName, message)
+	} else {
+		invocation, err = p.reflector.CreateInvocation(ctx, serviceName, methodName, message, o.json)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &perrors.ProxyError{
+				Code:    perrors.DeadlineExceeded,
+				Message: "deadline exceeded while performing reflection",
+			}
+		}
+		return nil, err
+	}
+	if o.fieldMask != nil {
+		if err := invocation.GetOutputType().ValidateFieldMask(o.fieldMask); err != nil {
+			return nil, err
+		}
+	}
+	return invocation, nil
+}
+
+// marshalOutput marshals the output message in the format the call options specify
+func marshalOutput(outputMsg reflection.Message, o *callOptions) ([]byte, error) {
+	if o.fieldMask != nil {
+		if err := outputMsg.Prune(o.fieldMask); err != nil {
+			return nil, errors.Wrap(err, "failed to prune output message")
+		}
+	}
+	var m []byte
+	var err error
+	switch {
+	case o.protoOutput && o.responseBody != "":
+		m, err = outputMsg.MarshalFieldProto(o.responseBody)
+	case o.protoOutput:
+		m, err = outputMsg.MarshalProto()
+	case o.responseBody != "":
+		m, err = outputMsg.MarshalFieldJSONWith(o.responseBody, o.json)
+	default:
+		m, err = outputMsg.MarshalJSONWith(o.json)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to marshal output JSON")
+		return nil, errors.Wrap(err, "failed to marshal output message")
 	}
-	return m, err
+	return m, nil
 }
@@ -3,9 +3,15 @@ package proxy
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	_ "google.golang.org/grpc/test/grpc_testing"
 
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
 	"github.com/mercari/grpc-http-proxy/metadata"
 	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
 	"github.com/mercari/grpc-http-proxy/proxy/reflection"
@@ -24,6 +30,44 @@ func TestProxy_Connect(t *testing.T) {
 	p.Connect(context.Background(), proxytest.ParseURL(t, "localhost:5000"))
 }
 
+func TestProxy_ConnectWithDialConfig(t *testing.T) {
+	cases := []struct {
+		name       string
+		dial       *config.Dial
+		errorIsNil bool
+	}{
+		{
+			name: "valid",
+			dial: &config.Dial{
+				KeepaliveTime:    time.Minute,
+				KeepaliveTimeout: 20 * time.Second,
+				MaxRecvMsgSize:   16777216,
+				Compressor:       "gzip",
+				Authority:        "echo.example.com",
+				UserAgent:        "echo-client",
+			},
+			errorIsNil: true,
+		},
+		{
+			name:       "unknown compressor",
+			dial:       &config.Dial{Compressor: "snappy"},
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewProxy()
+			err := p.Connect(context.Background(), proxytest.ParseURL(t, "localhost:5000"), WithDialConfig(tc.dial))
+			if err == nil {
+				defer p.CloseConn()
+			}
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
 func TestProxy_Call(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		p := NewProxy()
@@ -41,6 +85,86 @@ func TestProxy_Call(t *testing.T) {
 		}
 	})
 
+	t.Run("protobuf input and output", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		p.stub = pstub.NewStub(&proxytest.FakeGrpcdynamicStub{})
+		fd := proxytest.NewFileDescriptor(t, proxytest.File)
+		sd := reflection.ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd.ServiceDescriptor})
+
+		b, err := p.Call(ctx, proxytest.TestService, proxytest.EmptyCall, []byte{}, &md, WithProtoInput(), WithProtoOutput())
+		if err != nil {
+			t.Fatalf("err should be nil, got %s", err.Error())
+		}
+		if got, want := len(b), 0; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+
+		_, err = p.Call(ctx, proxytest.TestService, proxytest.EmptyCall, []byte("{}"), &md, WithProtoInput())
+		perr, ok := errors.Cause(err).(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("invalid field mask", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		p.stub = pstub.NewStub(&proxytest.FakeGrpcdynamicStub{})
+		fd := proxytest.NewFileDescriptor(t, proxytest.File)
+		sd := reflection.ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd.ServiceDescriptor})
+
+		_, err := p.Call(ctx, proxytest.TestService, proxytest.EmptyCall, []byte("{}"), &md, WithFieldMask([]string{"foo"}))
+		perr, ok := errors.Cause(err).(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.InvalidFieldMask; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		stub := &proxytest.FakeGrpcdynamicStub{}
+		p.stub = pstub.NewStub(stub)
+		fd := proxytest.NewFileDescriptor(t, proxytest.File)
+		sd := reflection.ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd.ServiceDescriptor})
+
+		b, err := p.Call(ctx, proxytest.TestService, proxytest.UnaryCall, []byte(`{"response_size":1}`), &md, WithDryRun())
+		if err != nil {
+			t.Fatalf("err should be nil, got %s", err.Error())
+		}
+		if got, want := string(b), `{"responseSize":1}`; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if got, want := stub.Calls, 0; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+
+		_, err = p.Call(ctx, proxytest.TestService, proxytest.UnaryCall, []byte(`{"responseSize":"a"}`), &md, WithDryRun())
+		perr, ok := errors.Cause(err).(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
 	t.Run("reflector fails", func(t *testing.T) {
 		p := NewProxy()
 		ctx := context.Background()
@@ -55,6 +179,56 @@ func TestProxy_Call(t *testing.T) {
 		}
 	})
 
+	t.Run("deadline exceeded during reflection", func(t *testing.T) {
+		p := NewProxy()
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+		md := make(metadata.Metadata)
+
+		p.stub = pstub.NewStub(&proxytest.FakeGrpcdynamicStub{})
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{})
+
+		_, err := p.Call(ctx, proxytest.NotFoundService, proxytest.EmptyCall, []byte("{}"), &md)
+		perr, ok := err.(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.DeadlineExceeded; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("retried while unavailable", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		stub := &proxytest.FakeGrpcdynamicStub{Err: status.Error(codes.Unavailable, "unavailable")}
+		p.stub = pstub.NewStub(stub)
+		fd := proxytest.NewFileDescriptor(t, proxytest.File)
+		sd := reflection.ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd.ServiceDescriptor})
+
+		policy := &config.Retry{
+			MaxAttempts: 3,
+			Methods:     []string{proxytest.TestService + "/" + proxytest.EmptyCall},
+		}
+		var attempts int
+		_, err := p.Call(ctx, proxytest.TestService, proxytest.EmptyCall, []byte("{}"), &md,
+			WithRetry(policy, nil),
+			Attempts(&attempts),
+		)
+		if err == nil {
+			t.Fatalf("err should be not nil")
+		}
+		if got, want := attempts, 3; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+		if got, want := stub.Calls, 3; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
 	t.Run("invoking RPC returns error", func(t *testing.T) {
 		p := NewProxy()
 		ctx := context.Background()
@@ -71,3 +245,46 @@ func TestProxy_Call(t *testing.T) {
 		}
 	})
 }
+
+func TestProxy_CallServerStream(t *testing.T) {
+	t.Run("not a server-streaming method", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		p.stub = pstub.NewStub(&proxytest.FakeGrpcdynamicStub{})
+		fd := proxytest.NewFileDescriptor(t, proxytest.File)
+		sd := reflection.ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd.ServiceDescriptor})
+
+		err := p.CallServerStream(ctx, proxytest.TestService, proxytest.EmptyCall, []byte("{}"), &md,
+			func(b []byte) error {
+				t.Fatalf("recv should not be called")
+				return nil
+			})
+		perr, ok := errors.Cause(err).(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+		}
+		if got, want := perr.Code, perrors.MethodNotFound; got != want {
+			t.Fatalf("got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("reflector fails", func(t *testing.T) {
+		p := NewProxy()
+		ctx := context.Background()
+		md := make(metadata.Metadata)
+
+		p.stub = pstub.NewStub(&proxytest.FakeGrpcdynamicStub{})
+		p.reflector = reflection.NewReflector(&proxytest.FakeGrpcreflectClient{})
+
+		err := p.CallServerStream(ctx, proxytest.NotFoundService, proxytest.EmptyCall, []byte("{}"), &md,
+			func(b []byte) error {
+				return nil
+			})
+		if err == nil {
+			t.Fatalf("err should be not nil")
+		}
+	})
+}
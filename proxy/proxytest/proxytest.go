@@ -58,9 +58,20 @@ func (m *FakeGrpcreflectClient) ResolveService(serviceName string) (*desc.Servic
 }
 
 type FakeGrpcdynamicStub struct {
+	// Err is returned by every call if it is set
+	Err error
+	// Calls is the number of calls made
+	Calls int
 }
 
 func (m *FakeGrpcdynamicStub) InvokeRpc(ctx context.Context, method *desc.MethodDescriptor, request proto.Message, opts ...grpc.CallOption) (proto.Message, error) {
+	m.Calls++
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	}
 	if method.GetName() == "UnaryCall" {
 		return nil, status.Error(codes.Unimplemented, "unary unimplemented")
 	}
@@ -0,0 +1,126 @@
+package reflection
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// fieldMaskTree is the tree of the paths of a field mask, keyed by the names of fields.
+// A field with a nil subtree is selected as a whole.
+type fieldMaskTree map[string]fieldMaskTree
+
+// newFieldMaskTree validates the paths of a field mask against the message type, and builds their tree.
+// The segments of the paths are either the names of fields in the proto files or their lowerCamelCase names.
+func newFieldMaskTree(md *desc.MessageDescriptor, paths []string) (fieldMaskTree, error) {
+	tree := make(fieldMaskTree)
+	for _, path := range paths {
+		if err := tree.add(md, path); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+func (t fieldMaskTree) add(md *desc.MessageDescriptor, path string) error {
+	segments := strings.Split(path, ".")
+	node := t
+	for i, segment := range segments {
+		fd := findFieldByJSONKey(md, segment)
+		if fd == nil {
+			return &perrors.ProxyError{
+				Code:    perrors.InvalidFieldMask,
+				Message: fmt.Sprintf("the field %s in the field mask path %s was not found in %s", segment, path, md.GetFullyQualifiedName()),
+			}
+		}
+		if i == len(segments)-1 {
+			node[fd.GetName()] = nil
+			return nil
+		}
+		if fd.GetMessageType() == nil || fd.IsRepeated() {
+			return &perrors.ProxyError{
+				Code:    perrors.InvalidFieldMask,
+				Message: fmt.Sprintf("the field %s in the field mask path %s is not a singular message field", segment, path),
+			}
+		}
+		child, ok := node[fd.GetName()]
+		if ok && child == nil {
+			// the whole field is already selected
+			return nil
+		}
+		if !ok {
+			child = make(fieldMaskTree)
+			node[fd.GetName()] = child
+		}
+		node = child
+		md = fd.GetMessageType()
+	}
+	return nil
+}
+
+// prune clears the fields of the message which are not selected by the tree
+func (t fieldMaskTree) prune(m *dynamic.Message) error {
+	for _, fd := range m.GetMessageDescriptor().GetFields() {
+		child, ok := t[fd.GetName()]
+		if !ok {
+			m.ClearField(fd)
+			continue
+		}
+		if child == nil || !m.HasField(fd) {
+			continue
+		}
+		v, ok := m.GetField(fd).(proto.Message)
+		if !ok {
+			continue
+		}
+		if dm, ok := v.(*dynamic.Message); ok {
+			if err := child.prune(dm); err != nil {
+				return err
+			}
+			continue
+		}
+		// messages of known types, such as well-known types, are pruned as dynamic messages and converted back
+		dm := messageFactory.NewDynamicMessage(fd.GetMessageType())
+		if err := dm.ConvertFrom(v); err != nil {
+			return err
+		}
+		if err := child.prune(dm); err != nil {
+			return err
+		}
+		pruned := proto.Clone(v)
+		pruned.Reset()
+		if err := dm.ConvertTo(pruned); err != nil {
+			return err
+		}
+		if err := m.TrySetField(fd, pruned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateFieldMask checks that the paths of a field mask select fields of the message type
+func (m *MessageDescriptor) ValidateFieldMask(paths []string) error {
+	_, err := newFieldMaskTree(m.desc, paths)
+	return err
+}
+
+func (m *messageImpl) Prune(paths []string) error {
+	tree, err := newFieldMaskTree(m.Message.GetMessageDescriptor(), paths)
+	if err != nil {
+		return err
+	}
+	if err := tree.prune(m.Message); err != nil {
+		return &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not apply the field mask to backend response",
+			Err:     err,
+		}
+	}
+	return nil
+}
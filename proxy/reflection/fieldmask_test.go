@@ -0,0 +1,100 @@
+package reflection
+
+import (
+	"testing"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+func TestMessage_Prune(t *testing.T) {
+	input := `{"name":"foo","id":"1","inner":{"value":2},"createdAt":"2018-01-02T03:04:05.5Z","inners":[{"value":3}]}`
+	cases := []struct {
+		name  string
+		paths []string
+		json  string
+		code  perrors.Code
+	}{
+		{
+			name:  "top-level fields",
+			paths: []string{"name", "inners"},
+			json:  `{"name":"foo","inners":[{"value":3}]}`,
+		},
+		{
+			name:  "nested field",
+			paths: []string{"inner.value"},
+			json:  `{"inner":{"value":2}}`,
+		},
+		{
+			name:  "lowerCamelCase names",
+			paths: []string{"createdAt"},
+			json:  `{"createdAt":"2018-01-02T03:04:05.500Z"}`,
+		},
+		{
+			name:  "field of a well-known type",
+			paths: []string{"created_at.seconds"},
+			json:  `{"createdAt":"2018-01-02T03:04:05Z"}`,
+		},
+		{
+			name:  "whole field and its subfield",
+			paths: []string{"inner.value", "inner"},
+			json:  `{"inner":{"value":2}}`,
+		},
+		{
+			name:  "empty",
+			paths: []string{},
+			json:  `{}`,
+		},
+		{
+			name:  "unknown field",
+			paths: []string{"name", "unknown"},
+			code:  perrors.InvalidFieldMask,
+		},
+		{
+			name:  "unknown nested field",
+			paths: []string{"inner.unknown"},
+			code:  perrors.InvalidFieldMask,
+		},
+		{
+			name:  "subfield of a repeated field",
+			paths: []string{"inners.value"},
+			code:  perrors.InvalidFieldMask,
+		},
+		{
+			name:  "subfield of a scalar field",
+			paths: []string{"name.value"},
+			code:  perrors.InvalidFieldMask,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			md := newQueryMessageDescriptor(t)
+			if err := md.ValidateFieldMask(tc.paths); tc.code != 0 {
+				perr, ok := err.(*perrors.ProxyError)
+				if !ok {
+					t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+				}
+				if got, want := perr.Code, tc.code; got != want {
+					t.Fatalf("got %d, want %d", got, want)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			m := md.NewMessage()
+			if err := m.UnmarshalJSON([]byte(input)); err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := m.Prune(tc.paths); err != nil {
+				t.Fatal(err.Error())
+			}
+			b, err := m.MarshalJSON()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := string(b), tc.json; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package reflection
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// JSONOptions are the options of the conversion between messages and JSON.
+// The zero value converts messages in the same way as the conversion without options.
+type JSONOptions struct {
+	// EmitDefaults emits fields with zero values
+	EmitDefaults bool
+	// OrigName uses the field names in the proto files instead of lowerCamelCase names
+	OrigName bool
+	// EnumsAsInts emits the numbers of enum values instead of their names
+	EnumsAsInts bool
+	// Int64AsStrings emits 64-bit integers as strings, as the proto3 JSON mapping does, instead of numbers
+	Int64AsStrings bool
+	// AllowUnknownFields ignores fields of input JSON which are not in the message type, instead of rejecting them
+	AllowUnknownFields bool
+}
+
+// marshaler creates the marshaler of the options, which resolves the type URLs in Any fields with r
+func (o *JSONOptions) marshaler(r jsonpb.AnyResolver) *jsonpb.Marshaler {
+	if o == nil {
+		return &jsonpb.Marshaler{AnyResolver: r}
+	}
+	return &jsonpb.Marshaler{
+		EmitDefaults: o.EmitDefaults,
+		OrigName:     o.OrigName,
+		EnumsAsInts:  o.EnumsAsInts,
+		AnyResolver:  r,
+	}
+}
+
+// unmarshaler creates the unmarshaler of the options, which resolves the type URLs in Any fields with r
+func (o *JSONOptions) unmarshaler(r jsonpb.AnyResolver) *jsonpb.Unmarshaler {
+	if o == nil {
+		return &jsonpb.Unmarshaler{AnyResolver: r}
+	}
+	return &jsonpb.Unmarshaler{
+		AllowUnknownFields: o.AllowUnknownFields,
+		AnyResolver:        r,
+	}
+}
+
+// int64Types are the types of fields which are 64-bit integers
+var int64Types = map[dpb.FieldDescriptorProto_Type]struct{}{
+	dpb.FieldDescriptorProto_TYPE_INT64:    {},
+	dpb.FieldDescriptorProto_TYPE_UINT64:   {},
+	dpb.FieldDescriptorProto_TYPE_SINT64:   {},
+	dpb.FieldDescriptorProto_TYPE_FIXED64:  {},
+	dpb.FieldDescriptorProto_TYPE_SFIXED64: {},
+}
+
+// quoteInt64s rewrites the 64-bit integers in the JSON of a message of the type into strings.
+// The order of the fields is kept as it is.
+func quoteInt64s(md *desc.MessageDescriptor, b []byte) ([]byte, error) {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return quoteNumber(b), nil
+	}
+	if strings.HasPrefix(md.GetFullyQualifiedName(), "google.protobuf.") {
+		// the other well-known types have their own representations, which have no 64-bit integers as numbers
+		return b, nil
+	}
+	return rewriteObject(b, func(key string, v json.RawMessage) (json.RawMessage, error) {
+		fd := findFieldByJSONKey(md, key)
+		if fd == nil {
+			return v, nil
+		}
+		return quoteFieldInt64s(fd, v)
+	})
+}
+
+// quoteFieldInt64s rewrites the 64-bit integers in the JSON value of the field into strings
+func quoteFieldInt64s(fd *desc.FieldDescriptor, b []byte) ([]byte, error) {
+	if fd.IsMap() {
+		vfd := fd.GetMessageType().FindFieldByNumber(2)
+		return rewriteObject(b, func(key string, v json.RawMessage) (json.RawMessage, error) {
+			return quoteValueInt64s(vfd, v)
+		})
+	}
+	if fd.IsRepeated() {
+		return rewriteArray(b, func(v json.RawMessage) (json.RawMessage, error) {
+			return quoteValueInt64s(fd, v)
+		})
+	}
+	return quoteValueInt64s(fd, b)
+}
+
+// quoteValueInt64s rewrites the 64-bit integers in a single JSON value of the field into strings
+func quoteValueInt64s(fd *desc.FieldDescriptor, b []byte) ([]byte, error) {
+	if _, ok := int64Types[fd.GetType()]; ok {
+		return quoteNumber(b), nil
+	}
+	if mt := fd.GetMessageType(); mt != nil && !bytes.Equal(b, []byte("null")) {
+		return quoteInt64s(mt, b)
+	}
+	return b, nil
+}
+
+// quoteNumber quotes b if it is a JSON number
+func quoteNumber(b []byte) []byte {
+	if len(b) == 0 || (b[0] != '-' && (b[0] < '0' || b[0] > '9')) {
+		return b
+	}
+	quoted := make([]byte, 0, len(b)+2)
+	quoted = append(quoted, '"')
+	quoted = append(quoted, b...)
+	return append(quoted, '"')
+}
+
+// findFieldByJSONKey finds the field by its key in JSON, which is either its lowerCamelCase name or its original name
+func findFieldByJSONKey(md *desc.MessageDescriptor, key string) *desc.FieldDescriptor {
+	for _, fd := range md.GetFields() {
+		if fd.GetJSONName() == key || fd.GetName() == key {
+			return fd
+		}
+	}
+	return nil
+}
+
+// rewriteObject rewrites each value of the JSON object with f, keeping the order of the keys
+func rewriteObject(b []byte, f func(key string, v json.RawMessage) (json.RawMessage, error)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		// values other than objects, such as null, are left as they are
+		return b, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; dec.More(); i++ {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if v, err = f(key, v); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// rewriteArray rewrites each element of the JSON array with f
+func rewriteArray(b []byte, f func(v json.RawMessage) (json.RawMessage, error)) ([]byte, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(b, &elements); err != nil || elements == nil {
+		// values other than arrays, such as null, are left as they are
+		return b, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, v := range elements {
+		v, err := f(v)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
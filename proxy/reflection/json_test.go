@@ -0,0 +1,93 @@
+package reflection
+
+import (
+	"testing"
+)
+
+func TestMessage_MarshalJSONWith(t *testing.T) {
+	input := `{"id":"9007199254740993","kind":"FOO","createdAt":"2018-01-02T03:04:05Z","inners":[{"value":1}]}`
+	cases := []struct {
+		name string
+		opts *JSONOptions
+		json string
+	}{
+		{
+			name: "default",
+			opts: nil,
+			json: `{"id":9007199254740993,"kind":"FOO","createdAt":"2018-01-02T03:04:05Z","inners":[{"value":1}]}`,
+		},
+		{
+			name: "original names",
+			opts: &JSONOptions{OrigName: true},
+			json: `{"id":9007199254740993,"kind":"FOO","created_at":"2018-01-02T03:04:05Z","inners":[{"value":1}]}`,
+		},
+		{
+			name: "enums as ints",
+			opts: &JSONOptions{EnumsAsInts: true},
+			json: `{"id":9007199254740993,"kind":1,"createdAt":"2018-01-02T03:04:05Z","inners":[{"value":1}]}`,
+		},
+		{
+			name: "int64 as strings",
+			opts: &JSONOptions{Int64AsStrings: true, OrigName: true},
+			json: `{"id":"9007199254740993","kind":"FOO","created_at":"2018-01-02T03:04:05Z","inners":[{"value":1}]}`,
+		},
+		{
+			name: "emit defaults",
+			opts: &JSONOptions{EmitDefaults: true, Int64AsStrings: true},
+			json: `{"name":"","id":"9007199254740993","flag":false,"tags":[],"kind":"FOO","inner":null,` +
+				`"createdAt":"2018-01-02T03:04:05Z","limit":null,"mask":null,"labels":{},"inners":[{"value":1}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newQueryMessageDescriptor(t).NewMessage()
+			if err := m.UnmarshalJSON([]byte(input)); err != nil {
+				t.Fatal(err.Error())
+			}
+			b, err := m.MarshalJSONWith(tc.opts)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := string(b), tc.json; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMessage_UnmarshalJSONWith(t *testing.T) {
+	cases := []struct {
+		name       string
+		json       string
+		opts       *JSONOptions
+		errorIsNil bool
+	}{
+		{
+			name:       "unknown field by default",
+			json:       `{"name":"foo","unknown":1}`,
+			opts:       nil,
+			errorIsNil: false,
+		},
+		{
+			name:       "unknown field allowed",
+			json:       `{"name":"foo","unknown":1}`,
+			opts:       &JSONOptions{AllowUnknownFields: true},
+			errorIsNil: true,
+		},
+		{
+			name:       "known fields",
+			json:       `{"name":"foo"}`,
+			opts:       &JSONOptions{},
+			errorIsNil: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newQueryMessageDescriptor(t).NewMessage()
+			err := m.UnmarshalJSONWith([]byte(tc.json), tc.opts)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package reflection
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// locateMismatch locates the value of the input JSON which doesn't match the message type.
+// nil is returned if no such value is found, in which case only the error of the unmarshaler tells the reason.
+// Type URLs in Any fields are resolved with r.
+func locateMismatch(md *desc.MessageDescriptor, b []byte, opts *JSONOptions, r jsonpb.AnyResolver) *perrors.FieldError {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			// the offset of a syntax error is right after the offending character, unless the input ends unexpectedly
+			offset := int(se.Offset)
+			if offset > 0 && !strings.HasSuffix(se.Error(), "end of JSON input") {
+				offset--
+			}
+			return &perrors.FieldError{
+				Expected: "valid JSON",
+				Offset:   offset,
+				Reason:   se.Error(),
+			}
+		}
+		return &perrors.FieldError{
+			Expected: "valid JSON",
+			Offset:   len(b),
+			Reason:   err.Error(),
+		}
+	}
+	l := &mismatchLocator{
+		b:                  b,
+		allowUnknownFields: opts != nil && opts.AllowUnknownFields,
+		resolver:           r,
+	}
+	return l.message(md, skipSpace(b, 0), "")
+}
+
+// mismatchLocator walks valid JSON along the message type
+type mismatchLocator struct {
+	b                  []byte
+	allowUnknownFields bool
+	resolver           jsonpb.AnyResolver
+}
+
+// message checks the JSON value at i against the message type
+func (l *mismatchLocator) message(md *desc.MessageDescriptor, i int, path string) *perrors.FieldError {
+	if l.isNull(i) {
+		return nil
+	}
+	name := md.GetFullyQualifiedName()
+	if strings.HasPrefix(name, "google.protobuf.") {
+		// well-known types have their own representations, which only the unmarshaler knows
+		raw := l.b[i:valueEnd(l.b, i)]
+		if err := messageFactory.NewDynamicMessage(md).UnmarshalJSONPB(&jsonpb.Unmarshaler{AnyResolver: l.resolver}, raw); err != nil {
+			return l.mismatch(path, name, i, err.Error())
+		}
+		return nil
+	}
+	if l.b[i] != '{' {
+		return l.mismatch(path, "message "+name, i, "got "+kindOf(l.b[i]))
+	}
+	return l.object(i, func(key string, keyOffset, v int) *perrors.FieldError {
+		fd := findFieldByJSONKey(md, key)
+		if fd == nil {
+			if l.allowUnknownFields {
+				return nil
+			}
+			return l.mismatch(joinPath(path, key), "a field of "+name, keyOffset, "unknown field")
+		}
+		return l.field(fd, v, joinPath(path, key))
+	})
+}
+
+// field checks the JSON value at i against the type of the field
+func (l *mismatchLocator) field(fd *desc.FieldDescriptor, i int, path string) *perrors.FieldError {
+	if l.isNull(i) {
+		return nil
+	}
+	if fd.IsMap() {
+		kfd, vfd := fd.GetMapKeyType(), fd.GetMapValueType()
+		if l.b[i] != '{' {
+			return l.mismatch(path, fmt.Sprintf("map of %s to %s", typeName(kfd), typeName(vfd)), i, "got "+kindOf(l.b[i]))
+		}
+		return l.object(i, func(key string, keyOffset, v int) *perrors.FieldError {
+			p := path + "[" + strconv.Quote(key) + "]"
+			if reason := checkMapKey(kfd, key); reason != "" {
+				return l.mismatch(p, typeName(kfd)+" key", keyOffset, reason)
+			}
+			return l.value(vfd, v, p)
+		})
+	}
+	if fd.IsRepeated() {
+		if l.b[i] != '[' {
+			return l.mismatch(path, "array of "+typeName(fd), i, "got "+kindOf(l.b[i]))
+		}
+		return l.array(i, func(n, v int) *perrors.FieldError {
+			return l.value(fd, v, fmt.Sprintf("%s[%d]", path, n))
+		})
+	}
+	return l.value(fd, i, path)
+}
+
+// value checks a single JSON value at i against the type of the field
+func (l *mismatchLocator) value(fd *desc.FieldDescriptor, i int, path string) *perrors.FieldError {
+	if mt := fd.GetMessageType(); mt != nil {
+		return l.message(mt, i, path)
+	}
+	if l.isNull(i) {
+		return nil
+	}
+	raw := l.b[i:valueEnd(l.b, i)]
+	if reason := checkScalar(fd, raw); reason != "" {
+		return l.mismatch(path, typeName(fd), i, reason)
+	}
+	return nil
+}
+
+// object calls f with each key of the JSON object at i, the offset of the key, and the offset of its value
+func (l *mismatchLocator) object(i int, f func(key string, keyOffset, v int) *perrors.FieldError) *perrors.FieldError {
+	i = skipSpace(l.b, i+1)
+	for l.b[i] != '}' {
+		keyEnd := valueEnd(l.b, i)
+		var key string
+		json.Unmarshal(l.b[i:keyEnd], &key)
+		v := skipSpace(l.b, skipSpace(l.b, keyEnd)+1)
+		if err := f(key, i, v); err != nil {
+			return err
+		}
+		i = skipSpace(l.b, valueEnd(l.b, v))
+		if l.b[i] == ',' {
+			i = skipSpace(l.b, i+1)
+		}
+	}
+	return nil
+}
+
+// array calls f with the index and the offset of each element of the JSON array at i
+func (l *mismatchLocator) array(i int, f func(n, v int) *perrors.FieldError) *perrors.FieldError {
+	i = skipSpace(l.b, i+1)
+	for n := 0; l.b[i] != ']'; n++ {
+		if err := f(n, i); err != nil {
+			return err
+		}
+		i = skipSpace(l.b, valueEnd(l.b, i))
+		if l.b[i] == ',' {
+			i = skipSpace(l.b, i+1)
+		}
+	}
+	return nil
+}
+
+func (l *mismatchLocator) isNull(i int) bool {
+	return bytes.HasPrefix(l.b[i:], []byte("null"))
+}
+
+func (l *mismatchLocator) mismatch(path, expected string, offset int, reason string) *perrors.FieldError {
+	return &perrors.FieldError{
+		Path:     path,
+		Expected: expected,
+		Offset:   offset,
+		Reason:   reason,
+	}
+}
+
+// checkScalar checks the raw JSON value against the scalar or enum type of the field, and returns the reason of the mismatch
+func checkScalar(fd *desc.FieldDescriptor, raw []byte) string {
+	var s string
+	isString := raw[0] == '"'
+	if isString {
+		json.Unmarshal(raw, &s)
+	}
+	switch fd.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_STRING:
+		if !isString {
+			return "got " + kindOf(raw[0])
+		}
+	case dpb.FieldDescriptorProto_TYPE_BYTES:
+		if !isString {
+			return "got " + kindOf(raw[0])
+		}
+		if !isBase64(s) {
+			return "illegal base64 data"
+		}
+	case dpb.FieldDescriptorProto_TYPE_BOOL:
+		if raw[0] != 't' && raw[0] != 'f' {
+			return "got " + kindOf(raw[0])
+		}
+	case dpb.FieldDescriptorProto_TYPE_ENUM:
+		if isString {
+			if fd.GetEnumType().FindValueByName(s) == nil {
+				return fmt.Sprintf("unknown enum value %q", s)
+			}
+			return ""
+		}
+		return checkIntegerOrString(raw, s, false, 32, false)
+	case dpb.FieldDescriptorProto_TYPE_FLOAT, dpb.FieldDescriptorProto_TYPE_DOUBLE:
+		if isString {
+			switch s {
+			case "NaN", "Infinity", "-Infinity":
+				return ""
+			}
+			raw = []byte(s)
+		} else if !isNumber(raw[0]) {
+			return "got " + kindOf(raw[0])
+		}
+		if _, err := strconv.ParseFloat(string(raw), 64); err != nil {
+			return fmt.Sprintf("%q is not a number", string(raw))
+		}
+	case dpb.FieldDescriptorProto_TYPE_INT32, dpb.FieldDescriptorProto_TYPE_SINT32, dpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return checkIntegerOrString(raw, s, isString, 32, false)
+	case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_FIXED32:
+		return checkIntegerOrString(raw, s, isString, 32, true)
+	case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64, dpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return checkIntegerOrString(raw, s, isString, 64, false)
+	case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_FIXED64:
+		return checkIntegerOrString(raw, s, isString, 64, true)
+	}
+	return ""
+}
+
+func checkIntegerOrString(raw []byte, s string, isString bool, bitSize int, unsigned bool) string {
+	if isString {
+		raw = []byte(s)
+	} else if !isNumber(raw[0]) {
+		return "got " + kindOf(raw[0])
+	}
+	return checkInteger(raw, bitSize, unsigned)
+}
+
+// checkInteger checks that the number is an integer in the range of the type
+func checkInteger(raw []byte, bitSize int, unsigned bool) string {
+	n := string(raw)
+	var err error
+	if unsigned {
+		_, err = strconv.ParseUint(n, 10, bitSize)
+	} else {
+		_, err = strconv.ParseInt(n, 10, bitSize)
+	}
+	if err == nil {
+		return ""
+	}
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return fmt.Sprintf("%s is out of range", n)
+	}
+	if f, err := strconv.ParseFloat(n, 64); err == nil {
+		if f != math.Trunc(f) {
+			return fmt.Sprintf("%s is not an integer", n)
+		}
+		// integers in exponent notation are accepted
+		return ""
+	}
+	return fmt.Sprintf("%q is not an integer", n)
+}
+
+// checkMapKey checks the key of a JSON object against the key type of a map field
+func checkMapKey(kfd *desc.FieldDescriptor, key string) string {
+	switch kfd.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_STRING:
+		return ""
+	case dpb.FieldDescriptorProto_TYPE_BOOL:
+		if key != "true" && key != "false" {
+			return fmt.Sprintf("%q is not a boolean", key)
+		}
+		return ""
+	case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_FIXED32:
+		return checkInteger([]byte(key), 32, true)
+	case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64, dpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return checkInteger([]byte(key), 64, false)
+	case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_FIXED64:
+		return checkInteger([]byte(key), 64, true)
+	default:
+		return checkInteger([]byte(key), 32, false)
+	}
+}
+
+// typeName returns the name of the type of the field in the messages of mismatches
+func typeName(fd *desc.FieldDescriptor) string {
+	if mt := fd.GetMessageType(); mt != nil {
+		return "message " + mt.GetFullyQualifiedName()
+	}
+	if et := fd.GetEnumType(); et != nil {
+		return "enum " + et.GetFullyQualifiedName()
+	}
+	return strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+}
+
+// kindOf returns the kind of the JSON value which starts with c
+func kindOf(c byte) string {
+	switch {
+	case c == '{':
+		return "object"
+	case c == '[':
+		return "array"
+	case c == '"':
+		return "string"
+	case c == 't' || c == 'f':
+		return "boolean"
+	case c == 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+func isNumber(c byte) bool {
+	return c == '-' || (c >= '0' && c <= '9')
+}
+
+func isBase64(s string) bool {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if _, err := enc.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// skipSpace returns the offset of the first character at or after i which is not whitespace
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\r' || b[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the offset right after the JSON value at i, which must be valid JSON
+func valueEnd(b []byte, i int) int {
+	switch b[i] {
+	case '"':
+		for j := i + 1; j < len(b); j++ {
+			switch b[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
+			}
+		}
+		return len(b)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(b); j++ {
+			switch b[j] {
+			case '"':
+				j = valueEnd(b, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(b)
+	default:
+		j := i
+		for j < len(b) && !strings.ContainsRune(",}] \t\r\n", rune(b[j])) {
+			j++
+		}
+		return j
+	}
+}
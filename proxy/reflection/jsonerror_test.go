@@ -0,0 +1,102 @@
+package reflection
+
+import (
+	"reflect"
+	"testing"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+func TestLocateMismatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		json  string
+		opts  *JSONOptions
+		field *perrors.FieldError
+	}{
+		{
+			name:  "matched",
+			json:  `{"name":"foo","id":"1","flag":true,"tags":["a"],"kind":"FOO","inner":{"value":1},"labels":{"a":"b"}}`,
+			field: nil,
+		},
+		{
+			name:  "syntax error",
+			json:  `{"name":}`,
+			field: &perrors.FieldError{Expected: "valid JSON", Offset: 8, Reason: "invalid character '}' looking for beginning of value"},
+		},
+		{
+			name:  "not an object",
+			json:  `[]`,
+			field: &perrors.FieldError{Expected: "message query.testing.Request", Offset: 0, Reason: "got array"},
+		},
+		{
+			name:  "string",
+			json:  `{"name": 1}`,
+			field: &perrors.FieldError{Path: "name", Expected: "string", Offset: 9, Reason: "got number"},
+		},
+		{
+			name:  "int64",
+			json:  `{"id":"abc"}`,
+			field: &perrors.FieldError{Path: "id", Expected: "int64", Offset: 6, Reason: `"abc" is not an integer`},
+		},
+		{
+			name:  "out of range",
+			json:  `{"inner":{"value":2147483648}}`,
+			field: &perrors.FieldError{Path: "inner.value", Expected: "int32", Offset: 18, Reason: "2147483648 is out of range"},
+		},
+		{
+			name:  "repeated",
+			json:  `{"tags":"a"}`,
+			field: &perrors.FieldError{Path: "tags", Expected: "array of string", Offset: 8, Reason: "got string"},
+		},
+		{
+			name:  "element",
+			json:  `{"inners":[{"value":1},{"value":true}]}`,
+			field: &perrors.FieldError{Path: "inners[1].value", Expected: "int32", Offset: 32, Reason: "got boolean"},
+		},
+		{
+			name:  "enum",
+			json:  `{"kind":"BAR"}`,
+			field: &perrors.FieldError{Path: "kind", Expected: "enum query.testing.Kind", Offset: 8, Reason: `unknown enum value "BAR"`},
+		},
+		{
+			name:  "map value",
+			json:  `{"labels":{"a":1}}`,
+			field: &perrors.FieldError{Path: `labels["a"]`, Expected: "string", Offset: 15, Reason: "got number"},
+		},
+		{
+			name:  "well-known type",
+			json:  `{"createdAt":"yesterday"}`,
+			field: &perrors.FieldError{Path: "createdAt", Expected: "google.protobuf.Timestamp", Offset: 13},
+		},
+		{
+			name:  "unknown field",
+			json:  `{"name":"foo","unknown":1}`,
+			field: &perrors.FieldError{Path: "unknown", Expected: "a field of query.testing.Request", Offset: 14, Reason: "unknown field"},
+		},
+		{
+			name:  "unknown field allowed",
+			json:  `{"unknown":1}`,
+			opts:  &JSONOptions{AllowUnknownFields: true},
+			field: nil,
+		},
+		{
+			name:  "null",
+			json:  `{"name":null,"inner":null,"tags":null}`,
+			field: nil,
+		},
+	}
+	md := newQueryMessageDescriptor(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := locateMismatch(md.desc, []byte(tc.json), tc.opts, nil)
+			if got != nil && tc.field != nil && tc.field.Reason == "" {
+				// the reasons of well-known types come from the unmarshaler
+				got.Reason = ""
+			}
+			if want := tc.field; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
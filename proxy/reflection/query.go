@@ -0,0 +1,265 @@
+package reflection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// scalarMessageTypes are the well-known types whose JSON representation is a single value
+var scalarMessageTypes = map[string]struct{}{
+	"google.protobuf.Timestamp":   {},
+	"google.protobuf.Duration":    {},
+	"google.protobuf.FieldMask":   {},
+	"google.protobuf.DoubleValue": {},
+	"google.protobuf.FloatValue":  {},
+	"google.protobuf.Int64Value":  {},
+	"google.protobuf.UInt64Value": {},
+	"google.protobuf.Int32Value":  {},
+	"google.protobuf.UInt32Value": {},
+	"google.protobuf.BoolValue":   {},
+	"google.protobuf.StringValue": {},
+	"google.protobuf.BytesValue":  {},
+}
+
+// Input is the input of a call taken from the parts of an HTTP request, from which the input message is built
+type Input struct {
+	// JSON is the JSON representation of the message, or of the field named by BodyField
+	JSON []byte
+
+	// BodyField is the top-level field which JSON represents. Empty means the whole message.
+	BodyField string
+
+	// PathParams are the values of path variables keyed by field paths.
+	// They take precedence over the values in JSON.
+	PathParams map[string]string
+
+	// Query are the query parameters mapped to fields
+	Query url.Values
+}
+
+// QueryToJSON converts query parameters into the JSON representation of the message.
+// Parameter names are field names, or dotted paths of field names for fields of nested messages.
+// Repeated fields are set by repeating the parameter.
+// Values follow the proto3 JSON mapping, so enums are specified by name or number,
+// and well-known types such as google.protobuf.Timestamp by their string representation.
+func (m *MessageDescriptor) QueryToJSON(q url.Values) ([]byte, error) {
+	return m.InputToJSON(&Input{Query: q})
+}
+
+// InputToJSON builds the JSON representation of the message from the input.
+// Path parameters and query parameters follow the same rules as QueryToJSON.
+func (m *MessageDescriptor) InputToJSON(in *Input) ([]byte, error) {
+	root := make(map[string]interface{})
+	if len(in.JSON) > 0 {
+		if in.BodyField == "" {
+			var err error
+			if root, err = rawObject(in.JSON); err != nil {
+				return nil, &perrors.ProxyError{
+					Code:    perrors.MessageTypeMismatch,
+					Message: "input JSON is not an object",
+				}
+			}
+		} else {
+			fd := m.desc.FindFieldByName(in.BodyField)
+			if fd == nil {
+				return nil, &perrors.ProxyError{
+					Code:    perrors.MessageTypeMismatch,
+					Message: fmt.Sprintf("%s has no field %s", m.desc.GetFullyQualifiedName(), in.BodyField),
+				}
+			}
+			root[fd.GetName()] = json.RawMessage(in.JSON)
+		}
+	}
+	for name, value := range in.PathParams {
+		if err := setQueryParameter(m.desc, root, name, strings.Split(name, "."), []string{value}, true); err != nil {
+			return nil, err
+		}
+	}
+	for name, values := range in.Query {
+		if err := setQueryParameter(m.desc, root, name, strings.Split(name, "."), values, false); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(root)
+	if err != nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not convert the input into JSON",
+			Err:     err,
+		}
+	}
+	return b, nil
+}
+
+// setQueryParameter sets the values of the parameter to the field at path in obj, which represents a message of type md.
+// If override is false, the field must not be set yet.
+func setQueryParameter(md *desc.MessageDescriptor, obj map[string]interface{}, name string, path []string, values []string, override bool) error {
+	fd := md.FindFieldByName(path[0])
+	if fd == nil {
+		fd = md.FindFieldByJSONName(path[0])
+	}
+	if fd == nil {
+		return queryParameterError(name, fmt.Sprintf("%s has no field %s", md.GetFullyQualifiedName(), path[0]))
+	}
+	key := fieldKey(obj, fd)
+	if fd.IsMap() {
+		return queryParameterError(name, "map fields cannot be set with query parameters")
+	}
+
+	if len(path) > 1 {
+		if fd.GetMessageType() == nil || fd.IsRepeated() || isScalarMessage(fd.GetMessageType()) {
+			return queryParameterError(name, fmt.Sprintf("%s is not a singular message field", fd.GetName()))
+		}
+		child, err := childObject(obj, key)
+		if err != nil {
+			return queryParameterError(name, err.Error())
+		}
+		return setQueryParameter(fd.GetMessageType(), child, name, path[1:], values, override)
+	}
+
+	if _, ok := obj[key]; ok && !override {
+		return queryParameterError(name, "the field is set more than once")
+	}
+	if fd.IsRepeated() {
+		list := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			jv, err := queryValue(fd, v)
+			if err != nil {
+				return queryParameterError(name, err.Error())
+			}
+			list = append(list, jv)
+		}
+		obj[key] = list
+		return nil
+	}
+	if len(values) != 1 {
+		return queryParameterError(name, "repeated parameters are only allowed for repeated fields")
+	}
+	jv, err := queryValue(fd, values[0])
+	if err != nil {
+		return queryParameterError(name, err.Error())
+	}
+	obj[key] = jv
+	return nil
+}
+
+// fieldKey returns the key of the field in obj.
+// Objects unmarshaled from request bodies may use the JSON name of the field instead of its name.
+func fieldKey(obj map[string]interface{}, fd *desc.FieldDescriptor) string {
+	if _, ok := obj[fd.GetName()]; !ok {
+		if _, ok := obj[fd.GetJSONName()]; ok {
+			return fd.GetJSONName()
+		}
+	}
+	return fd.GetName()
+}
+
+// childObject returns the object of the nested message at key in obj, creating it if it doesn't exist
+func childObject(obj map[string]interface{}, key string) (map[string]interface{}, error) {
+	switch v := obj[key].(type) {
+	case map[string]interface{}:
+		return v, nil
+	case json.RawMessage:
+		child, err := rawObject(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an object", key)
+		}
+		obj[key] = child
+		return child, nil
+	case nil:
+		child := make(map[string]interface{})
+		obj[key] = child
+		return child, nil
+	default:
+		return nil, fmt.Errorf("%s is not an object", key)
+	}
+}
+
+// rawObject unmarshals a JSON object, keeping the values as they are written so that numbers don't lose precision
+func rawObject(b []byte) (map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return obj, nil
+}
+
+// queryValue converts the value of a query parameter into the JSON value for the field.
+// Numbers are kept as strings, which the proto3 JSON mapping accepts and which preserves 64-bit integers.
+func queryValue(fd *desc.FieldDescriptor, v string) (interface{}, error) {
+	switch fd.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_BOOL:
+		return parseBool(v)
+	case dpb.FieldDescriptorProto_TYPE_MESSAGE, dpb.FieldDescriptorProto_TYPE_GROUP:
+		mt := fd.GetMessageType()
+		switch mt.GetFullyQualifiedName() {
+		case "google.protobuf.BoolValue":
+			return parseBool(v)
+		case "google.protobuf.FieldMask":
+			return fieldMask(v), nil
+		}
+		if !isScalarMessage(mt) {
+			return nil, fmt.Errorf("%s is a message; set its fields instead", fd.GetName())
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// fieldMask converts the proto3 JSON representation of google.protobuf.FieldMask, which is a comma separated list
+// of paths in lower camel case, into the representation of the message itself.
+func fieldMask(v string) interface{} {
+	paths := make([]string, 0)
+	for _, p := range strings.Split(v, ",") {
+		if p == "" {
+			continue
+		}
+		paths = append(paths, toSnakeCase(p))
+	}
+	return map[string]interface{}{"paths": paths}
+}
+
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func parseBool(v string) (interface{}, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a boolean", v)
+	}
+	return b, nil
+}
+
+func isScalarMessage(md *desc.MessageDescriptor) bool {
+	_, ok := scalarMessageTypes[md.GetFullyQualifiedName()]
+	return ok
+}
+
+func queryParameterError(name, reason string) error {
+	return &perrors.ProxyError{
+		Code:    perrors.MessageTypeMismatch,
+		Message: fmt.Sprintf("invalid query parameter %s: %s", name, reason),
+	}
+}
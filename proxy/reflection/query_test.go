@@ -0,0 +1,308 @@
+package reflection
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	_ "github.com/golang/protobuf/ptypes/timestamp"
+	_ "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/jhump/protoreflect/desc"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+)
+
+func newQueryMessageDescriptor(t *testing.T) *MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, label dpb.FieldDescriptorProto_Label, typ dpb.FieldDescriptorProto_Type, typeName string) *dpb.FieldDescriptorProto {
+		f := &dpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := dpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := dpb.FieldDescriptorProto_LABEL_REPEATED
+	message := dpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	fieldMask, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("google/protobuf/field_mask.proto"),
+		Package: proto.String("google.protobuf"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("FieldMask"),
+				Field: []*dpb.FieldDescriptorProto{
+					field("paths", 1, repeated, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	timestamp := proxytest.NewFileDescriptor(t, "google/protobuf/timestamp.proto")
+	wrappers := proxytest.NewFileDescriptor(t, "google/protobuf/wrappers.proto")
+
+	labels := field("labels", 10, repeated, message, ".query.testing.Request.LabelsEntry")
+	labels.JsonName = proto.String("labels")
+	createdAt := field("created_at", 7, optional, message, ".google.protobuf.Timestamp")
+	createdAt.JsonName = proto.String("createdAt")
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:       proto.String("query_testing.proto"),
+		Package:    proto.String("query.testing"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/field_mask.proto", "google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		EnumType: []*dpb.EnumDescriptorProto{
+			{
+				Name: proto.String("Kind"),
+				Value: []*dpb.EnumValueDescriptorProto{
+					{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+					{Name: proto.String("FOO"), Number: proto.Int32(1)},
+				},
+			},
+		},
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Inner"),
+				Field: []*dpb.FieldDescriptorProto{
+					field("value", 1, optional, dpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+			},
+			{
+				Name: proto.String("Request"),
+				Field: []*dpb.FieldDescriptorProto{
+					field("name", 1, optional, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("id", 2, optional, dpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("flag", 3, optional, dpb.FieldDescriptorProto_TYPE_BOOL, ""),
+					field("tags", 4, repeated, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("kind", 5, optional, dpb.FieldDescriptorProto_TYPE_ENUM, ".query.testing.Kind"),
+					field("inner", 6, optional, message, ".query.testing.Inner"),
+					createdAt,
+					field("limit", 8, optional, message, ".google.protobuf.Int32Value"),
+					field("mask", 9, optional, message, ".google.protobuf.FieldMask"),
+					labels,
+					field("inners", 11, repeated, message, ".query.testing.Inner"),
+				},
+				NestedType: []*dpb.DescriptorProto{
+					{
+						Name: proto.String("LabelsEntry"),
+						Field: []*dpb.FieldDescriptorProto{
+							field("key", 1, optional, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+							field("value", 2, optional, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+						},
+						Options: &dpb.MessageOptions{MapEntry: proto.Bool(true)},
+					},
+				},
+			},
+		},
+	}, fieldMask, timestamp, wrappers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return &MessageDescriptor{desc: fd.FindMessage("query.testing.Request")}
+}
+
+func TestMessageDescriptor_QueryToJSON(t *testing.T) {
+	cases := []struct {
+		name       string
+		query      string
+		json       string
+		errorIsNil bool
+	}{
+		{
+			name:       "scalars",
+			query:      "name=foo&id=9007199254740993&flag=true",
+			json:       `{"flag":true,"id":"9007199254740993","name":"foo"}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "repeated",
+			query:      "tags=a&tags=b",
+			json:       `{"tags":["a","b"]}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "enum by name",
+			query:      "kind=FOO",
+			json:       `{"kind":"FOO"}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "enum by number",
+			query:      "kind=1",
+			json:       `{"kind":"1"}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "nested",
+			query:      "inner.value=3",
+			json:       `{"inner":{"value":"3"}}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "well-known types",
+			query:      "createdAt=2018-09-01T00:00:00Z&limit=10&mask=name,createdAt",
+			json:       `{"created_at":"2018-09-01T00:00:00Z","limit":"10","mask":{"paths":["name","created_at"]}}`,
+			errorIsNil: true,
+		},
+		{
+			name:       "unknown field",
+			query:      "foo=bar",
+			errorIsNil: false,
+		},
+		{
+			name:       "repeated parameter for singular field",
+			query:      "name=a&name=b",
+			errorIsNil: false,
+		},
+		{
+			name:       "invalid boolean",
+			query:      "flag=yes!",
+			errorIsNil: false,
+		},
+		{
+			name:       "message without path",
+			query:      "inner=3",
+			errorIsNil: false,
+		},
+		{
+			name:       "path through scalar",
+			query:      "name.value=3",
+			errorIsNil: false,
+		},
+		{
+			name:       "path through repeated message",
+			query:      "inners.value=3",
+			errorIsNil: false,
+		},
+		{
+			name:       "map",
+			query:      "labels=a",
+			errorIsNil: false,
+		},
+	}
+	md := newQueryMessageDescriptor(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			b, err := md.QueryToJSON(q)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				perr, ok := err.(*perrors.ProxyError)
+				if !ok {
+					t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+				}
+				if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+					t.Fatalf("got %d, want %d", got, want)
+				}
+				return
+			}
+			if got, want := string(b), tc.json; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if err := md.NewMessage().UnmarshalJSON(b); err != nil {
+				t.Fatalf("JSON should match the message: %s", err.Error())
+			}
+		})
+	}
+}
+
+func TestMessageDescriptor_InputToJSON(t *testing.T) {
+	cases := []struct {
+		name       string
+		input      *Input
+		json       string
+		errorIsNil bool
+	}{
+		{
+			name: "whole body with path parameters",
+			input: &Input{
+				JSON:       []byte(`{"name":"foo","id":9007199254740993,"inner":{"value":1}}`),
+				PathParams: map[string]string{"name": "bar", "inner.value": "2"},
+			},
+			json:       `{"id":9007199254740993,"inner":{"value":"2"},"name":"bar"}`,
+			errorIsNil: true,
+		},
+		{
+			name: "body field with query",
+			input: &Input{
+				JSON:      []byte(`{"value":1}`),
+				BodyField: "inner",
+				Query:     url.Values{"tags": {"a"}},
+			},
+			json:       `{"inner":{"value":1},"tags":["a"]}`,
+			errorIsNil: true,
+		},
+		{
+			name: "JSON name in body",
+			input: &Input{
+				JSON:  []byte(`{"createdAt":"2018-09-01T00:00:00Z"}`),
+				Query: url.Values{"name": {"foo"}},
+			},
+			json:       `{"createdAt":"2018-09-01T00:00:00Z","name":"foo"}`,
+			errorIsNil: true,
+		},
+		{
+			name: "query conflicting with body",
+			input: &Input{
+				JSON:  []byte(`{"name":"foo"}`),
+				Query: url.Values{"name": {"bar"}},
+			},
+			errorIsNil: false,
+		},
+		{
+			name: "unknown body field",
+			input: &Input{
+				JSON:      []byte(`{}`),
+				BodyField: "foo",
+			},
+			errorIsNil: false,
+		},
+		{
+			name: "body is not an object",
+			input: &Input{
+				JSON: []byte(`[]`),
+			},
+			errorIsNil: false,
+		},
+	}
+	md := newQueryMessageDescriptor(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := md.InputToJSON(tc.input)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if err != nil {
+				perr, ok := err.(*perrors.ProxyError)
+				if !ok {
+					t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+				}
+				if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+					t.Fatalf("got %d, want %d", got, want)
+				}
+				return
+			}
+			if got, want := string(b), tc.json; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if err := md.NewMessage().UnmarshalJSON(b); err != nil {
+				t.Fatalf("JSON should match the message: %s", err.Error())
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package reflection
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
@@ -20,13 +22,33 @@ type MethodInvocation struct {
 
 // Reflector performs reflection on the gRPC service to obtain the method type
 type Reflector interface {
-	CreateInvocation(ctx context.Context, serviceName, methodName string, input []byte) (*MethodInvocation, error)
+	CreateInvocation(ctx context.Context, serviceName, methodName string, input []byte, opts *JSONOptions) (*MethodInvocation, error)
+	CreateInvocationFromInput(ctx context.Context, serviceName, methodName string, input *Input, opts *JSONOptions) (*MethodInvocation, error)
+	CreateInvocationFromProto(ctx context.Context, serviceName, methodName string, input []byte) (*MethodInvocation, error)
+	ResolveService(ctx context.Context, serviceName string) (*ServiceDescriptor, error)
+}
+
+// ReflectorOption configures a Reflector
+type ReflectorOption func(*reflectionClient)
+
+// WithTypeCache caches the message types which are resolved through reflection in c,
+// for the type URLs in Any fields which the files of the services don't define
+func WithTypeCache(c *TypeCache) ReflectorOption {
+	return func(rc *reflectionClient) {
+		if rc.types != nil {
+			rc.types.cache = c
+		}
+	}
 }
 
 // NewReflector creates a new Reflector from the reflection client
-func NewReflector(rc grpcreflectClient) Reflector {
+func NewReflector(rc grpcreflectClient, opts ...ReflectorOption) Reflector {
+	c := newReflectionClient(rc)
+	for _, opt := range opts {
+		opt(c)
+	}
 	return &reflectorImpl{
-		rc: newReflectionClient(rc),
+		rc: c,
 	}
 }
 
@@ -34,12 +56,67 @@ type reflectorImpl struct {
 	rc *reflectionClient
 }
 
-// CreateInvocation creates a MethodInvocation by performing reflection
+// CreateInvocation creates a MethodInvocation by performing reflection.
+// opts may be nil, in which case the input JSON is parsed with the default options.
 func (r *reflectorImpl) CreateInvocation(ctx context.Context,
 	serviceName,
 	methodName string,
 	input []byte,
+	opts *JSONOptions,
+) (*MethodInvocation, error) {
+	methodDesc, err := r.resolveMethod(ctx, serviceName, methodName)
+	if err != nil {
+		return nil, err
+	}
+	return newInvocation(methodDesc, input, opts)
+}
+
+// CreateInvocationFromInput creates a MethodInvocation by performing reflection,
+// with the input message built from the parts of an HTTP request
+func (r *reflectorImpl) CreateInvocationFromInput(ctx context.Context,
+	serviceName,
+	methodName string,
+	input *Input,
+	opts *JSONOptions,
 ) (*MethodInvocation, error) {
+	methodDesc, err := r.resolveMethod(ctx, serviceName, methodName)
+	if err != nil {
+		return nil, err
+	}
+	b, err := methodDesc.GetInputType().InputToJSON(input)
+	if err != nil {
+		return nil, err
+	}
+	return newInvocation(methodDesc, b, opts)
+}
+
+// CreateInvocationFromProto creates a MethodInvocation by performing reflection,
+// with the input message in the protobuf wire format
+func (r *reflectorImpl) CreateInvocationFromProto(ctx context.Context,
+	serviceName,
+	methodName string,
+	input []byte,
+) (*MethodInvocation, error) {
+	methodDesc, err := r.resolveMethod(ctx, serviceName, methodName)
+	if err != nil {
+		return nil, err
+	}
+	inputMessage := methodDesc.GetInputType().NewMessage()
+	if err := inputMessage.UnmarshalProto(input); err != nil {
+		return nil, err
+	}
+	return &MethodInvocation{
+		MethodDescriptor: methodDesc,
+		Message:          inputMessage,
+	}, nil
+}
+
+// ResolveService performs reflection to obtain the descriptor of the service
+func (r *reflectorImpl) ResolveService(ctx context.Context, serviceName string) (*ServiceDescriptor, error) {
+	return r.rc.resolveService(ctx, serviceName)
+}
+
+func (r *reflectorImpl) resolveMethod(ctx context.Context, serviceName, methodName string) (*MethodDescriptor, error) {
 	serviceDesc, err := r.rc.resolveService(ctx, serviceName)
 	if err != nil {
 		return nil, errors.Wrap(err, "service was not found upstream even though it should have been there")
@@ -48,8 +125,12 @@ func (r *reflectorImpl) CreateInvocation(ctx context.Context,
 	if err != nil {
 		return nil, errors.Wrap(err, "method not found upstream")
 	}
+	return methodDesc, nil
+}
+
+func newInvocation(methodDesc *MethodDescriptor, input []byte, opts *JSONOptions) (*MethodInvocation, error) {
 	inputMessage := methodDesc.GetInputType().NewMessage()
-	err = inputMessage.UnmarshalJSON(input)
+	err := inputMessage.UnmarshalJSONWith(input, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +143,8 @@ func (r *reflectorImpl) CreateInvocation(ctx context.Context,
 // reflectionClient performs reflection to obtain descriptors
 type reflectionClient struct {
 	grpcreflectClient
+	// types resolves message types by name, which is nil unless the client supports it
+	types *typeLookup
 }
 
 type grpcreflectClient interface {
@@ -70,9 +153,13 @@ type grpcreflectClient interface {
 
 // newReflectionClient creates a new ReflectionClient
 func newReflectionClient(rc grpcreflectClient) *reflectionClient {
-	return &reflectionClient{
+	c := &reflectionClient{
 		grpcreflectClient: rc,
 	}
+	if mr, ok := rc.(messageResolver); ok {
+		c.types = &typeLookup{rc: mr}
+	}
+	return c
 }
 
 func (c *reflectionClient) resolveService(ctx context.Context,
@@ -86,12 +173,14 @@ func (c *reflectionClient) resolveService(ctx context.Context,
 	}
 	return &ServiceDescriptor{
 		ServiceDescriptor: d,
+		types:             c.types,
 	}, nil
 }
 
 // ServiceDescriptor represents a service type
 type ServiceDescriptor struct {
 	*desc.ServiceDescriptor
+	types *typeLookup
 }
 
 // ServiceDescriptorFromFileDescriptor finds the service descriptor from a file descriptor
@@ -117,25 +206,29 @@ func (s *ServiceDescriptor) FindMethodByName(name string) (*MethodDescriptor, er
 	}
 	return &MethodDescriptor{
 		MethodDescriptor: d,
+		types:            s.types,
 	}, nil
 }
 
 // MethodDescriptor represents a method type
 type MethodDescriptor struct {
 	*desc.MethodDescriptor
+	types *typeLookup
 }
 
 // GetInputType gets the MessageDescriptor for the method input type
 func (m *MethodDescriptor) GetInputType() *MessageDescriptor {
 	return &MessageDescriptor{
-		desc: m.MethodDescriptor.GetInputType(),
+		desc:  m.MethodDescriptor.GetInputType(),
+		types: m.types,
 	}
 }
 
 // GetOutputType gets the MessageDescriptor for the method output type
 func (m *MethodDescriptor) GetOutputType() *MessageDescriptor {
 	return &MessageDescriptor{
-		desc: m.MethodDescriptor.GetOutputType(),
+		desc:  m.MethodDescriptor.GetOutputType(),
+		types: m.types,
 	}
 }
 
@@ -146,13 +239,19 @@ func (m *MethodDescriptor) AsProtoreflectDescriptor() *desc.MethodDescriptor {
 
 // MessageDescriptor represents a message type
 type MessageDescriptor struct {
-	desc *desc.MessageDescriptor
+	desc  *desc.MessageDescriptor
+	types *typeLookup
 }
 
+// messageFactory creates messages which know the well-known types,
+// so that fields of those types are unmarshaled from their proto3 JSON representation
+var messageFactory = dynamic.NewMessageFactoryWithDefaults()
+
 // NewMessage creates a new message from the message descriptor
 func (m *MessageDescriptor) NewMessage() *messageImpl {
 	return &messageImpl{
-		Message: dynamic.NewMessage(m.desc),
+		Message:  messageFactory.NewDynamicMessage(m.desc),
+		resolver: newTypeResolver(m.desc.GetFile(), m.types),
 	}
 }
 
@@ -161,6 +260,22 @@ type Message interface {
 	MarshalJSON() ([]byte, error)
 	// UnmarshalJSON unmarshals JSON into a Message
 	UnmarshalJSON(b []byte) error
+	// MarshalFieldJSON marshals the value of the field named name into JSON
+	MarshalFieldJSON(name string) ([]byte, error)
+	// MarshalJSONWith marshals the Message into JSON with the options
+	MarshalJSONWith(opts *JSONOptions) ([]byte, error)
+	// UnmarshalJSONWith unmarshals JSON into a Message with the options
+	UnmarshalJSONWith(b []byte, opts *JSONOptions) error
+	// MarshalFieldJSONWith marshals the value of the field named name into JSON with the options
+	MarshalFieldJSONWith(name string, opts *JSONOptions) ([]byte, error)
+	// MarshalProto marshals the Message into the protobuf wire format
+	MarshalProto() ([]byte, error)
+	// UnmarshalProto unmarshals the protobuf wire format into a Message
+	UnmarshalProto(b []byte) error
+	// MarshalFieldProto marshals the value of the message field named name into the protobuf wire format
+	MarshalFieldProto(name string) ([]byte, error)
+	// Prune clears the fields which are not selected by the paths of a field mask
+	Prune(paths []string) error
 	// ConvertFrom converts a raw protobuf message into a Message
 	ConvertFrom(target proto.Message) error
 	// AsProtoreflectMessage returns the underlying protoreflect message
@@ -170,10 +285,19 @@ type Message interface {
 // messageImpl is an message value
 type messageImpl struct {
 	*dynamic.Message
+	// resolver resolves the type URLs in Any fields in the conversion to and from JSON
+	resolver jsonpb.AnyResolver
 }
 
 func (m *messageImpl) MarshalJSON() ([]byte, error) {
-	b, err := m.Message.MarshalJSON()
+	return m.MarshalJSONWith(nil)
+}
+
+func (m *messageImpl) MarshalJSONWith(opts *JSONOptions) ([]byte, error) {
+	b, err := m.Message.MarshalJSONPB(opts.marshaler(m.resolver))
+	if err == nil && opts != nil && opts.Int64AsStrings {
+		b, err = quoteInt64s(m.Message.GetMessageDescriptor(), b)
+	}
 	if err != nil {
 		return nil, &perrors.ProxyError{
 			Code:    perrors.Unknown,
@@ -183,16 +307,119 @@ func (m *messageImpl) MarshalJSON() ([]byte, error) {
 	return b, nil
 }
 
+func (m *messageImpl) MarshalFieldJSON(name string) ([]byte, error) {
+	return m.MarshalFieldJSONWith(name, nil)
+}
+
+func (m *messageImpl) MarshalFieldJSONWith(name string, opts *JSONOptions) ([]byte, error) {
+	fd := m.Message.FindFieldDescriptorByName(name)
+	if fd == nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: fmt.Sprintf("backend response has no field %s", name),
+		}
+	}
+	// defaults are emitted so that the field is present even if it has the zero value
+	fieldOpts := JSONOptions{}
+	if opts != nil {
+		fieldOpts = *opts
+	}
+	fieldOpts.EmitDefaults = true
+	b, err := m.MarshalJSONWith(&fieldOpts)
+	if err != nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not marshal backend response into JSON",
+		}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not marshal backend response into JSON",
+		}
+	}
+	for _, key := range []string{fd.AsFieldDescriptorProto().GetJsonName(), fd.GetName()} {
+		if v, ok := fields[key]; ok && key != "" {
+			return v, nil
+		}
+	}
+	return []byte("null"), nil
+}
+
 func (m *messageImpl) UnmarshalJSON(b []byte) error {
-	if err := m.Message.UnmarshalJSON(b); err != nil {
+	return m.UnmarshalJSONWith(b, nil)
+}
+
+func (m *messageImpl) UnmarshalJSONWith(b []byte, opts *JSONOptions) error {
+	if err := m.Message.UnmarshalJSONPB(opts.unmarshaler(m.resolver), b); err != nil {
+		if fe := locateMismatch(m.Message.GetMessageDescriptor(), b, opts, m.resolver); fe != nil {
+			return &perrors.ProxyError{
+				Code:    perrors.MessageTypeMismatch,
+				Message: fmt.Sprintf("input JSON does not match the message type: %s", fe.Error()),
+				Field:   fe,
+			}
+		}
+		return &perrors.ProxyError{
+			Code:    perrors.MessageTypeMismatch,
+			Message: fmt.Sprintf("input JSON does not match the message type: %s", err.Error()),
+		}
+	}
+	return nil
+}
+
+func (m *messageImpl) MarshalProto() ([]byte, error) {
+	b, err := m.Message.Marshal()
+	if err != nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not marshal backend response into protobuf",
+		}
+	}
+	return b, nil
+}
+
+func (m *messageImpl) UnmarshalProto(b []byte) error {
+	if err := m.Message.Unmarshal(b); err != nil {
 		return &perrors.ProxyError{
 			Code:    perrors.MessageTypeMismatch,
-			Message: "input JSON does not match messageImpl type",
+			Message: "input protobuf does not match the message type, or the body is not in the format of the Content-Type header",
 		}
 	}
 	return nil
 }
 
+func (m *messageImpl) MarshalFieldProto(name string) ([]byte, error) {
+	fd := m.Message.FindFieldDescriptorByName(name)
+	if fd == nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: fmt.Sprintf("backend response has no field %s", name),
+		}
+	}
+	if fd.GetMessageType() == nil || fd.IsRepeated() {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: fmt.Sprintf("%s is not a singular message field, which cannot be marshaled into protobuf", name),
+		}
+	}
+	if !m.Message.HasField(fd) {
+		return []byte{}, nil
+	}
+	v, ok := m.Message.GetField(fd).(proto.Message)
+	if !ok {
+		return []byte{}, nil
+	}
+	b, err := proto.Marshal(v)
+	if err != nil {
+		return nil, &perrors.ProxyError{
+			Code:    perrors.Unknown,
+			Message: "could not marshal backend response into protobuf",
+		}
+	}
+	return b, nil
+}
+
 func (m *messageImpl) ConvertFrom(target proto.Message) error {
 	return m.Message.ConvertFrom(target)
 }
@@ -70,7 +70,7 @@ func TestReflectorImpl_CreateInvocation(t *testing.T) {
 			fd := proxytest.NewFileDescriptor(t, proxytest.File)
 			sd := ServiceDescriptorFromFileDescriptor(fd, proxytest.TestService)
 			r := NewReflector(&proxytest.FakeGrpcreflectClient{sd.ServiceDescriptor})
-			i, err := r.CreateInvocation(ctx, tc.serviceName, tc.methodName, []byte(tc.message))
+			i, err := r.CreateInvocation(ctx, tc.serviceName, tc.methodName, []byte(tc.message), nil)
 			if got, want := i == nil, tc.invocationIsNil; got != want {
 				t.Fatalf("got %t, want %t", got, want)
 			}
@@ -297,10 +297,29 @@ func TestMessage_UnmarshalJSON(t *testing.T) {
 		},
 		{
 			name: "type mismatch",
+			json: []byte("{\"body\":\"hello!\"}"),
+			error: &perrors.ProxyError{
+				Code:    perrors.MessageTypeMismatch,
+				Message: "input JSON does not match the message type: field body: expected bytes at offset 8: illegal base64 data",
+				Field: &perrors.FieldError{
+					Path:     "body",
+					Expected: "bytes",
+					Offset:   8,
+					Reason:   "illegal base64 data",
+				},
+			},
+		},
+		{
+			name: "malformed",
 			json: []byte("{\"body\":\"hello!\""),
 			error: &perrors.ProxyError{
 				Code:    perrors.MessageTypeMismatch,
-				Message: "input JSON does not match messageImpl type",
+				Message: "input JSON does not match the message type: expected valid JSON at offset 16: unexpected end of JSON input",
+				Field: &perrors.FieldError{
+					Expected: "valid JSON",
+					Offset:   16,
+					Reason:   "unexpected end of JSON input",
+				},
 			},
 		},
 	}
@@ -325,3 +344,85 @@ func TestMessage_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage_MarshalFieldJSON(t *testing.T) {
+	file := proxytest.NewFileDescriptor(t, proxytest.File)
+	cases := []struct {
+		name       string
+		field      string
+		json       []byte
+		errorIsNil bool
+	}{
+		{
+			name:       "set field",
+			field:      "body",
+			json:       []byte("\"aGVsbG8=\""),
+			errorIsNil: true,
+		},
+		{
+			name:       "field with the zero value",
+			field:      "type",
+			json:       []byte("\"COMPRESSABLE\""),
+			errorIsNil: true,
+		},
+		{
+			name:       "unknown field",
+			field:      "foo",
+			errorIsNil: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			messageDesc := file.FindMessage(messageName)
+			if messageDesc == nil {
+				t.Fatal("messageImpl descriptor is nil")
+			}
+			message := messageImpl{
+				Message: dynamic.NewMessage(messageDesc),
+			}
+			message.Message.SetField(message.Message.FindFieldDescriptorByName("body"), []byte("hello"))
+			j, err := message.MarshalFieldJSON(tc.field)
+			if got, want := err == nil, tc.errorIsNil; got != want {
+				t.Fatalf("got %t, want %t: %v", got, want, err)
+			}
+			if got, want := j, tc.json; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMessage_MarshalProto(t *testing.T) {
+	file := proxytest.NewFileDescriptor(t, proxytest.File)
+	messageDesc := file.FindMessage(messageName)
+	if messageDesc == nil {
+		t.Fatal("messageImpl descriptor is nil")
+	}
+	message := messageImpl{
+		Message: dynamic.NewMessage(messageDesc),
+	}
+	message.Message.SetField(message.Message.FindFieldDescriptorByName("body"), []byte("hello"))
+	b, err := message.MarshalProto()
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err.Error())
+	}
+
+	unmarshaled := messageImpl{
+		Message: dynamic.NewMessage(messageDesc),
+	}
+	if err := unmarshaled.UnmarshalProto(b); err != nil {
+		t.Fatalf("err should be nil, got %s", err.Error())
+	}
+	if got, want := unmarshaled.Message.GetFieldByName("body"), []byte("hello"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	err = unmarshaled.UnmarshalProto([]byte("{\"body\":\"aGVsbG8=\"}"))
+	perr, ok := err.(*perrors.ProxyError)
+	if !ok {
+		t.Fatalf("err should be *errors.ProxyError, got %#v", err)
+	}
+	if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+		t.Fatalf("got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package reflection
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// typeResolver resolves type URLs into messages of the registered types, or of the types in the files reflected from the upstream.
+// Types which are in none of them are resolved through reflection on the upstream, if types is set.
+type typeResolver struct {
+	files []*desc.FileDescriptor
+	types *typeLookup
+}
+
+// AnyResolver returns the resolver of the type URLs in the messages and the errors of the method,
+// which knows the registered types, the types in the file of the method and its dependencies,
+// and the types the upstream resolves through reflection
+func (m *MethodDescriptor) AnyResolver() jsonpb.AnyResolver {
+	return newTypeResolver(m.MethodDescriptor.GetFile(), m.types)
+}
+
+// newTypeResolver creates a typeResolver which knows the types in the file and its dependencies,
+// and resolves the other types with types, which may be nil
+func newTypeResolver(file *desc.FileDescriptor, types *typeLookup) *typeResolver {
+	r := &typeResolver{types: types}
+	seen := make(map[string]struct{})
+	queue := []*desc.FileDescriptor{file}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[f.GetName()]; ok {
+			continue
+		}
+		seen[f.GetName()] = struct{}{}
+		r.files = append(r.files, f)
+		queue = append(queue, f.GetDependencies()...)
+	}
+	return r
+}
+
+// Resolve resolves the type URL into a new message of its type
+func (r *typeResolver) Resolve(typeURL string) (proto.Message, error) {
+	if m, err := perrors.ResolveRegisteredType(typeURL); err == nil {
+		return m, nil
+	}
+	name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+	for _, f := range r.files {
+		if md := f.FindMessage(name); md != nil {
+			return messageFactory.NewDynamicMessage(md), nil
+		}
+	}
+	if r.types != nil {
+		md, err := r.types.resolveMessage(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown message type %s: %s", name, err.Error())
+		}
+		return messageFactory.NewDynamicMessage(md), nil
+	}
+	return nil, fmt.Errorf("unknown message type %s", name)
+}
+
+// messageResolver is implemented by reflection clients which resolve message types by name, such as grpcreflect.Client
+type messageResolver interface {
+	ResolveMessage(messageName string) (*desc.MessageDescriptor, error)
+}
+
+// typeLookup resolves message types through reflection on the upstream, and caches them in cache, which may be nil
+type typeLookup struct {
+	rc    messageResolver
+	cache *TypeCache
+}
+
+// resolveMessage resolves the message type, and caches the descriptor or the failure,
+// so that unknown type URLs do not cost a round trip to the upstream each time
+func (l *typeLookup) resolveMessage(name string) (*desc.MessageDescriptor, error) {
+	if e, ok := l.cache.get(name); ok {
+		return e.md, e.err
+	}
+	md, err := l.rc.ResolveMessage(name)
+	l.cache.put(name, md, err)
+	return md, err
+}
+
+// TypeCache caches the descriptors of message types which an upstream resolved through reflection,
+// and the failures to resolve the types which the upstream does not know.
+// The entries expire after ttl, and zero ttl disables caching. A nil TypeCache caches nothing.
+// A TypeCache is meant to be shared by the connections to the same upstream.
+type TypeCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]typeEntry
+}
+
+type typeEntry struct {
+	md      *desc.MessageDescriptor
+	err     error
+	expires time.Time
+}
+
+// NewTypeCache creates a TypeCache whose entries expire after ttl
+func NewTypeCache(ttl time.Duration) *TypeCache {
+	return &TypeCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]typeEntry),
+	}
+}
+
+// get returns the entry of the message type, and false if it is not cached or has expired
+func (c *TypeCache) get(name string) (typeEntry, bool) {
+	if c == nil {
+		return typeEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return typeEntry{}, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, name)
+		return typeEntry{}, false
+	}
+	return e, true
+}
+
+// put caches the descriptor of the message type, or the error of resolving it
+func (c *TypeCache) put(name string, md *desc.MessageDescriptor, err error) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = typeEntry{
+		md:      md,
+		err:     err,
+		expires: c.now().Add(c.ttl),
+	}
+}
@@ -0,0 +1,267 @@
+package reflection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	any "github.com/golang/protobuf/ptypes/any"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/mercari/grpc-http-proxy/proxy/proxytest"
+
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// newDetailFileDescriptor creates the file which defines a.Detail
+func newDetailFileDescriptor(t *testing.T) *desc.FileDescriptor {
+	t.Helper()
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("detail.proto"),
+		Package: proto.String("a"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Detail"),
+				Field: []*dpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("reason"),
+						JsonName: proto.String("reason"),
+						Number:   proto.Int32(1),
+						Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     dpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd
+}
+
+func TestTypeResolver_Resolve(t *testing.T) {
+	fd := newDetailFileDescriptor(t)
+	detail := messageFactory.NewDynamicMessage(fd.FindMessage("a.Detail"))
+	detail.SetFieldByName("reason", "quota")
+	value, err := detail.Marshal()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cases := []struct {
+		name    string
+		typeURL string
+		json    string
+	}{
+		{
+			name:    "reflected type",
+			typeURL: "type.googleapis.com/a.Detail",
+			json:    `{"@type":"type.googleapis.com/a.Detail","reason":"quota"}`,
+		},
+		{
+			name:    "unknown type",
+			typeURL: "type.googleapis.com/a.Unknown",
+			json:    `{"type_url":"type.googleapis.com/a.Unknown","value":"CgVxdW90YQ=="}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &perrors.GRPCError{
+				StatusCode: int(codes.ResourceExhausted),
+				Message:    "exhausted",
+				Details:    []*any.Any{{TypeUrl: tc.typeURL, Value: value}},
+				Resolver:   newTypeResolver(fd, nil),
+			}
+			var b bytes.Buffer
+			if err := e.WriteJSON(&b); err != nil {
+				t.Fatal(err.Error())
+			}
+			want := `{"code":8,"error_code":"RESOURCE_EXHAUSTED","message":"exhausted","details":[` + tc.json + "]}\n"
+			if got := b.String(); got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// fakeMessageResolver is a reflection client which resolves the services and the messages in its files
+type fakeMessageResolver struct {
+	files []*desc.FileDescriptor
+	// resolved is the number of messages resolved
+	resolved int
+}
+
+func (c *fakeMessageResolver) ResolveService(serviceName string) (*desc.ServiceDescriptor, error) {
+	for _, f := range c.files {
+		if sd := f.FindService(serviceName); sd != nil {
+			return sd, nil
+		}
+	}
+	return nil, errors.New("service not found")
+}
+
+func (c *fakeMessageResolver) ResolveMessage(messageName string) (*desc.MessageDescriptor, error) {
+	c.resolved++
+	for _, f := range c.files {
+		if md := f.FindMessage(messageName); md != nil {
+			return md, nil
+		}
+	}
+	return nil, errors.New("message not found")
+}
+
+// newEnvelopeFileDescriptor creates the file of the service a.Mailbox, whose method Send takes a.Envelope with an Any field
+func newEnvelopeFileDescriptor(t *testing.T) *desc.FileDescriptor {
+	t.Helper()
+	anyFile, err := desc.LoadFileDescriptor("google/protobuf/any.proto")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:       proto.String("envelope.proto"),
+		Package:    proto.String("a"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Envelope"),
+				Field: []*dpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("payload"),
+						JsonName: proto.String("payload"),
+						Number:   proto.Int32(1),
+						Label:    dpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     dpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".google.protobuf.Any"),
+					},
+				},
+			},
+		},
+		Service: []*dpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Mailbox"),
+				Method: []*dpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Send"),
+						InputType:  proto.String(".a.Envelope"),
+						OutputType: proto.String(".a.Envelope"),
+					},
+				},
+			},
+		},
+	}, anyFile)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd
+}
+
+func TestReflector_AnyFields(t *testing.T) {
+	input := `{"payload":{"@type":"type.googleapis.com/a.Detail","reason":"quota"}}`
+
+	t.Run("resolved through reflection", func(t *testing.T) {
+		rc := &fakeMessageResolver{files: []*desc.FileDescriptor{newEnvelopeFileDescriptor(t), newDetailFileDescriptor(t)}}
+		cache := NewTypeCache(time.Minute)
+		for i := 0; i < 2; i++ {
+			r := NewReflector(rc, WithTypeCache(cache))
+			invocation, err := r.CreateInvocation(context.Background(), "a.Mailbox", "Send", []byte(input), nil)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			b, err := invocation.Message.MarshalJSON()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := string(b), input; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		}
+		if got, want := rc.resolved, 1; got != want {
+			t.Errorf("got %d resolved messages, want %d", got, want)
+		}
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		rc := &fakeMessageResolver{files: []*desc.FileDescriptor{newEnvelopeFileDescriptor(t), newDetailFileDescriptor(t)}}
+		for i := 0; i < 2; i++ {
+			r := NewReflector(rc)
+			if _, err := r.CreateInvocation(context.Background(), "a.Mailbox", "Send", []byte(input), nil); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if got, want := rc.resolved, 2; got != want {
+			t.Errorf("got %d resolved messages, want %d", got, want)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		rc := &fakeMessageResolver{files: []*desc.FileDescriptor{newEnvelopeFileDescriptor(t)}}
+		r := NewReflector(rc)
+		_, err := r.CreateInvocation(context.Background(), "a.Mailbox", "Send", []byte(input), nil)
+		perr, ok := err.(*perrors.ProxyError)
+		if !ok {
+			t.Fatalf("got %v, want a ProxyError", err)
+		}
+		if got, want := perr.Code, perrors.MessageTypeMismatch; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("unknown type cached", func(t *testing.T) {
+		rc := &fakeMessageResolver{files: []*desc.FileDescriptor{newEnvelopeFileDescriptor(t)}}
+		cache := NewTypeCache(time.Minute)
+		for i := 0; i < 2; i++ {
+			r := NewReflector(rc, WithTypeCache(cache))
+			if _, err := r.CreateInvocation(context.Background(), "a.Mailbox", "Send", []byte(input), nil); err == nil {
+				t.Fatal("got no error, want an error of the unknown type")
+			}
+		}
+		if got, want := rc.resolved, 1; got != want {
+			t.Errorf("got %d resolved messages, want %d", got, want)
+		}
+	})
+
+	t.Run("client without message resolution", func(t *testing.T) {
+		sd := newEnvelopeFileDescriptor(t).FindService("a.Mailbox")
+		r := NewReflector(&proxytest.FakeGrpcreflectClient{ServiceDescriptor: sd})
+		if _, err := r.CreateInvocation(context.Background(), proxytest.TestService, "Send", []byte(input), nil); err == nil {
+			t.Error("got no error, want an error of the unknown type")
+		}
+	})
+}
+
+func TestTypeCache(t *testing.T) {
+	md := newDetailFileDescriptor(t).FindMessage("a.Detail")
+	now := time.Unix(0, 0)
+	c := NewTypeCache(time.Minute)
+	c.now = func() time.Time { return now }
+	c.put("a.Detail", md, nil)
+	if got, ok := c.get("a.Detail"); !ok || got.md != md {
+		t.Errorf("got %v, want %v", got.md, md)
+	}
+	notFound := errors.New("message not found")
+	c.put("a.Unknown", nil, notFound)
+	if got, ok := c.get("a.Unknown"); !ok || got.err != notFound {
+		t.Errorf("got %v, want %v", got.err, notFound)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.get("a.Detail"); ok {
+		t.Error("got an entry, want none after the entry expired")
+	}
+	if _, ok := c.get("a.Unknown"); ok {
+		t.Error("got a failure, want none after the entry expired")
+	}
+
+	var disabled *TypeCache
+	disabled.put("a.Detail", md, nil)
+	if _, ok := disabled.get("a.Detail"); ok {
+		t.Error("got an entry, want none from a nil cache")
+	}
+}
@@ -0,0 +1,10 @@
+package reflection
+
+import (
+	"github.com/mercari/grpc-http-proxy/schema"
+)
+
+// JSONSchema generates the JSON Schema document of the message type, which follows the proto3 JSON mapping
+func (m *MessageDescriptor) JSONSchema() *schema.Document {
+	return schema.NewDocument(m.desc)
+}
@@ -0,0 +1,25 @@
+package reflection
+
+import (
+	"testing"
+
+	"github.com/mercari/grpc-http-proxy/schema"
+)
+
+func TestMessageDescriptor_JSONSchema(t *testing.T) {
+	doc := newQueryMessageDescriptor(t).JSONSchema()
+	if got, want := doc.Dialect, schema.Dialect; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := doc.Ref, "#/$defs/query.testing.Request"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	for _, name := range []string{"query.testing.Request", "query.testing.Inner", "query.testing.Kind"} {
+		if _, ok := doc.Defs[name]; !ok {
+			t.Errorf("definition of %s is missing", name)
+		}
+	}
+	if got, want := doc.Defs["query.testing.Request"].Properties["mask"].Type, "string"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/pkg/errors"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+// Budget limits the number of retries made to an upstream relative to the number of calls,
+// so that retries do not amplify the load on an upstream which is already struggling.
+type Budget struct {
+	ratio  float64
+	burst  float64
+	tokens float64
+	mu     sync.Mutex
+}
+
+// NewBudget creates a new Budget.
+// Each call adds ratio to the budget, and each retry consumes 1 from it.
+// The budget starts with, and never exceeds, burst.
+func NewBudget(ratio float64, burst int) *Budget {
+	return &Budget{
+		ratio:  ratio,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Deposit adds to the budget for a call
+func (b *Budget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Withdraw consumes the budget for a retry.
+// false is returned if there is no budget left.
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Retryable checks if the method may be retried under the policy.
+// Methods are retryable if they are listed in the policy, or if they declare the
+// NO_SIDE_EFFECTS or IDEMPOTENT idempotency level, unless they are excluded by the policy.
+func Retryable(md *desc.MethodDescriptor, p *config.Retry) bool {
+	if p == nil {
+		return false
+	}
+	name := md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+	if matchesAny(p.ExcludedMethods, name) {
+		return false
+	}
+	if matchesAny(p.Methods, name) {
+		return true
+	}
+	switch md.GetMethodOptions().GetIdempotencyLevel() {
+	case dpb.MethodOptions_NO_SIDE_EFFECTS, dpb.MethodOptions_IDEMPOTENT:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchesAny checks if the fully qualified method name matches any of the patterns
+func matchesAny(patterns []string, method string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == method {
+			return true
+		}
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(method, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do calls f, and retries it while the error is retryable and the policy and budget allow it.
+// retryable tells whether the method is retryable at all, and should be obtained through Retryable.
+// The number of attempts is returned along with the error of the last attempt.
+func Do(ctx context.Context, p *config.Retry, b *Budget, retryable bool, f func() error) (int, error) {
+	if b != nil {
+		b.Deposit()
+	}
+	attempts := 0
+	for {
+		attempts++
+		err := f()
+		if err == nil || !retryable || p == nil || attempts >= p.MaxAttempts || !isRetryableError(err) {
+			return attempts, err
+		}
+		if b != nil && !b.Withdraw() {
+			return attempts, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempts, err
+		case <-time.After(Backoff(p, attempts)):
+		}
+	}
+}
+
+// Backoff returns the wait before the retry following the specified attempt.
+// The wait is randomized between zero and an exponentially increasing limit.
+func Backoff(p *config.Retry, attempt int) time.Duration {
+	limit := p.InitialBackoff
+	for i := 1; i < attempt && limit < p.MaxBackoff; i++ {
+		limit *= 2
+	}
+	if p.MaxBackoff > 0 && limit > p.MaxBackoff {
+		limit = p.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// isRetryableError checks if the error is caused by the upstream being unavailable
+func isRetryableError(err error) bool {
+	perr, ok := errors.Cause(err).(*perrors.ProxyError)
+	return ok && perr.Code == perrors.UpstreamConnFailure
+}
@@ -0,0 +1,250 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/mercari/grpc-http-proxy/config"
+	perrors "github.com/mercari/grpc-http-proxy/errors"
+)
+
+func newServiceDescriptor(t *testing.T) *desc.ServiceDescriptor {
+	t.Helper()
+	method := func(name string, level dpb.MethodOptions_IdempotencyLevel) *dpb.MethodDescriptorProto {
+		return &dpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".retry.testing.Empty"),
+			OutputType: proto.String(".retry.testing.Empty"),
+			Options: &dpb.MethodOptions{
+				IdempotencyLevel: level.Enum(),
+			},
+		}
+	}
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:    proto.String("retry_testing.proto"),
+		Package: proto.String("retry.testing"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*dpb.DescriptorProto{
+			{Name: proto.String("Empty")},
+		},
+		Service: []*dpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Service"),
+				Method: []*dpb.MethodDescriptorProto{
+					method("Get", dpb.MethodOptions_NO_SIDE_EFFECTS),
+					method("Put", dpb.MethodOptions_IDEMPOTENT),
+					method("Post", dpb.MethodOptions_IDEMPOTENCY_UNKNOWN),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd.FindService("retry.testing.Service")
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(0.5, 2)
+	if !b.Withdraw() || !b.Withdraw() {
+		t.Fatal("burst should be available")
+	}
+	if b.Withdraw() {
+		t.Fatal("budget should be exhausted")
+	}
+	b.Deposit()
+	if b.Withdraw() {
+		t.Fatal("half a token should not be withdrawable")
+	}
+	b.Deposit()
+	if !b.Withdraw() {
+		t.Fatal("budget should be replenished")
+	}
+	for i := 0; i < 10; i++ {
+		b.Deposit()
+	}
+	if got, want := b.tokens, 2.0; got != want {
+		t.Fatalf("got %f, want %f", got, want)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		name      string
+		method    string
+		policy    *config.Retry
+		retryable bool
+	}{
+		{
+			name:      "no side effects",
+			method:    "Get",
+			policy:    &config.Retry{},
+			retryable: true,
+		},
+		{
+			name:      "idempotent",
+			method:    "Put",
+			policy:    &config.Retry{},
+			retryable: true,
+		},
+		{
+			name:      "unknown idempotency",
+			method:    "Post",
+			policy:    &config.Retry{},
+			retryable: false,
+		},
+		{
+			name:      "listed method",
+			method:    "Post",
+			policy:    &config.Retry{Methods: []string{"retry.testing.Service/Post"}},
+			retryable: true,
+		},
+		{
+			name:      "listed service",
+			method:    "Post",
+			policy:    &config.Retry{Methods: []string{"retry.testing.Service/*"}},
+			retryable: true,
+		},
+		{
+			name:   "excluded method",
+			method: "Get",
+			policy: &config.Retry{
+				Methods:         []string{"retry.testing.Service/*"},
+				ExcludedMethods: []string{"retry.testing.Service/Get"},
+			},
+			retryable: false,
+		},
+		{
+			name:      "no policy",
+			method:    "Get",
+			policy:    nil,
+			retryable: false,
+		},
+	}
+	sd := newServiceDescriptor(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			md := sd.FindMethodByName(tc.method)
+			if got, want := Retryable(md, tc.policy), tc.retryable; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	unavailable := &perrors.ProxyError{Code: perrors.UpstreamConnFailure}
+	invalid := &perrors.ProxyError{Code: perrors.MessageTypeMismatch}
+	cases := []struct {
+		name      string
+		policy    *config.Retry
+		budget    *Budget
+		retryable bool
+		errs      []error
+		attempts  int
+		errIsNil  bool
+	}{
+		{
+			name:      "success",
+			policy:    &config.Retry{MaxAttempts: 3},
+			retryable: true,
+			errs:      []error{nil},
+			attempts:  1,
+			errIsNil:  true,
+		},
+		{
+			name:      "success after retry",
+			policy:    &config.Retry{MaxAttempts: 3},
+			retryable: true,
+			errs:      []error{unavailable, nil},
+			attempts:  2,
+			errIsNil:  true,
+		},
+		{
+			name:      "max attempts",
+			policy:    &config.Retry{MaxAttempts: 3},
+			retryable: true,
+			errs:      []error{unavailable, unavailable, unavailable, nil},
+			attempts:  3,
+			errIsNil:  false,
+		},
+		{
+			name:      "method not retryable",
+			policy:    &config.Retry{MaxAttempts: 3},
+			retryable: false,
+			errs:      []error{unavailable, nil},
+			attempts:  1,
+			errIsNil:  false,
+		},
+		{
+			name:      "error not retryable",
+			policy:    &config.Retry{MaxAttempts: 3},
+			retryable: true,
+			errs:      []error{invalid, nil},
+			attempts:  1,
+			errIsNil:  false,
+		},
+		{
+			name:      "budget exhausted",
+			policy:    &config.Retry{MaxAttempts: 3},
+			budget:    NewBudget(0, 1),
+			retryable: true,
+			errs:      []error{unavailable, unavailable, nil},
+			attempts:  2,
+			errIsNil:  false,
+		},
+		{
+			name:      "no policy",
+			policy:    nil,
+			retryable: true,
+			errs:      []error{unavailable, nil},
+			attempts:  1,
+			errIsNil:  false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			i := 0
+			attempts, err := Do(context.Background(), tc.policy, tc.budget, tc.retryable, func() error {
+				err := tc.errs[i]
+				i++
+				return err
+			})
+			if got, want := attempts, tc.attempts; got != want {
+				t.Fatalf("got %d, want %d", got, want)
+			}
+			if got, want := err == nil, tc.errIsNil; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &config.Retry{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+	cases := []struct {
+		attempt int
+		limit   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 100; i++ {
+			if d := Backoff(p, tc.attempt); d < 0 || d > tc.limit {
+				t.Fatalf("attempt %d: got %s, want at most %s", tc.attempt, d, tc.limit)
+			}
+		}
+	}
+}
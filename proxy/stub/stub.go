@@ -3,9 +3,11 @@ package stub
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	grpc_metadata "google.golang.org/grpc/metadata"
@@ -24,6 +26,13 @@ type Stub interface {
 		ctx context.Context,
 		invocation *reflection.MethodInvocation,
 		md *metadata.Metadata) (reflection.Message, error)
+
+	// InvokeServerStream calls the server-streaming backend method, and passes each response message to recv
+	InvokeServerStream(
+		ctx context.Context,
+		invocation *reflection.MethodInvocation,
+		md *metadata.Metadata,
+		recv func(reflection.Message) error) error
 }
 
 type stubImpl struct {
@@ -52,30 +61,91 @@ func (s *stubImpl) InvokeRPC(
 		invocation.Message.AsProtoreflectMessage(),
 		grpc.Header((*grpc_metadata.MD)(md)))
 	if err != nil {
-		stat := status.Convert(err)
-		if err != nil && stat.Code() == codes.Unavailable {
-			return nil, &errors.ProxyError{
-				Code:    errors.UpstreamConnFailure,
-				Message: fmt.Sprintf("could not connect to backend"),
-			}
+		return nil, convertError(ctx, err, invocation)
+	}
+	return convertOutput(invocation, o)
+}
+
+// InvokeServerStream calls the server-streaming backend method, and passes each response message to recv.
+// The call is canceled if recv returns an error, which is then returned as it is.
+func (s *stubImpl) InvokeServerStream(
+	ctx context.Context,
+	invocation *reflection.MethodInvocation,
+	md *metadata.Metadata,
+	recv func(reflection.Message) error) error {
+
+	invoker, ok := s.stub.(serverStreamInvoker)
+	if !ok {
+		return &errors.ProxyError{
+			Code:    errors.Unknown,
+			Message: "server-streaming calls are not supported by the stub; this is a bug",
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := invoker.InvokeRpcServerStream(ctx,
+		invocation.MethodDescriptor.AsProtoreflectDescriptor(),
+		invocation.Message.AsProtoreflectMessage(),
+		grpc.Header((*grpc_metadata.MD)(md)))
+	if err != nil {
+		return convertError(ctx, err, invocation)
+	}
+	for {
+		o, err := stream.RecvMsg()
+		if err == io.EOF {
+			return nil
 		}
+		if err != nil {
+			return convertError(ctx, err, invocation)
+		}
+		outputMsg, err := convertOutput(invocation, o)
+		if err != nil {
+			return err
+		}
+		if err := recv(outputMsg); err != nil {
+			return err
+		}
+	}
+}
+
+// serverStreamInvoker is implemented by the grpcdynamic stub, but not necessarily by fakes
+type serverStreamInvoker interface {
+	InvokeRpcServerStream(ctx context.Context, method *desc.MethodDescriptor, request proto.Message, opts ...grpc.CallOption) (*grpcdynamic.ServerStream, error)
+}
 
-		// When InvokeRPC returns an error, it should always be a gRPC error, so this should not panic
-		return nil, &errors.GRPCError{
-			StatusCode: int(stat.Code()),
-			Message:    stat.Message(),
-			Details:    stat.Proto().Details,
+// convertError converts the error returned by a call into the errors of the proxy.
+// The details of errors returned by the upstream are resolved with the types known to the invocation.
+func convertError(ctx context.Context, err error, invocation *reflection.MethodInvocation) error {
+	stat := status.Convert(err)
+	if stat.Code() == codes.Unavailable {
+		return &errors.ProxyError{
+			Code:    errors.UpstreamConnFailure,
+			Message: fmt.Sprintf("could not connect to backend"),
+		}
+	}
+	if stat.Code() == codes.DeadlineExceeded && ctx.Err() == context.DeadlineExceeded {
+		return &errors.ProxyError{
+			Code:    errors.DeadlineExceeded,
+			Message: "deadline exceeded before the backend responded",
 		}
 	}
-	outputMsg := invocation.MethodDescriptor.GetOutputType().NewMessage()
-	err = outputMsg.ConvertFrom(o)
 
-	if err != nil {
+	// When the stub returns an error, it should always be a gRPC error, so this should not panic
+	return &errors.GRPCError{
+		StatusCode: int(stat.Code()),
+		Message:    stat.Message(),
+		Details:    stat.Proto().Details,
+		Resolver:   invocation.MethodDescriptor.AnyResolver(),
+	}
+}
+
+func convertOutput(invocation *reflection.MethodInvocation, o proto.Message) (reflection.Message, error) {
+	outputMsg := invocation.MethodDescriptor.GetOutputType().NewMessage()
+	if err := outputMsg.ConvertFrom(o); err != nil {
 		return nil, &errors.ProxyError{
 			Code:    errors.Unknown,
 			Message: "response from backend could not be converted internally; this is a bug",
 		}
 	}
-
 	return outputMsg, nil
 }
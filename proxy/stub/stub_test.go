@@ -4,6 +4,7 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"google.golang.org/grpc"
@@ -28,6 +29,7 @@ func TestStub_InvokeRPC(t *testing.T) {
 	cases := []struct {
 		name           string
 		methodName     string
+		expired        bool
 		outputMsgIsNil bool
 		error
 	}{
@@ -37,6 +39,16 @@ func TestStub_InvokeRPC(t *testing.T) {
 			outputMsgIsNil: false,
 			error:          nil,
 		},
+		{
+			name:           "deadline exceeded",
+			methodName:     "EmptyCall",
+			expired:        true,
+			outputMsgIsNil: true,
+			error: &errors.ProxyError{
+				Code:    errors.DeadlineExceeded,
+				Message: "deadline exceeded before the backend responded",
+			},
+		},
 		{
 			name:           "grpc error",
 			methodName:     "UnaryCall",
@@ -62,6 +74,11 @@ func TestStub_InvokeRPC(t *testing.T) {
 			inputMsgDesc := methodDesc.GetInputType()
 			inputMsg := inputMsgDesc.NewMessage()
 			ctx := context.Background()
+			if tc.expired {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, time.Now())
+				defer cancel()
+			}
 
 			stub := &stubImpl{
 				stub: &proxytest.FakeGrpcdynamicStub{},
@@ -80,6 +97,10 @@ func TestStub_InvokeRPC(t *testing.T) {
 					}
 				case *errors.GRPCError:
 					expected := tc.error.(*errors.GRPCError)
+					if v.Resolver == nil {
+						t.Fatal("resolver of the details should be set")
+					}
+					v.Resolver = nil
 					if got, want := v, expected; !reflect.DeepEqual(got, want) {
 						t.Fatalf("got %#v, want %#v", got, want)
 					}
@@ -0,0 +1,230 @@
+// Package schema generates JSON schemas of messages, following the proto3 JSON mapping
+// https://developers.google.com/protocol-buffers/docs/proto3#json
+package schema
+
+import (
+	"sort"
+	"strings"
+
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Schema is a schema object in the subset of JSON Schema which is shared with OpenAPI 3
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+}
+
+// Dialect is the dialect of JSON Schema documents
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Document is a JSON Schema document of a message, whose messages and enums are defined in $defs
+type Document struct {
+	Dialect string `json:"$schema"`
+	*Schema
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// NewDocument generates the JSON Schema document of the message type
+func NewDocument(md *desc.MessageDescriptor) *Document {
+	g := NewGenerator("#/$defs/")
+	return &Document{
+		Dialect: Dialect,
+		Schema:  g.Message(md),
+		Defs:    g.Definitions,
+	}
+}
+
+// Generator generates the schemas of messages.
+// Messages and enums are defined once in Definitions, and referred to with RefPrefix followed by their fully qualified names.
+type Generator struct {
+	RefPrefix   string
+	Definitions map[string]*Schema
+}
+
+// NewGenerator creates a Generator whose references start with refPrefix, such as "#/components/schemas/"
+func NewGenerator(refPrefix string) *Generator {
+	return &Generator{
+		RefPrefix:   refPrefix,
+		Definitions: make(map[string]*Schema),
+	}
+}
+
+// Message returns the schema of the message type.
+// It is a reference to the definition of the message, except for well-known types which have their own representations.
+func (g *Generator) Message(md *desc.MessageDescriptor) *Schema {
+	if s := wellKnownType(md.GetFullyQualifiedName()); s != nil {
+		return s
+	}
+	name := md.GetFullyQualifiedName()
+	if _, ok := g.Definitions[name]; !ok {
+		s := &Schema{
+			Type:        "object",
+			Description: comments(md),
+			Properties:  make(map[string]*Schema),
+		}
+		// the definition is added before its fields, so that recursive messages refer to it
+		g.Definitions[name] = s
+		for _, fd := range md.GetFields() {
+			p := g.field(fd)
+			p.Description = comments(fd)
+			s.Properties[fd.GetJSONName()] = p
+		}
+		for _, od := range md.GetOneOfs() {
+			s.AllOf = append(s.AllOf, oneOf(od))
+		}
+	}
+	return &Schema{Ref: g.RefPrefix + name}
+}
+
+func (g *Generator) field(fd *desc.FieldDescriptor) *Schema {
+	if fd.IsMap() {
+		return &Schema{
+			Type:                 "object",
+			AdditionalProperties: g.value(fd.GetMapValueType()),
+		}
+	}
+	if fd.IsRepeated() {
+		return &Schema{
+			Type:  "array",
+			Items: g.value(fd),
+		}
+	}
+	return g.value(fd)
+}
+
+// value returns the schema of a single value of the field
+func (g *Generator) value(fd *desc.FieldDescriptor) *Schema {
+	switch fd.GetType() {
+	case dpb.FieldDescriptorProto_TYPE_MESSAGE, dpb.FieldDescriptorProto_TYPE_GROUP:
+		return g.Message(fd.GetMessageType())
+	case dpb.FieldDescriptorProto_TYPE_ENUM:
+		return g.enum(fd.GetEnumType())
+	}
+	return scalar(fd.GetType())
+}
+
+func (g *Generator) enum(ed *desc.EnumDescriptor) *Schema {
+	name := ed.GetFullyQualifiedName()
+	if name == "google.protobuf.NullValue" {
+		return &Schema{}
+	}
+	if _, ok := g.Definitions[name]; !ok {
+		s := &Schema{Type: "string", Description: comments(ed)}
+		for _, vd := range ed.GetValues() {
+			s.Enum = append(s.Enum, vd.GetName())
+		}
+		g.Definitions[name] = s
+	}
+	return &Schema{Ref: g.RefPrefix + name}
+}
+
+// scalar returns the schema of a scalar type.
+// 64-bit integers are strings in the proto3 JSON mapping.
+func scalar(t dpb.FieldDescriptorProto_Type) *Schema {
+	switch t {
+	case dpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return &Schema{Type: "number", Format: "double"}
+	case dpb.FieldDescriptorProto_TYPE_FLOAT:
+		return &Schema{Type: "number", Format: "float"}
+	case dpb.FieldDescriptorProto_TYPE_INT32, dpb.FieldDescriptorProto_TYPE_SINT32, dpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case dpb.FieldDescriptorProto_TYPE_UINT32, dpb.FieldDescriptorProto_TYPE_FIXED32:
+		return &Schema{Type: "integer", Format: "int64"}
+	case dpb.FieldDescriptorProto_TYPE_INT64, dpb.FieldDescriptorProto_TYPE_SINT64, dpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return &Schema{Type: "string", Format: "int64"}
+	case dpb.FieldDescriptorProto_TYPE_UINT64, dpb.FieldDescriptorProto_TYPE_FIXED64:
+		return &Schema{Type: "string", Format: "uint64"}
+	case dpb.FieldDescriptorProto_TYPE_BOOL:
+		return &Schema{Type: "boolean"}
+	case dpb.FieldDescriptorProto_TYPE_BYTES:
+		return &Schema{Type: "string", Format: "byte"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+// wellKnownType returns the schema of the well-known type, or nil if the message is not one
+func wellKnownType(name string) *Schema {
+	switch name {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]+)?s$`}
+	case "google.protobuf.FieldMask":
+		return &Schema{Type: "string"}
+	case "google.protobuf.Struct":
+		return &Schema{Type: "object", AdditionalProperties: &Schema{}}
+	case "google.protobuf.Value":
+		return &Schema{}
+	case "google.protobuf.ListValue":
+		return &Schema{Type: "array", Items: &Schema{}}
+	case "google.protobuf.Empty":
+		return &Schema{Type: "object"}
+	case "google.protobuf.Any":
+		return &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"@type": {Type: "string"},
+			},
+			Required:             []string{"@type"},
+			AdditionalProperties: &Schema{},
+		}
+	case "google.protobuf.DoubleValue":
+		return scalar(dpb.FieldDescriptorProto_TYPE_DOUBLE)
+	case "google.protobuf.FloatValue":
+		return scalar(dpb.FieldDescriptorProto_TYPE_FLOAT)
+	case "google.protobuf.Int64Value":
+		return scalar(dpb.FieldDescriptorProto_TYPE_INT64)
+	case "google.protobuf.UInt64Value":
+		return scalar(dpb.FieldDescriptorProto_TYPE_UINT64)
+	case "google.protobuf.Int32Value":
+		return scalar(dpb.FieldDescriptorProto_TYPE_INT32)
+	case "google.protobuf.UInt32Value":
+		return scalar(dpb.FieldDescriptorProto_TYPE_UINT32)
+	case "google.protobuf.BoolValue":
+		return scalar(dpb.FieldDescriptorProto_TYPE_BOOL)
+	case "google.protobuf.StringValue":
+		return scalar(dpb.FieldDescriptorProto_TYPE_STRING)
+	case "google.protobuf.BytesValue":
+		return scalar(dpb.FieldDescriptorProto_TYPE_BYTES)
+	}
+	return nil
+}
+
+// oneOf returns the schema which allows at most one of the fields in the oneof to be set
+func oneOf(od *desc.OneOfDescriptor) *Schema {
+	names := make([]string, 0, len(od.GetChoices()))
+	for _, fd := range od.GetChoices() {
+		names = append(names, fd.GetJSONName())
+	}
+	sort.Strings(names)
+	s := &Schema{
+		Description: "at most one of the fields in the oneof " + od.GetName() + " can be set",
+	}
+	set := &Schema{}
+	for _, name := range names {
+		s.OneOf = append(s.OneOf, &Schema{Required: []string{name}})
+		set.AnyOf = append(set.AnyOf, &Schema{Required: []string{name}})
+	}
+	s.OneOf = append(s.OneOf, &Schema{Not: set})
+	return s
+}
+
+// comments returns the leading comments of the element in its source, which are blank unless the descriptor has source info
+func comments(d desc.Descriptor) string {
+	return strings.TrimSpace(d.GetSourceInfo().GetLeadingComments())
+}
@@ -0,0 +1,235 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	_ "github.com/golang/protobuf/ptypes/timestamp"
+	_ "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/jhump/protoreflect/desc"
+)
+
+func newMessageDescriptor(t *testing.T) *desc.MessageDescriptor {
+	t.Helper()
+	field := func(name, jsonName string, number int32, label dpb.FieldDescriptorProto_Label, typ dpb.FieldDescriptorProto_Type, typeName string) *dpb.FieldDescriptorProto {
+		f := &dpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(jsonName),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := dpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := dpb.FieldDescriptorProto_LABEL_REPEATED
+	message := dpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	timestamp, err := desc.LoadFileDescriptor("google/protobuf/timestamp.proto")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	wrappers, err := desc.LoadFileDescriptor("google/protobuf/wrappers.proto")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	first := field("first", "first", 8, optional, dpb.FieldDescriptorProto_TYPE_STRING, "")
+	first.OneofIndex = proto.Int32(0)
+	second := field("second", "second", 9, optional, dpb.FieldDescriptorProto_TYPE_INT32, "")
+	second.OneofIndex = proto.Int32(0)
+	fd, err := desc.CreateFileDescriptor(&dpb.FileDescriptorProto{
+		Name:       proto.String("schema_testing.proto"),
+		Package:    proto.String("schema.testing"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		EnumType: []*dpb.EnumDescriptorProto{
+			{
+				Name: proto.String("Kind"),
+				Value: []*dpb.EnumValueDescriptorProto{
+					{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+					{Name: proto.String("FOO"), Number: proto.Int32(1)},
+				},
+			},
+		},
+		MessageType: []*dpb.DescriptorProto{
+			{
+				Name: proto.String("Node"),
+				Field: []*dpb.FieldDescriptorProto{
+					field("id", "id", 1, optional, dpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("size", "size", 2, optional, dpb.FieldDescriptorProto_TYPE_UINT32, ""),
+					field("kind", "kind", 3, optional, dpb.FieldDescriptorProto_TYPE_ENUM, ".schema.testing.Kind"),
+					field("children", "children", 4, repeated, message, ".schema.testing.Node"),
+					field("labels", "labels", 5, repeated, message, ".schema.testing.Node.LabelsEntry"),
+					field("created_at", "createdAt", 6, optional, message, ".google.protobuf.Timestamp"),
+					field("count", "count", 7, optional, message, ".google.protobuf.Int64Value"),
+					first,
+					second,
+				},
+				NestedType: []*dpb.DescriptorProto{
+					{
+						Name: proto.String("LabelsEntry"),
+						Field: []*dpb.FieldDescriptorProto{
+							field("key", "key", 1, optional, dpb.FieldDescriptorProto_TYPE_STRING, ""),
+							field("value", "value", 2, optional, dpb.FieldDescriptorProto_TYPE_BYTES, ""),
+						},
+						Options: &dpb.MessageOptions{MapEntry: proto.Bool(true)},
+					},
+				},
+				OneofDecl: []*dpb.OneofDescriptorProto{
+					{Name: proto.String("choice")},
+				},
+			},
+		},
+		SourceCodeInfo: &dpb.SourceCodeInfo{
+			Location: []*dpb.SourceCodeInfo_Location{
+				{Path: []int32{4, 0}, Span: []int32{0, 0, 0}, LeadingComments: proto.String(" A node of a tree.\n")},
+				{Path: []int32{4, 0, 2, 0}, Span: []int32{0, 0, 0}, LeadingComments: proto.String(" The ID of the node.\n")},
+			},
+		},
+	}, timestamp, wrappers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return fd.FindMessage("schema.testing.Node")
+}
+
+func TestGenerator_Message(t *testing.T) {
+	g := NewGenerator("#/definitions/")
+	got := g.Message(newMessageDescriptor(t))
+	if want := (&Schema{Ref: "#/definitions/schema.testing.Node"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := len(g.Definitions), 2; got != want {
+		t.Fatalf("got %d definitions, want %d", got, want)
+	}
+	enum := g.Definitions["schema.testing.Kind"]
+	if want := (&Schema{Type: "string", Enum: []string{"UNKNOWN", "FOO"}}); !reflect.DeepEqual(enum, want) {
+		t.Errorf("got %v, want %v", enum, want)
+	}
+
+	node := g.Definitions["schema.testing.Node"]
+	if node == nil {
+		t.Fatal("definition of the message is missing")
+	}
+	if got, want := node.Type, "object"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := node.Description, "A node of a tree."; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	cases := []struct {
+		name string
+		want *Schema
+	}{
+		{
+			name: "id",
+			want: &Schema{Type: "string", Format: "int64", Description: "The ID of the node."},
+		},
+		{
+			name: "size",
+			want: &Schema{Type: "integer", Format: "int64"},
+		},
+		{
+			name: "kind",
+			want: &Schema{Ref: "#/definitions/schema.testing.Kind"},
+		},
+		{
+			name: "children",
+			want: &Schema{Type: "array", Items: &Schema{Ref: "#/definitions/schema.testing.Node"}},
+		},
+		{
+			name: "labels",
+			want: &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string", Format: "byte"}},
+		},
+		{
+			name: "createdAt",
+			want: &Schema{Type: "string", Format: "date-time"},
+		},
+		{
+			name: "count",
+			want: &Schema{Type: "string", Format: "int64"},
+		},
+		{
+			name: "first",
+			want: &Schema{Type: "string"},
+		},
+		{
+			name: "second",
+			want: &Schema{Type: "integer", Format: "int32"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := node.Properties[tc.name]
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+	if got, want := len(node.Properties), len(cases); got != want {
+		t.Errorf("got %d properties, want %d", got, want)
+	}
+
+	if got, want := len(node.AllOf), 1; got != want {
+		t.Fatalf("got %d oneofs, want %d", got, want)
+	}
+	wantOneOf := []*Schema{
+		{Required: []string{"first"}},
+		{Required: []string{"second"}},
+		{Not: &Schema{AnyOf: []*Schema{
+			{Required: []string{"first"}},
+			{Required: []string{"second"}},
+		}}},
+	}
+	if got := node.AllOf[0].OneOf; !reflect.DeepEqual(got, wantOneOf) {
+		t.Errorf("got %v, want %v", got, wantOneOf)
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	cases := []struct {
+		name string
+		md   func(t *testing.T) *desc.MessageDescriptor
+		want string
+	}{
+		{
+			name: "message",
+			md:   newMessageDescriptor,
+			want: `{"$schema":"https://json-schema.org/draft/2020-12/schema","$ref":"#/$defs/schema.testing.Node"}`,
+		},
+		{
+			name: "well-known type",
+			md: func(t *testing.T) *desc.MessageDescriptor {
+				return newMessageDescriptor(t).FindFieldByName("created_at").GetMessageType()
+			},
+			want: `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"string","format":"date-time"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := NewDocument(tc.md(t))
+			defs := doc.Defs
+			doc.Defs = nil
+			b, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if got, want := string(b), tc.want; got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if doc.Ref == "" {
+				return
+			}
+			if _, ok := defs[strings.TrimPrefix(doc.Ref, "#/$defs/")]; !ok {
+				t.Errorf("definition of %s is missing", doc.Ref)
+			}
+		})
+	}
+}
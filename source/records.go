@@ -2,7 +2,11 @@ package source
 
 import (
 	"fmt"
+	"math/rand"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/mercari/grpc-http-proxy/errors"
@@ -10,10 +14,17 @@ import (
 
 type versions map[string][]*url.URL
 
+// OutlierDetector tells whether an upstream is ejected because it is unhealthy
+type OutlierDetector interface {
+	Ejected(u *url.URL) bool
+}
+
 // Records contains mappings from a gRPC service to upstream hosts
 // It holds one upstream for each service version
 type Records struct {
 	m         map[string]versions
+	balancing bool
+	detector  OutlierDetector
 	recordsMu sync.RWMutex
 }
 
@@ -33,51 +44,130 @@ func (r *Records) ClearRecords() {
 	r.m = make(map[string]versions)
 }
 
-// GetRecord gets a records of the specified (service, version) pair
+// GetRecord gets a records of the specified (service, version) pair.
+// Errors of unresolvable pairs carry the known versions of the service, or the closest services if the service is unknown.
 func (r *Records) GetRecord(svc, version string) (*url.URL, error) {
 	r.recordsMu.RLock()
 	defer r.recordsMu.RUnlock()
 	vs, ok := r.m[svc]
 	if !ok {
+		suggestions := closestServices(svc, r.serviceNames())
+		msg := fmt.Sprintf("The gRPC service %s is unresolvable", svc)
+		if len(suggestions) > 0 {
+			msg += fmt.Sprintf(". Did you mean %s?", strings.Join(suggestions, ", "))
+		}
 		return nil, &errors.ProxyError{
 			Code:    errors.ServiceUnresolvable,
-			Message: fmt.Sprintf("The gRPC service %s is unresolvable", svc),
+			Message: msg,
+			Resolution: &errors.ResolutionError{
+				Service:     svc,
+				Version:     version,
+				Suggestions: suggestions,
+			},
 		}
 	}
 	if version == "" {
 		if len(vs) != 1 {
+			known := vs.names()
 			return nil, &errors.ProxyError{
 				Code: errors.VersionNotSpecified,
 				Message: fmt.Sprintf("There are multiple version of the gRPC service %s available. "+
-					"You must specify one", svc),
+					"You must specify one of %s", svc, strings.Join(quote(known), ", ")),
+				Resolution: &errors.ResolutionError{
+					Service:  svc,
+					Versions: known,
+				},
 			}
 		}
 		for _, entries := range vs {
-			if len(entries) != 1 {
-				return nil, &errors.ProxyError{
-					Code: errors.VersionUndecidable,
-					Message: fmt.Sprintf("Multiple possible backends found for the gRPC service %s. "+
-						"Add annotations to distinguish versions", svc),
-				}
-			}
-			return entries[0], nil // this returns the first (and only) ServiceURL
+			return r.selectEntry(svc, entries) // this selects from the first (and only) version
 		}
 	}
 	entries, ok := vs[version]
 	if !ok {
+		known := vs.names()
 		return nil, &errors.ProxyError{
-			Code:    errors.ServiceUnresolvable,
-			Message: fmt.Sprintf("Version %s of the gRPC service %s is unresolvable", version, svc),
+			Code: errors.ServiceUnresolvable,
+			Message: fmt.Sprintf("Version %s of the gRPC service %s is unresolvable. "+
+				"The known versions are %s", version, svc, strings.Join(quote(known), ", ")),
+			Resolution: &errors.ResolutionError{
+				Service:  svc,
+				Version:  version,
+				Versions: known,
+			},
 		}
 	}
-	if len(entries) != 1 {
+	return r.selectEntry(svc, entries)
+}
+
+// names returns the versions sorted by name
+func (vs versions) names() []string {
+	names := make([]string, 0, len(vs))
+	for v := range vs {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quote quotes the versions, so that the blank version is visible in messages
+func quote(versions []string) []string {
+	quoted := make([]string, 0, len(versions))
+	for _, v := range versions {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return quoted
+}
+
+// serviceNames returns the names of the services which have records
+func (r *Records) serviceNames() []string {
+	names := make([]string, 0, len(r.m))
+	for svc := range r.m {
+		names = append(names, svc)
+	}
+	return names
+}
+
+// selectEntry selects the upstream from the entries of a (service, version) pair.
+// Multiple entries are undecidable, unless balancing is enabled.
+// In that case, one of the entries which are not ejected by the OutlierDetector, if any, is selected at random.
+// If all entries are ejected, one of them is selected regardless.
+func (r *Records) selectEntry(svc string, entries []*url.URL) (*url.URL, error) {
+	if len(entries) == 1 {
+		return entries[0], nil
+	}
+	if !r.balancing || len(entries) == 0 {
 		return nil, &errors.ProxyError{
 			Code: errors.VersionUndecidable,
 			Message: fmt.Sprintf("Multiple possible backends found for the gRPC service %s. "+
 				"Add annotations to distinguish versions", svc),
 		}
 	}
-	return entries[0], nil
+	candidates := make([]*url.URL, 0, len(entries))
+	for _, e := range entries {
+		if r.detector == nil || !r.detector.Ejected(e) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = entries
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+// SetOutlierDetector sets the OutlierDetector used to skip ejected upstreams when balancing is enabled
+func (r *Records) SetOutlierDetector(d OutlierDetector) {
+	r.recordsMu.Lock()
+	defer r.recordsMu.Unlock()
+	r.detector = d
+}
+
+// SetBalancing enables or disables balancing calls across multiple upstreams for a (service, version) pair.
+// Once enabled, such upstreams are no longer undecidable.
+func (r *Records) SetBalancing(enabled bool) {
+	r.recordsMu.Lock()
+	defer r.recordsMu.Unlock()
+	r.balancing = enabled
 }
 
 // SetRecord sets the backend service URL for the specifiec (service, version) pair.
@@ -124,6 +214,18 @@ func (r *Records) RemoveRecord(svc, version string, u *url.URL) {
 	}
 }
 
+// Services returns the versions of each service which has records, sorted by name.
+// The blank version ("") is included for services with unversioned records.
+func (r *Records) Services() map[string][]string {
+	r.recordsMu.RLock()
+	defer r.recordsMu.RUnlock()
+	services := make(map[string][]string, len(r.m))
+	for svc, vs := range r.m {
+		services[svc] = vs.names()
+	}
+	return services
+}
+
 // IsServiceUnique checks if there is only one version of a service
 func (r *Records) IsServiceUnique(svc string) bool {
 	r.recordsMu.RLock()
@@ -44,7 +44,11 @@ func TestRecords_GetRecord(t *testing.T) {
 			err: &errors.ProxyError{
 				Code: errors.VersionNotSpecified,
 				Message: fmt.Sprintf("There are multiple version of the gRPC service %s available. "+
-					"You must specify one", "a"),
+					"You must specify one of %s", "a", `"v1", "v2"`),
+				Resolution: &errors.ResolutionError{
+					Service:  "a",
+					Versions: []string{"v1", "v2"},
+				},
 			},
 		},
 		{
@@ -53,8 +57,14 @@ func TestRecords_GetRecord(t *testing.T) {
 			version: "v3",
 			url:     nil,
 			err: &errors.ProxyError{
-				Code:    errors.ServiceUnresolvable,
-				Message: fmt.Sprintf("Version %s of the gRPC service %s is unresolvable", "v3", "a"),
+				Code: errors.ServiceUnresolvable,
+				Message: fmt.Sprintf("Version %s of the gRPC service %s is unresolvable. "+
+					"The known versions are %s", "v3", "a", `"v1", "v2"`),
+				Resolution: &errors.ResolutionError{
+					Service:  "a",
+					Version:  "v3",
+					Versions: []string{"v1", "v2"},
+				},
 			},
 		},
 		{
@@ -72,6 +82,24 @@ func TestRecords_GetRecord(t *testing.T) {
 			err: &errors.ProxyError{
 				Code:    errors.ServiceUnresolvable,
 				Message: fmt.Sprintf("The gRPC service %s is unresolvable", "c"),
+				Resolution: &errors.ResolutionError{
+					Service: "c",
+				},
+			},
+		},
+		{
+			name:    "service not found with suggestions",
+			service: "other.Library",
+			version: "v1",
+			url:     nil,
+			err: &errors.ProxyError{
+				Code:    errors.ServiceUnresolvable,
+				Message: fmt.Sprintf("The gRPC service %s is unresolvable. Did you mean %s?", "other.Library", "my.pkg.Library"),
+				Resolution: &errors.ResolutionError{
+					Service:     "other.Library",
+					Version:     "v1",
+					Suggestions: []string{"my.pkg.Library"},
+				},
 			},
 		},
 		{
@@ -113,6 +141,9 @@ func TestRecords_GetRecord(t *testing.T) {
 			"e": {
 				"v1": []*url.URL{parseURL(t, "e.v1"), parseURL(t, "e.v2")},
 			},
+			"my.pkg.Library": {
+				"v1": []*url.URL{parseURL(t, "library.v1")},
+			},
 		},
 		recordsMu: sync.RWMutex{},
 	}
@@ -140,6 +171,114 @@ func TestRecords_GetRecord(t *testing.T) {
 	}
 }
 
+type fakeOutlierDetector struct {
+	ejected map[string]bool
+}
+
+func (d *fakeOutlierDetector) Ejected(u *url.URL) bool {
+	return d.ejected[u.String()]
+}
+
+func TestRecords_GetRecordWithOutlierDetector(t *testing.T) {
+	cases := []struct {
+		name    string
+		service string
+		version string
+		ejected map[string]bool
+		urls    []*url.URL
+	}{
+		{
+			name:    "skip ejected (unversioned)",
+			service: "d",
+			version: "",
+			ejected: map[string]bool{"d.v1": true},
+			urls:    []*url.URL{parseURL(t, "d.v2")},
+		},
+		{
+			name:    "skip ejected (versioned)",
+			service: "e",
+			version: "v1",
+			ejected: map[string]bool{"e.v2": true},
+			urls:    []*url.URL{parseURL(t, "e.v1")},
+		},
+		{
+			name:    "none ejected",
+			service: "e",
+			version: "v1",
+			ejected: map[string]bool{},
+			urls:    []*url.URL{parseURL(t, "e.v1"), parseURL(t, "e.v2")},
+		},
+		{
+			name:    "all ejected",
+			service: "e",
+			version: "v1",
+			ejected: map[string]bool{"e.v1": true, "e.v2": true},
+			urls:    []*url.URL{parseURL(t, "e.v1"), parseURL(t, "e.v2")},
+		},
+	}
+
+	r := Records{
+		m: map[string]versions{
+			"d": {
+				"": []*url.URL{parseURL(t, "d.v1"), parseURL(t, "d.v2")},
+			},
+			"e": {
+				"v1": []*url.URL{parseURL(t, "e.v1"), parseURL(t, "e.v2")},
+			},
+		},
+		balancing: true,
+		recordsMu: sync.RWMutex{},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r.SetOutlierDetector(&fakeOutlierDetector{ejected: tc.ejected})
+			for i := 0; i < 10; i++ {
+				u, err := r.GetRecord(tc.service, tc.version)
+				if err != nil {
+					t.Fatalf("err should be nil, got %s", err.Error())
+				}
+				found := false
+				for _, want := range tc.urls {
+					if reflect.DeepEqual(u, want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Fatalf("got %s, want one of %v", u.String(), tc.urls)
+				}
+			}
+		})
+	}
+}
+
+func TestRecords_GetRecordBalancing(t *testing.T) {
+	urls := []*url.URL{parseURL(t, "e.v1"), parseURL(t, "e.v2")}
+	r := NewRecords()
+	for _, u := range urls {
+		r.SetRecord("e", "v1", u)
+	}
+
+	r.SetOutlierDetector(&fakeOutlierDetector{})
+	_, err := r.GetRecord("e", "v1")
+	perr, ok := err.(*errors.ProxyError)
+	if !ok {
+		t.Fatalf("got %v, want a ProxyError", err)
+	}
+	if got, want := perr.Code, errors.VersionUndecidable; got != want {
+		t.Fatalf("got %v, want %v without balancing", got, want)
+	}
+
+	r.SetOutlierDetector(nil)
+	r.SetBalancing(true)
+	u, err := r.GetRecord("e", "v1")
+	if err != nil {
+		t.Fatalf("err should be nil, got %s", err.Error())
+	}
+	if !reflect.DeepEqual(u, urls[0]) && !reflect.DeepEqual(u, urls[1]) {
+		t.Fatalf("got %s, want one of %v", u.String(), urls)
+	}
+}
+
 func TestRecords_SetRecord(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -233,6 +372,28 @@ func TestRecords_IsServiceUnique(t *testing.T) {
 	}
 }
 
+func TestRecords_Services(t *testing.T) {
+	r := Records{
+		m: map[string]versions{
+			"a": {
+				"v2": []*url.URL{parseURL(t, "a.v2")},
+				"v1": []*url.URL{parseURL(t, "a.v1")},
+			},
+			"b": {
+				"": []*url.URL{parseURL(t, "b")},
+			},
+		},
+		recordsMu: sync.RWMutex{},
+	}
+	expected := map[string][]string{
+		"a": {"v1", "v2"},
+		"b": {""},
+	}
+	if got, want := r.Services(), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
 func TestRecords_RemoveRecord(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,11 +18,25 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+
+	"github.com/mercari/grpc-http-proxy/config"
 )
 
 const (
-	serviceNameAnnotationKey    = "grpc-http-proxy.alpha.mercari.com/grpc-service"
-	serviceVersionAnnotationKey = "grpc-http-proxy.alpha.mercari.com/grpc-service-version"
+	serviceNameAnnotationKey      = "grpc-http-proxy.alpha.mercari.com/grpc-service"
+	serviceVersionAnnotationKey   = "grpc-http-proxy.alpha.mercari.com/grpc-service-version"
+	timeoutAnnotationKey          = "grpc-http-proxy.alpha.mercari.com/grpc-timeout"
+	maxTimeoutAnnotationKey       = "grpc-http-proxy.alpha.mercari.com/grpc-max-timeout"
+	retryMaxAttemptsAnnotationKey = "grpc-http-proxy.alpha.mercari.com/grpc-retry-max-attempts"
+	retryMethodsAnnotationKey     = "grpc-http-proxy.alpha.mercari.com/grpc-retry-methods"
+	noRetryMethodsAnnotationKey   = "grpc-http-proxy.alpha.mercari.com/grpc-no-retry-methods"
+	keepaliveTimeAnnotationKey    = "grpc-http-proxy.alpha.mercari.com/grpc-keepalive-time"
+	keepaliveTimeoutAnnotationKey = "grpc-http-proxy.alpha.mercari.com/grpc-keepalive-timeout"
+	maxSendMsgSizeAnnotationKey   = "grpc-http-proxy.alpha.mercari.com/grpc-max-send-msg-size"
+	maxRecvMsgSizeAnnotationKey   = "grpc-http-proxy.alpha.mercari.com/grpc-max-recv-msg-size"
+	compressorAnnotationKey       = "grpc-http-proxy.alpha.mercari.com/grpc-compressor"
+	authorityAnnotationKey        = "grpc-http-proxy.alpha.mercari.com/grpc-authority"
+	userAgentAnnotationKey        = "grpc-http-proxy.alpha.mercari.com/grpc-user-agent"
 )
 
 // Service watches the Kubernetes API and updates records when there are changes to Service resources
@@ -118,6 +133,81 @@ func (k *Service) Resolve(svc, version string) (*url.URL, error) {
 	return r, nil
 }
 
+// UpstreamConfig returns the configuration for the upstream, which is read from the annotations of the Service
+func (k *Service) UpstreamConfig(u *url.URL) *config.Upstream {
+	c := &config.Upstream{}
+	namespace, name, ok := serviceFromURL(u)
+	if !ok {
+		return c
+	}
+	svc, err := k.lister.Services(namespace).Get(name)
+	if err != nil {
+		k.logger.Debug("could not find Service for upstream",
+			zap.String("upstream", u.String()),
+			zap.String("err", err.Error()))
+		return c
+	}
+	c.Timeout = k.durationAnnotation(svc, timeoutAnnotationKey)
+	c.MaxTimeout = k.durationAnnotation(svc, maxTimeoutAnnotationKey)
+	c.RetryMaxAttempts = k.intAnnotation(svc, retryMaxAttemptsAnnotationKey)
+	c.RetryMethods = listAnnotation(svc, retryMethodsAnnotationKey)
+	c.NoRetryMethods = listAnnotation(svc, noRetryMethodsAnnotationKey)
+	c.Dial.KeepaliveTime = k.durationAnnotation(svc, keepaliveTimeAnnotationKey)
+	c.Dial.KeepaliveTimeout = k.durationAnnotation(svc, keepaliveTimeoutAnnotationKey)
+	c.Dial.MaxSendMsgSize = k.intAnnotation(svc, maxSendMsgSizeAnnotationKey)
+	c.Dial.MaxRecvMsgSize = k.intAnnotation(svc, maxRecvMsgSizeAnnotationKey)
+	c.Dial.Compressor = svc.Annotations[compressorAnnotationKey]
+	c.Dial.Authority = svc.Annotations[authorityAnnotationKey]
+	c.Dial.UserAgent = svc.Annotations[userAgentAnnotationKey]
+	return c
+}
+
+// durationAnnotation parses the value of an annotation as a duration
+// Zero will be returned if the annotation doesn't exist or is invalid
+func (k *Service) durationAnnotation(svc *core.Service, key string) time.Duration {
+	if !metav1.HasAnnotation(svc.ObjectMeta, key) {
+		return 0
+	}
+	d, err := time.ParseDuration(svc.Annotations[key])
+	if err != nil {
+		k.logger.Error("invalid duration in annotation",
+			zap.String("namespace", svc.Namespace),
+			zap.String("name", svc.Name),
+			zap.String("annotation", key),
+			zap.String("err", err.Error()),
+		)
+		return 0
+	}
+	return d
+}
+
+// intAnnotation parses the value of an annotation as an integer
+// Zero will be returned if the annotation doesn't exist or is invalid
+func (k *Service) intAnnotation(svc *core.Service, key string) int {
+	if !metav1.HasAnnotation(svc.ObjectMeta, key) {
+		return 0
+	}
+	i, err := strconv.Atoi(svc.Annotations[key])
+	if err != nil {
+		k.logger.Error("invalid integer in annotation",
+			zap.String("namespace", svc.Namespace),
+			zap.String("name", svc.Name),
+			zap.String("annotation", key),
+			zap.String("err", err.Error()),
+		)
+		return 0
+	}
+	return i
+}
+
+// listAnnotation splits the value of an annotation delimited by commas
+func listAnnotation(svc *core.Service, key string) []string {
+	if !metav1.HasAnnotation(svc.ObjectMeta, key) {
+		return nil
+	}
+	return strings.Split(svc.Annotations[key], ",")
+}
+
 // Run starts the Service controller
 func (k *Service) Run(stopCh <-chan struct{}) {
 	go k.informer.Run(stopCh)
@@ -346,6 +436,16 @@ func (k *Service) constructURL(svc *core.Service) (*url.URL, bool) {
 	return u, true
 }
 
+// serviceFromURL is the inverse of constructURL, and returns the namespace and name of the Service
+func serviceFromURL(u *url.URL) (string, string, bool) {
+	// Service names and namespaces are DNS labels, so they never contain dots
+	parts := strings.SplitN(u.String(), ".", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "svc.cluster.local:") {
+		return "", "", false
+	}
+	return parts[1], parts[0], true
+}
+
 // selectPort selects a port from the Service
 // * if there are zero ports, the second return value will be false
 // * if there are exactly one port, that will be returned
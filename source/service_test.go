@@ -17,6 +17,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/mercari/grpc-http-proxy/config"
 	"github.com/mercari/grpc-http-proxy/errors"
 )
 
@@ -1237,3 +1238,161 @@ func Test_AreServicesMissing(t *testing.T) {
 		})
 	}
 }
+
+func TestService_UpstreamConfig(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		url         *url.URL
+		config      *config.Upstream
+	}{
+		{
+			name: "timeouts",
+			annotations: map[string]string{
+				serviceNameAnnotationKey: "Echo",
+				timeoutAnnotationKey:     "5s",
+				maxTimeoutAnnotationKey:  "1m",
+			},
+			url: parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{
+				Timeout:    5 * time.Second,
+				MaxTimeout: time.Minute,
+			},
+		},
+		{
+			name: "retries",
+			annotations: map[string]string{
+				serviceNameAnnotationKey:      "Echo",
+				retryMaxAttemptsAnnotationKey: "5",
+				retryMethodsAnnotationKey:     "Echo/Say,Echo/Shout",
+				noRetryMethodsAnnotationKey:   "Echo/Whisper",
+			},
+			url: parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{
+				RetryMaxAttempts: 5,
+				RetryMethods:     []string{"Echo/Say", "Echo/Shout"},
+				NoRetryMethods:   []string{"Echo/Whisper"},
+			},
+		},
+		{
+			name: "dial options",
+			annotations: map[string]string{
+				serviceNameAnnotationKey:      "Echo",
+				keepaliveTimeAnnotationKey:    "30s",
+				keepaliveTimeoutAnnotationKey: "5s",
+				maxSendMsgSizeAnnotationKey:   "1048576",
+				maxRecvMsgSizeAnnotationKey:   "16777216",
+				compressorAnnotationKey:       "gzip",
+				authorityAnnotationKey:        "echo.example.com",
+				userAgentAnnotationKey:        "echo-client",
+			},
+			url: parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{
+				Dial: config.Dial{
+					KeepaliveTime:    30 * time.Second,
+					KeepaliveTimeout: 5 * time.Second,
+					MaxSendMsgSize:   1048576,
+					MaxRecvMsgSize:   16777216,
+					Compressor:       "gzip",
+					Authority:        "echo.example.com",
+					UserAgent:        "echo-client",
+				},
+			},
+		},
+		{
+			name: "invalid retry max attempts",
+			annotations: map[string]string{
+				serviceNameAnnotationKey:      "Echo",
+				retryMaxAttemptsAnnotationKey: "foo",
+			},
+			url:    parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{},
+		},
+		{
+			name: "invalid timeout",
+			annotations: map[string]string{
+				serviceNameAnnotationKey: "Echo",
+				timeoutAnnotationKey:     "foo",
+			},
+			url:    parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{},
+		},
+		{
+			name: "no annotations",
+			annotations: map[string]string{
+				serviceNameAnnotationKey: "Echo",
+			},
+			url:    parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{},
+		},
+		{
+			name: "unknown Service",
+			annotations: map[string]string{
+				serviceNameAnnotationKey: "Echo",
+				timeoutAnnotationKey:     "5s",
+			},
+			url:    parseURL(t, "other-service.bar-ns.svc.cluster.local:5000"),
+			config: &config.Upstream{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.lister = append(f.lister, newService(
+				"foo-service",
+				"bar-ns",
+				tc.annotations,
+				[]core.ServicePort{
+					{
+						Name:     "grpc",
+						Protocol: "TCP",
+						Port:     5000,
+					},
+				},
+			))
+			k := f.newKubernetes()
+			if got, want := k.UpstreamConfig(tc.url), tc.config; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestServiceFromURL(t *testing.T) {
+	cases := []struct {
+		name      string
+		url       *url.URL
+		namespace string
+		service   string
+		ok        bool
+	}{
+		{
+			name:      "in-cluster",
+			url:       parseURL(t, "foo-service.bar-ns.svc.cluster.local:5000"),
+			namespace: "bar-ns",
+			service:   "foo-service",
+			ok:        true,
+		},
+		{
+			name:      "other host",
+			url:       parseURL(t, "localhost:5000"),
+			namespace: "",
+			service:   "",
+			ok:        false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			namespace, service, ok := serviceFromURL(tc.url)
+			if got, want := namespace, tc.namespace; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := service, tc.service; got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+			if got, want := ok, tc.ok; got != want {
+				t.Fatalf("got %t, want %t", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package source
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of services suggested for an unknown service
+const maxSuggestions = 3
+
+// closestServices returns the services whose names are the closest to svc, which are suggested when svc is unknown.
+// nil is returned if no service is close.
+// A service is close if the edit distance between the names is at most a third of the length of svc ignoring case,
+// or its name without the package is the same as that of svc, which means svc is in a wrong package.
+func closestServices(svc string, services []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	lower := strings.ToLower(svc)
+	var candidates []candidate
+	for _, name := range services {
+		d := editDistance(lower, strings.ToLower(name))
+		if d > len(svc)/3 && !strings.EqualFold(simpleName(svc), simpleName(name)) {
+			continue
+		}
+		candidates = append(candidates, candidate{name: name, distance: d})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	var names []string
+	for _, c := range candidates {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// simpleName returns the name of the service without its package
+func simpleName(svc string) string {
+	return svc[strings.LastIndex(svc, ".")+1:]
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a int, bs ...int) int {
+	for _, b := range bs {
+		if b < a {
+			a = b
+		}
+	}
+	return a
+}
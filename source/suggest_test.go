@@ -0,0 +1,65 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClosestServices(t *testing.T) {
+	services := []string{
+		"my.pkg.Library",
+		"my.pkg.Librarian",
+		"my.pkg.Bookshelf",
+		"other.pkg.Library",
+	}
+	cases := []struct {
+		name    string
+		service string
+		want    []string
+	}{
+		{
+			name:    "typo",
+			service: "my.pkg.Libary",
+			want:    []string{"my.pkg.Library", "my.pkg.Librarian"},
+		},
+		{
+			name:    "case",
+			service: "my.pkg.library",
+			want:    []string{"my.pkg.Library", "my.pkg.Librarian", "other.pkg.Library"},
+		},
+		{
+			name:    "wrong package",
+			service: "Library",
+			want:    []string{"my.pkg.Library", "other.pkg.Library"},
+		},
+		{
+			name:    "no close services",
+			service: "a.Unknown",
+			want:    nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := closestServices(tc.service, services); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "abc", want: 3},
+		{a: "abc", b: "abc", want: 0},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "library", b: "libary", want: 1},
+	}
+	for _, tc := range cases {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q): got %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}